@@ -0,0 +1,143 @@
+// Package audiofile reads the length of WAV and MP3 files which are played by the robot.
+package audiofile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Duration returns the length of the audio file in seconds, the format is chosen by the file extension.
+func Duration(fpath string) (float64, error) {
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".wav":
+		return WAVDuration(b)
+	case ".mp3":
+		return MP3Duration(b)
+	}
+	return 0, fmt.Errorf("unsupported audio format %q", filepath.Ext(fpath))
+}
+
+// WAVDuration returns the length of a RIFF WAVE file in seconds.
+func WAVDuration(b []byte) (float64, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return 0, fmt.Errorf("not a WAV file")
+	}
+
+	var byteRate uint32
+	for pos := 12; pos+8 <= len(b); {
+		id := string(b[pos : pos+4])
+		size := binary.LittleEndian.Uint32(b[pos+4 : pos+8])
+		body := pos + 8
+		switch id {
+		case "fmt ":
+			if body+12 > len(b) {
+				return 0, fmt.Errorf("the fmt chunk is truncated")
+			}
+			byteRate = binary.LittleEndian.Uint32(b[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, fmt.Errorf("the data chunk comes before the fmt chunk or the byte rate is zero")
+			}
+			// the size of a stream which has been cut off or is still being written can be wrong
+			if available := uint32(len(b) - body); size > available {
+				size = available
+			}
+			return float64(size) / float64(byteRate), nil
+		}
+		pos = body + int(size) + int(size%2) // chunks are word aligned
+	}
+	return 0, fmt.Errorf("the data chunk is missing")
+}
+
+var (
+	mp3Bitrates = map[[2]int][16]int{ // kbps by MPEG version (1 or 2, 2.5 uses 2) and layer
+		{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = map[int][3]int{ // by the version bits of the header
+		3: {44100, 48000, 32000}, // MPEG 1
+		2: {22050, 24000, 16000}, // MPEG 2
+		0: {11025, 12000, 8000},  // MPEG 2.5
+	}
+)
+
+// MP3Duration returns the length of an MP3 file in seconds by summing up lengths of all its frames,
+// so files with a variable bitrate are measured correctly.
+func MP3Duration(b []byte) (float64, error) {
+	pos := 0
+	if len(b) >= 10 && bytes.HasPrefix(b, []byte("ID3")) {
+		size := int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f)
+		pos = 10 + size
+		if b[5]&0x10 != 0 { // footer
+			pos += 10
+		}
+	}
+
+	duration := 0.0
+	frames := 0
+	for pos+4 <= len(b) {
+		length, seconds, ok := mp3Frame(b[pos : pos+4])
+		if !ok || pos+length > len(b) {
+			pos++ // looking for the next frame after garbage, e.g., a trailing tag
+			continue
+		}
+		duration += seconds
+		frames++
+		pos += length
+	}
+	if frames == 0 {
+		return 0, fmt.Errorf("no MP3 frames found")
+	}
+	return duration, nil
+}
+
+// mp3Frame parses a frame header and returns the frame length in bytes and its duration in seconds.
+func mp3Frame(h []byte) (int, float64, bool) {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return 0, 0, false
+	}
+	versionBits := int(h[1]>>3) & 3
+	layer := 4 - int(h[1]>>1)&3 // 1, 2, 3, or 4 for the reserved value
+	bitrateIndex := int(h[2] >> 4)
+	sampleRateIndex := int(h[2]>>2) & 3
+	padding := int(h[2]>>1) & 1
+	if versionBits == 1 || layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return 0, 0, false
+	}
+
+	version := 2
+	if versionBits == 3 {
+		version = 1
+	}
+	bitrate := mp3Bitrates[[2]int{version, layer}][bitrateIndex] * 1000
+	sampleRate := mp3SampleRates[versionBits][sampleRateIndex]
+
+	var length, samples int
+	switch {
+	case layer == 1:
+		length = (12*bitrate/sampleRate + padding) * 4
+		samples = 384
+	case layer == 3 && version != 1:
+		length = 72*bitrate/sampleRate + padding
+		samples = 576
+	default:
+		length = 144*bitrate/sampleRate + padding
+		samples = 1152
+	}
+	if length < 4 {
+		return 0, 0, false
+	}
+	return length, float64(samples) / float64(sampleRate), true
+}
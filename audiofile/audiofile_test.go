@@ -0,0 +1,153 @@
+package audiofile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// wav builds a WAV file with the chunks, a chunk's size can differ from the length of its body.
+func wav(chunks ...chunk) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("RIFF")
+	binary.Write(b, binary.LittleEndian, uint32(0)) // readers don't rely on the RIFF size
+	b.WriteString("WAVE")
+	for _, c := range chunks {
+		b.WriteString(c.id)
+		binary.Write(b, binary.LittleEndian, c.size)
+		b.Write(c.body)
+	}
+	return b.Bytes()
+}
+
+type chunk struct {
+	id   string
+	size uint32
+	body []byte
+}
+
+// fmtChunk describes 16-bit mono PCM with the byte rate of 2 * sampleRate.
+func fmtChunk(sampleRate uint32) chunk {
+	b := &bytes.Buffer{}
+	for _, v := range []interface{}{uint16(1), uint16(1), sampleRate, sampleRate * 2, uint16(2), uint16(16)} {
+		binary.Write(b, binary.LittleEndian, v)
+	}
+	return chunk{"fmt ", uint32(b.Len()), b.Bytes()}
+}
+
+func dataChunk(size, written int) chunk {
+	return chunk{"data", uint32(size), make([]byte, written)}
+}
+
+func TestWAVDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		b     []byte
+		want  float64
+		valid bool
+	}{
+		{"one second", wav(fmtChunk(8000), dataChunk(16000, 16000)), 1, true},
+		{"odd chunk before data", wav(fmtChunk(8000), chunk{"LIST", 3, []byte{1, 2, 3, 0}}, dataChunk(8000, 8000)), 0.5, true},
+		{"truncated data", wav(fmtChunk(8000), dataChunk(16000, 4000)), 0.25, true},
+		{"data before fmt", wav(dataChunk(16000, 16000), fmtChunk(8000)), 0, false},
+		{"no data", wav(fmtChunk(8000)), 0, false},
+		{"truncated fmt", wav(chunk{"fmt ", 16, []byte{1, 0, 1, 0}}), 0, false},
+		{"not RIFF", []byte("ID3 something else"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WAVDuration(tt.b)
+			if (err == nil) != tt.valid {
+				t.Fatalf("valid %v, got %v", tt.valid, err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v seconds, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// mp3Header is MPEG 1 Layer III at 128 kbps and 44100 Hz without padding, its frames are 417 bytes long
+// and 1152 samples.
+var mp3Header = []byte{0xff, 0xfb, 0x90, 0x00}
+
+const mp3FrameSeconds = 1152.0 / 44100
+
+func mp3Frames(n int) []byte {
+	b := []byte{}
+	for i := 0; i < n; i++ {
+		frame := make([]byte, 417)
+		copy(frame, mp3Header)
+		b = append(b, frame...)
+	}
+	return b
+}
+
+// id3v2 is a tag with a frame header inside it, which mustn't be counted.
+func id3v2() []byte {
+	body := append(append([]byte{}, mp3Header...), make([]byte, 450)...)
+	size := len(body)
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, body...)
+}
+
+func TestMP3Duration(t *testing.T) {
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name   string
+		b      []byte
+		frames int
+		valid  bool
+	}{
+		{"frames", mp3Frames(10), 10, true},
+		{"leading ID3 tag", join(id3v2(), mp3Frames(10)), 10, true},
+		{"trailing tag", join(mp3Frames(10), id3v1), 10, true},
+		{"both tags", join(id3v2(), mp3Frames(3), id3v1), 3, true},
+		{"truncated last frame", mp3Frames(4)[:4*417-100], 3, true},
+		{"garbage", bytes.Repeat([]byte("garbage"), 100), 0, false},
+		{"only a tag", id3v2()[:20], 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MP3Duration(tt.b)
+			if (err == nil) != tt.valid {
+				t.Fatalf("valid %v, got %v", tt.valid, err)
+			}
+			if want := float64(tt.frames) * mp3FrameSeconds; math.Abs(got-want) > 1e-9 {
+				t.Fatalf("got %v seconds, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a.WAV":  wav(fmtChunk(8000), dataChunk(16000, 16000)),
+		"b.mp3":  mp3Frames(2),
+		"c.flac": []byte("fLaC"),
+	}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d, err := Duration(filepath.Join(dir, "a.WAV")); err != nil || d != 1 {
+		t.Fatalf("got %v, %v for the WAV file", d, err)
+	}
+	if d, err := Duration(filepath.Join(dir, "b.mp3")); err != nil || math.Abs(d-2*mp3FrameSeconds) > 1e-9 {
+		t.Fatalf("got %v, %v for the MP3 file", d, err)
+	}
+	if _, err := Duration(filepath.Join(dir, "c.flac")); err == nil {
+		t.Fatal("an unsupported format is measured")
+	}
+	if _, err := Duration(filepath.Join(dir, "missing.wav")); err == nil {
+		t.Fatal("a missing file is measured")
+	}
+}
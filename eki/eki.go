@@ -34,6 +34,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type Payload struct {
@@ -69,7 +70,7 @@ func Send(p *Payload) (response *Response, err error) {
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: time.Minute} // a stalled request mustn't hang synthesis jobs
 	resp, err := client.Do(req)
 	if err != nil {
 		return
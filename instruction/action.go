@@ -3,6 +3,7 @@ package instruction
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"strconv"
 
@@ -19,6 +20,11 @@ type Action struct {
 	MoveItem  *Move      `json:"MoveItem" form:"MoveItem"`
 	ImageItem *ShowImage `json:"ImageItem" form:"ImageItem"`
 	URLItem   *ShowURI   `json:"URLItem" form:"URLItem"`
+	StopItem  *Stop      `json:"StopItem" form:"StopItem"`
+
+	// VariantsItem makes the action a pool of other actions, when it's present, only one of the pool's actions
+	// is sent instead of the action itself, see Resolve.
+	VariantsItem *Variants `json:"VariantsItem" form:"VariantsItem"`
 }
 
 func (a *Action) UnmarshalJSON(b []byte) error {
@@ -30,6 +36,7 @@ func (a *Action) UnmarshalJSON(b []byte) error {
 
 	var id, name, phrase, fpath, group string
 	var delaySeconds int64
+	var speed float64
 	var uid uuid.UUID
 	var ok bool
 
@@ -58,6 +65,8 @@ func (a *Action) UnmarshalJSON(b []byte) error {
 	imageItem, _ := m["ImageItem"].(map[string]interface{})
 	urlItem, _ := m["URLItem"].(map[string]interface{})
 
+	// IDs of nested items are decoded one after another, so the previous ID must not leak into an item without it
+	uid = uuid.UUID{}
 	if id, ok = sayItem["ID"].(string); ok && len(id) > 0 {
 		uid, err = uuid.Parse(id)
 		if err != nil {
@@ -70,14 +79,28 @@ func (a *Action) UnmarshalJSON(b []byte) error {
 	if delaySeconds, err = castDelay(sayItem["Delay"]); err != nil {
 		return err
 	}
+	language, _ := sayItem["Language"].(string)
+	var translations map[string]*Translation
+	if t, ok := sayItem["Translations"].(map[string]interface{}); ok && len(t) > 0 {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(b, &translations); err != nil {
+			return err
+		}
+	}
 	a.SayItem = &Say{
-		ID:       uid,
-		Phrase:   phrase,
-		FilePath: fpath,
-		Group:    group,
-		Delay:    delaySeconds,
+		ID:           uid,
+		Phrase:       phrase,
+		FilePath:     fpath,
+		Group:        group,
+		Delay:        delaySeconds,
+		Language:     language,
+		Translations: translations,
 	}
 
+	uid = uuid.UUID{}
 	if id, ok = moveItem["ID"].(string); ok && len(id) > 0 {
 		uid, err = uuid.Parse(id)
 		if err != nil {
@@ -90,14 +113,19 @@ func (a *Action) UnmarshalJSON(b []byte) error {
 	if delaySeconds, err = castDelay(moveItem["Delay"]); err != nil {
 		return err
 	}
+	if speed, err = castSpeed(moveItem["Speed"]); err != nil {
+		return err
+	}
 	a.MoveItem = &Move{
 		ID:       uid,
 		Name:     name,
 		FilePath: fpath,
 		Delay:    delaySeconds,
 		Group:    group,
+		Speed:    speed,
 	}
 
+	uid = uuid.UUID{}
 	if id, ok = imageItem["ID"].(string); ok && len(id) > 0 {
 		uid, err = uuid.Parse(id)
 		if err != nil {
@@ -118,6 +146,7 @@ func (a *Action) UnmarshalJSON(b []byte) error {
 		Group:    group,
 	}
 
+	uid = uuid.UUID{}
 	if id, ok = urlItem["ID"].(string); ok && len(id) > 0 {
 		uid, err = uuid.Parse(id)
 		if err != nil {
@@ -145,6 +174,42 @@ func (a *Action) UnmarshalJSON(b []byte) error {
 		Group: group,
 	}
 
+	// StopItem is created only when it's provided, because a non-nil one interrupts the robot
+	if stopItem, ok := m["StopItem"].(map[string]interface{}); ok {
+		uid = uuid.UUID{}
+		if id, ok = stopItem["ID"].(string); ok && len(id) > 0 {
+			uid, err = uuid.Parse(id)
+			if err != nil {
+				return err
+			}
+		}
+		name, _ = stopItem["Name"].(string)
+		group, _ = stopItem["Group"].(string)
+		resetPosture, _ := stopItem["ResetPosture"].(bool)
+		if delaySeconds, err = castDelay(stopItem["Delay"]); err != nil {
+			return err
+		}
+		a.StopItem = &Stop{
+			ID:           uid,
+			Name:         name,
+			Group:        group,
+			Delay:        delaySeconds,
+			ResetPosture: resetPosture,
+		}
+	}
+
+	// VariantsItem is created only when it's provided, because a non-nil one replaces the action when sent
+	if variantsItem, ok := m["VariantsItem"].(map[string]interface{}); ok {
+		b, err := json.Marshal(variantsItem)
+		if err != nil {
+			return err
+		}
+		a.VariantsItem = &Variants{}
+		if err = json.Unmarshal(b, a.VariantsItem); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -165,6 +230,26 @@ func castDelay(delay interface{}) (delaySeconds int64, err error) {
 	return
 }
 
+func castSpeed(speed interface{}) (factor float64, err error) {
+	switch v := speed.(type) {
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		factor, err = strconv.ParseFloat(v, 64)
+	case int:
+		factor = float64(v)
+	case float64:
+		factor = v
+	default:
+		factor = 0
+	}
+	if err == nil && factor != 0 && !IsValidSpeed(factor) {
+		err = fmt.Errorf("speed factor must be in the range [%v, %v], got %v", MinSpeed, MaxSpeed, factor)
+	}
+	return
+}
+
 func (a *Action) IsValid() bool {
 	if a == nil {
 		return false
@@ -176,7 +261,12 @@ func (a *Action) IsValid() bool {
 	if !a.SayItem.IsValid() &&
 		!a.MoveItem.IsValid() &&
 		!a.ImageItem.IsValid() &&
-		!a.URLItem.IsValid() {
+		!a.URLItem.IsValid() &&
+		!a.StopItem.IsValid() &&
+		!a.VariantsItem.IsValid() {
+		return false
+	}
+	if a.VariantsItem != nil && !a.VariantsItem.IsValid() {
 		return false
 	}
 	return true
@@ -202,7 +292,9 @@ func (a *Action) IsNil() bool {
 	if a.SayItem.IsNil() &&
 		a.MoveItem.IsNil() &&
 		a.ImageItem.IsNil() &&
-		a.URLItem.IsNil() {
+		a.URLItem.IsNil() &&
+		a.StopItem.IsNil() &&
+		a.VariantsItem.IsNil() {
 		return true
 	}
 
@@ -229,6 +321,10 @@ func (a *Action) InitiateItemsIDs() {
 	if a.URLItem != nil && (a.URLItem.ID == uuid.UUID{}) {
 		a.URLItem.ID = uuid.Must(uuid.NewRandom())
 	}
+	if a.StopItem != nil && (a.StopItem.ID == uuid.UUID{}) {
+		a.StopItem.ID = uuid.Must(uuid.NewRandom())
+	}
+	a.VariantsItem.InitiateItemsIDs()
 }
 
 func (a *Action) LocateAssets() []string {
@@ -240,12 +336,66 @@ func (a *Action) LocateAssets() []string {
 	if a.SayItem != nil && a.SayItem.FilePath != "" {
 		paths = append(paths, a.SayItem.FilePath)
 	}
+	paths = append(paths, a.SayItem.translationFiles()...)
 	if a.ImageItem != nil && a.ImageItem.FilePath != "" {
 		paths = append(paths, a.ImageItem.FilePath)
 	}
 	if a.MoveItem != nil && a.MoveItem.FilePath != "" {
 		paths = append(paths, a.MoveItem.FilePath)
 	}
+	if a.VariantsItem != nil {
+		for _, e := range a.VariantsItem.Entries {
+			paths = append(paths, e.Action.LocateAssets()...)
+		}
+	}
+
+	return paths
+}
+
+// OwnedFiles returns paths of files which belong only to the action and should be removed together with it.
+// Moves aren't included, because some of them are located in the built-in data folder.
+func (a *Action) OwnedFiles() []string {
+	if a == nil {
+		return nil
+	}
+
+	paths := []string{}
+	if a.SayItem != nil && a.SayItem.FilePath != "" {
+		paths = append(paths, a.SayItem.FilePath)
+	}
+	paths = append(paths, a.SayItem.translationFiles()...)
+	if a.ImageItem != nil && a.ImageItem.FilePath != "" {
+		paths = append(paths, a.ImageItem.FilePath)
+	}
+	if a.VariantsItem != nil {
+		for _, e := range a.VariantsItem.Entries {
+			paths = append(paths, e.Action.OwnedFiles()...)
+		}
+	}
 
 	return paths
 }
+
+// Resolve returns the action which should be actually sent: for a pool of variants, it's one of the pool's
+// actions, for other actions, it's the action itself. Round-robin pools continue their cycles in cycles.
+func (a *Action) Resolve(cycles *Cycles) *Action {
+	if a == nil || a.VariantsItem == nil {
+		return a
+	}
+	picked := a.VariantsItem.Pick(cycles)
+	if picked == nil {
+		return a
+	}
+	return picked.Resolve(cycles)
+}
+
+// Localize returns a copy of the action with the phrase in the first available language of the preference
+// order, see Say.Localize. Variants should be resolved first.
+func (a *Action) Localize(languages []string) *Action {
+	if a == nil || a.SayItem == nil || len(languages) == 0 {
+		return a
+	}
+	localized := *a
+	localized.SayItem = a.SayItem.Localize(languages)
+	return &localized
+}
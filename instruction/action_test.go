@@ -0,0 +1,63 @@
+package instruction
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAction_UnmarshalJSON_NestedIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"nested items without IDs", `{
+			"ID": "11111111-1111-1111-1111-111111111111",
+			"SayItem": {"Phrase": "hi"},
+			"MoveItem": {"Name": "Hey_1"},
+			"ImageItem": {"FilePath": "data/uploads/a.png"},
+			"URLItem": {"URL": "https://example.com"},
+			"StopItem": {}
+		}`},
+		{"only the say item has an ID", `{
+			"SayItem": {"ID": "22222222-2222-2222-2222-222222222222", "Phrase": "hi"},
+			"MoveItem": {"Name": "Hey_1"},
+			"ImageItem": {},
+			"URLItem": {},
+			"StopItem": {}
+		}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Action{}
+			if err := json.Unmarshal([]byte(tt.json), a); err != nil {
+				t.Fatal(err)
+			}
+			var raw struct {
+				ID      string
+				SayItem struct{ ID string }
+			}
+			if err := json.Unmarshal([]byte(tt.json), &raw); err != nil {
+				t.Fatal(err)
+			}
+
+			want := func(name string, got uuid.UUID, id string) {
+				t.Helper()
+				expected := uuid.UUID{}
+				if id != "" {
+					expected = uuid.MustParse(id)
+				}
+				if got != expected {
+					t.Errorf("%s ID = %v, want %v", name, got, expected)
+				}
+			}
+			want("action", a.ID, raw.ID)
+			want("SayItem", a.SayItem.ID, raw.SayItem.ID)
+			want("MoveItem", a.MoveItem.ID, "")
+			want("ImageItem", a.ImageItem.ID, "")
+			want("URLItem", a.URLItem.ID, "")
+			want("StopItem", a.StopItem.ID, "")
+		})
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"sync"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/iharsuvorau/garlic/qianim"
 )
 
 // Instruction is the main interface to a robot, which allows to send commands and necessary data.
@@ -44,6 +46,7 @@ const (
 	MoveCommand
 	ShowImageCommand
 	ShowURLCommand
+	StopCommand
 )
 
 func (c Command) String() string {
@@ -58,6 +61,8 @@ func (c Command) String() string {
 		return "show_image"
 	case ShowURLCommand:
 		return "show_url"
+	case StopCommand:
+		return "stop"
 	}
 	return ""
 }
@@ -69,6 +74,7 @@ type PepperMessage struct {
 	Content string  `json:"content"`
 	Name    string  `json:"name"`
 	Delay   int64   `json:"delay"`
+	Speed   float64 `json:"speed"` // only for moves located on the robot, other moves are time-stretched on the server
 }
 
 func (pm PepperMessage) MarshalJSON() ([]byte, error) {
@@ -78,6 +84,9 @@ func (pm PepperMessage) MarshalJSON() ([]byte, error) {
 		"name":    pm.Name,
 		"delay":   pm.Delay,
 	}
+	if pm.Speed != 0 && pm.Speed != 1 {
+		v["speed"] = pm.Speed
+	}
 	return json.Marshal(v)
 }
 
@@ -114,9 +123,27 @@ func SendInstruction(instr Instruction, connection *websocket.Conn, mu *sync.Mut
 func handleAction(instr Instruction, connection *websocket.Conn, mu *sync.Mutex) error {
 	// unpacking the wrapper and sending three actions sequentially
 	// NOTE: actually, we send only a motion and image now, because audio is played via a speaker from a local computer
-	action := instr.(*Action)
+	action := instr.(*Action).Resolve(nil) // callers resolve variants with their cycles, this is a fallback
+
+	// NOTE: order of processing matters: stop goes first, image with URL go last
+
+	// stopping whatever the robot is doing before sending new commands
+	if action.StopItem != nil {
+		content, err := action.StopItem.Content()
+		if err != nil {
+			return err
+		}
+		stop := PepperMessage{
+			Command: action.StopItem.Command(),
+			Content: base64.StdEncoding.EncodeToString(content),
+			Name:    action.StopItem.GetName(),
+			Delay:   action.StopItem.DelayMillis(),
+		}
 
-	// NOTE: order of processing matters: image with URL go last
+		if err := stop.SendWS(connection, mu); err != nil {
+			return err
+		}
+	}
 
 	// getting the phrase content--must come before image processing, otherwise a phony phrase can disrupt
 	// image showing on a robot, because the image is cancelled when any other command is sent
@@ -137,6 +164,10 @@ func handleAction(instr Instruction, connection *websocket.Conn, mu *sync.Mutex)
 	// trying to get the content of a file
 	if action.MoveItem != nil {
 		content, err := action.MoveItem.Content()
+		if _, ok := err.(*qianim.ValidationError); ok {
+			// an unsafe move must never reach the robot
+			return err
+		}
 		if err != nil && action.MoveItem.Name == "" {
 			// second, checking on the name presence and sending just a name,
 			// the move should be located on the Android app's side then
@@ -153,6 +184,9 @@ func handleAction(instr Instruction, connection *websocket.Conn, mu *sync.Mutex)
 				Content: base64.StdEncoding.EncodeToString(content),
 				Delay:   action.MoveItem.DelayMillis(),
 			}
+			if len(content) == 0 {
+				move.Speed = action.MoveItem.SpeedFactor()
+			}
 
 			if err := move.SendWS(connection, mu); err != nil {
 				return err
@@ -218,6 +252,10 @@ func handleSay(instr Instruction, connection *websocket.Conn, mu *sync.Mutex) er
 func handleAny(instr Instruction, connection *websocket.Conn, mu *sync.Mutex) error {
 	name := instr.GetName()
 	content, err := instr.Content()
+	if _, ok := err.(*qianim.ValidationError); ok {
+		// an unsafe move must never reach the robot
+		return err
+	}
 	if err != nil && name == "" {
 		return fmt.Errorf("can't get content out of an instruction and Name is missing, which makes the instruction ambiguous: %v", err)
 	} else {
@@ -230,6 +268,9 @@ func handleAny(instr Instruction, connection *websocket.Conn, mu *sync.Mutex) er
 		Content: base64.StdEncoding.EncodeToString(content),
 		Delay:   instr.DelayMillis(),
 	}
+	if move, ok := instr.(*Move); ok && len(content) == 0 {
+		msg.Speed = move.SpeedFactor()
+	}
 
 	return msg.SendWS(connection, mu)
 }
@@ -7,6 +7,14 @@ import (
 	"os"
 
 	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/qianim"
+)
+
+// Limits of the move playback speed factor.
+const (
+	MinSpeed = 0.25
+	MaxSpeed = 2.0
 )
 
 // Move implements Instruction
@@ -16,6 +24,7 @@ type Move struct {
 	FilePath string
 	Delay    int64 // in seconds
 	Group    string
+	Speed    float64 // playback speed factor, 0 means the normal speed
 }
 
 func (item *Move) Command() Command {
@@ -31,6 +40,19 @@ func (item *Move) Content() (b []byte, err error) {
 		return b, fmt.Errorf("FilePath is missing")
 	}
 
+	if item.SpeedFactor() != 1 {
+		// time-stretching the animation on the server side, so the robot plays it as a usual move
+		anim, err := qianim.ParseFile(item.FilePath)
+		if err != nil {
+			return b, err
+		}
+		scaled := qianim.Scale(anim, item.SpeedFactor())
+		if err = qianim.Validate(scaled); err != nil {
+			return b, err
+		}
+		return scaled.Bytes()
+	}
+
 	f, err := os.Open(item.FilePath)
 	defer f.Close()
 	if err != nil {
@@ -44,6 +66,14 @@ func (item *Move) DelayMillis() int64 {
 	return item.Delay * 1000
 }
 
+// SpeedFactor returns the playback speed factor, 1 is the normal speed.
+func (item *Move) SpeedFactor() float64 {
+	if item == nil || item.Speed == 0 {
+		return 1
+	}
+	return item.Speed
+}
+
 func (item *Move) IsValid() bool {
 	// nil action is valid, because an action can contain empty SayItem,
 	// ImageItem but non-nil URLItem, for example
@@ -60,6 +90,10 @@ func (item *Move) IsValid() bool {
 		log.Println("move's Name or FilePath are empty")
 		return false
 	}
+	if !IsValidSpeed(item.SpeedFactor()) {
+		log.Printf("move's speed factor is out of range [%v, %v]: %v", MinSpeed, MaxSpeed, item.Speed)
+		return false
+	}
 	return true
 }
 
@@ -70,3 +104,8 @@ func (item *Move) IsNil() bool {
 func (item *Move) GetName() string {
 	return item.Name
 }
+
+// IsValidSpeed is true when the speed factor is within the range supported for moves.
+func IsValidSpeed(factor float64) bool {
+	return factor >= MinSpeed && factor <= MaxSpeed
+}
@@ -3,6 +3,8 @@ package instruction
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -14,6 +16,15 @@ type Say struct {
 	FilePath string
 	Group    string
 	Delay    int64 // in seconds
+
+	Language     string                  // language of Phrase and FilePath, optional
+	Translations map[string]*Translation // the phrase in other languages by language codes, e.g., et, ru, en
+}
+
+// Translation is the phrase of a Say item in another language with its audio.
+type Translation struct {
+	Phrase   string
+	FilePath string
 }
 
 func (item *Say) Command() Command {
@@ -43,7 +54,7 @@ func (item *Say) IsValid() bool {
 	if _, err := uuid.Parse(item.ID.String()); err != nil {
 		return false
 	}
-	if item.FilePath == "" && item.Phrase == "" {
+	if item.FilePath == "" && item.Phrase == "" && len(item.Languages()) == 0 {
 		return false
 	}
 
@@ -57,3 +68,65 @@ func (item *Say) IsNil() bool {
 func (item *Say) GetName() string {
 	return fmt.Sprintf("Say: %s", item.Phrase)
 }
+
+// Localize returns the item in the first language of the preference order which the item has, languages
+// later in the order are fallbacks. The item itself is returned when none of the languages is available.
+func (item *Say) Localize(languages []string) *Say {
+	if item == nil {
+		return nil
+	}
+	for _, lang := range languages {
+		lang = NormalizeLanguage(lang)
+		if lang == "" {
+			continue
+		}
+		if lang == NormalizeLanguage(item.Language) {
+			return item
+		}
+		for code, t := range item.Translations {
+			if NormalizeLanguage(code) == lang && t != nil && (t.Phrase != "" || t.FilePath != "") {
+				localized := *item
+				localized.Language = lang
+				localized.Phrase = t.Phrase
+				localized.FilePath = t.FilePath
+				localized.Translations = nil
+				return &localized
+			}
+		}
+	}
+	return item
+}
+
+// Languages returns codes of the languages the item has translations for.
+func (item *Say) Languages() []string {
+	if item == nil {
+		return nil
+	}
+	languages := []string{}
+	for code, t := range item.Translations {
+		if t != nil && (t.Phrase != "" || t.FilePath != "") {
+			languages = append(languages, NormalizeLanguage(code))
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// NormalizeLanguage makes language codes comparable, e.g., " ET" becomes "et".
+func NormalizeLanguage(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+func (item *Say) translationFiles() []string {
+	if item == nil {
+		return nil
+	}
+	paths := []string{}
+	for _, t := range item.Translations {
+		if t != nil && t.FilePath != "" {
+			paths = append(paths, t.FilePath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,61 @@
+package instruction
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Stop implements Instruction. It cancels the current animation and speech on the robot, clears the tablet
+// and optionally returns the robot to the neutral posture.
+type Stop struct {
+	ID           uuid.UUID
+	Name         string
+	Group        string
+	Delay        int64 // in seconds
+	ResetPosture bool
+}
+
+func (item *Stop) Command() Command {
+	return StopCommand
+}
+
+func (item *Stop) Content() (b []byte, err error) {
+	if item.IsNil() {
+		return b, fmt.Errorf("nil item")
+	}
+
+	return json.Marshal(map[string]bool{"reset_posture": item.ResetPosture})
+}
+
+func (item *Stop) DelayMillis() int64 {
+	if item == nil {
+		return 0
+	}
+	return item.Delay * 1000
+}
+
+func (item *Stop) IsValid() bool {
+	// nil action is valid, because an action can contain empty SayItem,
+	// ImageItem but non-nil StopItem, for example
+	if item == nil {
+		return true
+	}
+
+	if _, err := uuid.Parse(item.ID.String()); err != nil {
+		return false
+	}
+	return true
+}
+
+func (item *Stop) IsNil() bool {
+	return item == nil
+}
+
+func (item *Stop) GetName() string {
+	if item.Name == "" {
+		return "Stop"
+	}
+	return item.Name
+}
@@ -0,0 +1,226 @@
+package instruction
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Modes of picking a variant.
+const (
+	VariantsRandom     = "random"      // weighted random choice
+	VariantsRoundRobin = "round_robin" // every variant is picked once in a random order before any is repeated
+)
+
+// Variants holds a pool of actions, one of them is picked each time the containing action is sent,
+// so the robot doesn't repeat itself. It's never sent over a web socket on itself.
+type Variants struct {
+	ID      uuid.UUID
+	Name    string
+	Group   string
+	Mode    string
+	Entries []*Variant
+}
+
+// Variant is a single entry of the pool. Weight is used only in the random mode, zero weight means 1.
+type Variant struct {
+	Weight float64
+	Action *Action
+}
+
+var (
+	random   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomMu sync.Mutex // rand.Rand isn't safe for concurrent use
+)
+
+// Pick returns one of the entries according to the mode. Round-robin cycles are kept in cycles, so the state
+// survives decoding of the session, e.g., after an edit. A nil cycles picks a random entry in this mode.
+func (v *Variants) Pick(cycles *Cycles) *Action {
+	if v == nil || len(v.Entries) == 0 {
+		return nil
+	}
+
+	var i int
+	switch v.Mode {
+	case VariantsRoundRobin:
+		i = cycles.next(v.ID, len(v.Entries))
+	default:
+		i = v.weightedIndex()
+	}
+	return v.Entries[i].Action
+}
+
+// Cycles keeps round-robin cycles of pools of variants by pool IDs, usually for a single run of a session.
+type Cycles struct {
+	mu     sync.Mutex
+	cycles map[uuid.UUID]*cycle
+}
+
+type cycle struct {
+	size int   // number of entries the bag has been filled for
+	bag  []int // indices of entries left in the current cycle
+	last int   // index of the last picked entry, -1 if nothing has been picked yet
+}
+
+func NewCycles() *Cycles {
+	return &Cycles{cycles: map[uuid.UUID]*cycle{}}
+}
+
+// next returns the next index of the pool with n entries.
+func (c *Cycles) next(poolID uuid.UUID, n int) int {
+	if c == nil {
+		randomMu.Lock()
+		defer randomMu.Unlock()
+		return random.Intn(n)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cy, ok := c.cycles[poolID]
+	if !ok {
+		cy = &cycle{last: -1}
+		c.cycles[poolID] = cy
+	}
+	if cy.size != n { // entries have been changed since the bag was filled
+		cy.size = n
+		cy.bag = nil
+	}
+	if len(cy.bag) == 0 {
+		randomMu.Lock()
+		cy.bag = random.Perm(n)
+		randomMu.Unlock()
+		// the first pick of a new cycle shouldn't repeat the last pick of the previous one
+		if len(cy.bag) > 1 && cy.bag[0] == cy.last {
+			cy.bag[0], cy.bag[1] = cy.bag[1], cy.bag[0]
+		}
+	}
+	i := cy.bag[0]
+	cy.bag = cy.bag[1:]
+	cy.last = i
+	return i
+}
+
+func (v *Variants) weightedIndex() int {
+	var total float64
+	for _, e := range v.Entries {
+		total += e.weight()
+	}
+	randomMu.Lock()
+	r := random.Float64() * total
+	randomMu.Unlock()
+	for i, e := range v.Entries {
+		r -= e.weight()
+		if r < 0 {
+			return i
+		}
+	}
+	return len(v.Entries) - 1
+}
+
+func (e *Variant) weight() float64 {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+func (v *Variants) UnmarshalJSON(b []byte) error {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	v.ID = uuid.UUID{}
+	if id, ok := m["ID"].(string); ok && len(id) > 0 {
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			return err
+		}
+		v.ID = uid
+	}
+	v.Name, _ = m["Name"].(string)
+	v.Group, _ = m["Group"].(string)
+	v.Mode, _ = m["Mode"].(string)
+	if v.Mode == "" {
+		v.Mode = VariantsRandom
+	}
+
+	entries, _ := m["Entries"].([]interface{})
+	v.Entries = []*Variant{}
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("variant must be an object, got %v", e)
+		}
+		weight, _ := entry["Weight"].(float64)
+
+		b, err := json.Marshal(entry["Action"])
+		if err != nil {
+			return err
+		}
+		action := &Action{}
+		if err = json.Unmarshal(b, action); err != nil {
+			return err
+		}
+
+		v.Entries = append(v.Entries, &Variant{Weight: weight, Action: action})
+	}
+
+	return nil
+}
+
+func (v *Variants) IsValid() bool {
+	// nil action is valid, because an action can contain empty SayItem,
+	// ImageItem but non-nil VariantsItem, for example
+	if v == nil {
+		return true
+	}
+
+	if _, err := uuid.Parse(v.ID.String()); err != nil {
+		return false
+	}
+	if v.Mode != "" && v.Mode != VariantsRandom && v.Mode != VariantsRoundRobin {
+		return false
+	}
+	if len(v.Entries) == 0 {
+		return false
+	}
+	for _, e := range v.Entries {
+		if e == nil || e.Weight < 0 || e.Action.IsNil() || !e.Action.IsValid() {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *Variants) IsNil() bool {
+	return v == nil
+}
+
+func (v *Variants) GetName() string {
+	return v.Name
+}
+
+// InitiateItemsIDs sets IDs of the pool and its entries if they are missing.
+func (v *Variants) InitiateItemsIDs() {
+	if v == nil {
+		return
+	}
+	if (v.ID == uuid.UUID{}) {
+		v.ID = uuid.Must(uuid.NewRandom())
+	}
+	for _, e := range v.Entries {
+		if e == nil || e.Action == nil {
+			continue
+		}
+		if (e.Action.ID == uuid.UUID{}) {
+			e.Action.ID = uuid.Must(uuid.NewRandom())
+		}
+		e.Action.InitiateItemsIDs()
+	}
+}
@@ -0,0 +1,51 @@
+package instruction
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCycles_SurviveDecoding(t *testing.T) {
+	pool := []byte(`{
+		"ID": "0c5e8a3e-5b43-4c8c-9a3a-2f7c1b0f6d11",
+		"Mode": "round_robin",
+		"Entries": [
+			{"Action": {"ID": "11111111-1111-1111-1111-111111111111", "SayItem": {"Phrase": "a"}}},
+			{"Action": {"ID": "22222222-2222-2222-2222-222222222222", "SayItem": {"Phrase": "b"}}},
+			{"Action": {"ID": "33333333-3333-3333-3333-333333333333", "SayItem": {"Phrase": "c"}}}
+		]
+	}`)
+
+	cycles := NewCycles()
+	for round := 0; round < 5; round++ {
+		seen := map[string]bool{}
+		for i := 0; i < 3; i++ {
+			// a fresh copy each time like after an edit of the session
+			v := &Variants{}
+			if err := json.Unmarshal(pool, v); err != nil {
+				t.Fatal(err)
+			}
+			picked := v.Pick(cycles)
+			if seen[picked.SayItem.Phrase] {
+				t.Fatalf("round %d: %q is repeated within a cycle", round, picked.SayItem.Phrase)
+			}
+			seen[picked.SayItem.Phrase] = true
+		}
+	}
+}
+
+func TestCycles_NoRepeatBetweenCycles(t *testing.T) {
+	v := &Variants{Mode: VariantsRoundRobin, Entries: []*Variant{
+		{Action: &Action{Name: "a"}},
+		{Action: &Action{Name: "b"}},
+	}}
+	cycles := NewCycles()
+	last := ""
+	for i := 0; i < 50; i++ {
+		picked := v.Pick(cycles)
+		if picked.Name == last {
+			t.Fatalf("pick %d repeats %q", i, last)
+		}
+		last = picked.Name
+	}
+}
@@ -0,0 +1,32 @@
+// Package testdir prepares working directories for tests, because sessions refer to files relative to it.
+package testdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// WithUploads runs the test in a temporary working directory with the uploads directory, which has the files.
+// Every file contains its name.
+func WithUploads(t *testing.T, uploadsDir string, names ...string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err = os.MkdirAll(filepath.Join(dir, uploadsDir), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err = ioutil.WriteFile(filepath.Join(dir, uploadsDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
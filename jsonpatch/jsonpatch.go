@@ -0,0 +1,289 @@
+// Package jsonpatch applies JSON Patch documents (RFC 6902) to JSON documents.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operation is a single operation of a patch.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is a sequence of operations which are applied one after another.
+type Patch []*Operation
+
+// Decode parses a patch from its JSON representation.
+func Decode(b []byte) (Patch, error) {
+	var p Patch
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("can't decode the patch: %v", err)
+	}
+	return p, nil
+}
+
+// Apply applies the patch to the document and returns the patched document. The patch is applied atomically:
+// if any operation fails, an error is returned and the document isn't changed.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("can't decode the document: %v", err)
+	}
+
+	for i, op := range p {
+		if op == nil {
+			return nil, fmt.Errorf("operation %d is empty", i)
+		}
+		var err error
+		if root, err = op.apply(root); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func (op *Operation) apply(root interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, value)
+	case "remove":
+		root, _, err := remove(root, op.Path)
+		return root, err
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if op.Path == "" { // the whole document
+			return value, nil
+		}
+		root, _, err = remove(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, value)
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("can't move a value into its own child")
+		}
+		root, value, err := remove(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, value)
+	case "copy":
+		value, err := get(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, deepCopy(value))
+	case "test":
+		expected, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+func (op *Operation) value() (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, fmt.Errorf("value is missing")
+	}
+	var v interface{}
+	if err := json.Unmarshal(op.Value, &v); err != nil {
+		return nil, fmt.Errorf("can't decode the value: %v", err)
+	}
+	return v, nil
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(root interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for _, t := range tokens {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			child, ok := v[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", t)
+			}
+			node = child
+		case []interface{}:
+			i, err := index(t, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			node = v[i]
+		default:
+			return nil, fmt.Errorf("can't reference %q in a scalar value", t)
+		}
+	}
+	return node, nil
+}
+
+// add inserts the value at the pointer, arrays are changed in place of their parents, so the updated root
+// is returned.
+func add(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentPointer, last := split(pointer, tokens)
+	parent, err := get(root, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		v[last] = value
+		return root, nil
+	case []interface{}:
+		i, err := index(last, len(v), true)
+		if err != nil {
+			return nil, err
+		}
+		updated := append(v[:i:i], append([]interface{}{value}, v[i:]...)...)
+		return replaceAt(root, parentPointer, updated)
+	}
+	return nil, fmt.Errorf("can't add %q to a scalar value", last)
+}
+
+// remove deletes the value at the pointer and returns the updated root and the removed value.
+func remove(root interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("can't remove the whole document")
+	}
+	parentPointer, last := split(pointer, tokens)
+	parent, err := get(root, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		removed, ok := v[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", last)
+		}
+		delete(v, last)
+		return root, removed, nil
+	case []interface{}:
+		i, err := index(last, len(v), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := v[i]
+		updated := append(v[:i:i], v[i+1:]...)
+		root, err = replaceAt(root, parentPointer, updated)
+		return root, removed, err
+	}
+	return nil, nil, fmt.Errorf("can't remove %q from a scalar value", last)
+}
+
+// replaceAt sets the value at the pointer which must exist.
+func replaceAt(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentPointer, last := split(pointer, tokens)
+	parent, err := get(root, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		v[last] = value
+	case []interface{}:
+		i, err := index(last, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = value
+	}
+	return root, nil
+}
+
+// split returns the pointer to the parent and the last reference token.
+func split(pointer string, tokens []string) (string, string) {
+	return pointer[:strings.LastIndex(pointer, "/")], tokens[len(tokens)-1]
+}
+
+// index parses an array index, "-" refers to the end of the array when appending is allowed.
+func index(token string, length int, appending bool) (int, error) {
+	if token == "-" && appending {
+		return length, nil
+	}
+	// only digits without leading zeros are allowed, e.g., not +1, -0 or 01
+	if token == "" || strings.Trim(token, "0123456789") != "" || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if appending {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d is out of bounds", i)
+	}
+	return i, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	b, _ := json.Marshal(v)
+	var c interface{}
+	_ = json.Unmarshal(b, &c)
+	return c
+}
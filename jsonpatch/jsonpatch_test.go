@@ -0,0 +1,126 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPatch_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, false},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`, false},
+		{"add into array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, false},
+		{"add to the end of array", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, false},
+		{"add at array length", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`, false},
+		{"add out of bounds", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, ``, true},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, ``, true},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`, false},
+		{"add without value", `{}`, `[{"op":"add","path":"/a"}]`, ``, true},
+		{"add null value", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, false},
+
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, false},
+		{"remove array element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, false},
+		{"remove missing member", `{}`, `[{"op":"remove","path":"/a"}]`, ``, true},
+		{"remove with -", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, ``, true},
+		{"remove whole document", `{"a":1}`, `[{"op":"remove","path":""}]`, ``, true},
+
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":[2]}]`, `{"a":[2]}`, false},
+		{"replace array element", `[1,2]`, `[{"op":"replace","path":"/0","value":3}]`, `[3,2]`, false},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, ``, true},
+		{"replace whole document", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`, false},
+
+		{"move member", `{"a":1,"b":{}}`, `[{"op":"move","from":"/a","path":"/b/c"}]`, `{"b":{"c":1}}`, false},
+		{"move in array", `[1,2,3]`, `[{"op":"move","from":"/0","path":"/-"}]`, `[2,3,1]`, false},
+		{"move into own child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ``, true},
+		{"move missing", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`, ``, true},
+
+		{"copy member", `{"a":{"x":1}}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":{"x":1},"b":{"x":1}}`, false},
+		{"copy is deep", `{"a":{"x":1}}`, `[{"op":"copy","from":"/a","path":"/b"},{"op":"replace","path":"/b/x","value":2}]`, `{"a":{"x":1},"b":{"x":2}}`, false},
+		{"copy missing", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`, ``, true},
+
+		{"test equal", `{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"c"}]}]`, `{"a":[1,{"b":"c"}]}`, false},
+		{"test number", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`, false},
+		{"test not equal", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, ``, true},
+		{"test missing", `{}`, `[{"op":"test","path":"/a","value":null}]`, ``, true},
+
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`, false},
+		{"escaped tilde", `{"a~b":1}`, `[{"op":"remove","path":"/a~0b"}]`, `{}`, false},
+		{"escapes are decoded in order", `{"~1":1}`, `[{"op":"test","path":"/~01","value":1}]`, `{"~1":1}`, false},
+		{"empty member name", `{"":1}`, `[{"op":"replace","path":"/","value":2}]`, `{"":2}`, false},
+		{"pointer without slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`, ``, true},
+
+		{"leading zero index", `[1,2]`, `[{"op":"remove","path":"/01"}]`, ``, true},
+		{"signed index", `[1,2]`, `[{"op":"remove","path":"/+1"}]`, ``, true},
+		{"negative zero index", `[1,2]`, `[{"op":"remove","path":"/-0"}]`, ``, true},
+		{"zero index", `[1,2]`, `[{"op":"remove","path":"/0"}]`, `[2]`, false},
+
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a","value":1}]`, ``, true},
+		{"operations are sequential", `{}`, `[{"op":"add","path":"/a","value":[]},{"op":"add","path":"/a/-","value":1}]`, `{"a":[1]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Decode([]byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Apply([]byte(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestPatch_ApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"a":[1,2],"b":{"c":1}}`)
+	original := string(doc)
+	p, err := Decode([]byte(`[
+		{"op":"remove","path":"/a/0"},
+		{"op":"replace","path":"/b/c","value":2},
+		{"op":"test","path":"/b/c","value":3}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Apply(doc)
+	if err == nil {
+		t.Fatal("want the failed test operation to fail the patch")
+	}
+	if got != nil {
+		t.Fatalf("a failed patch returned a document: %s", got)
+	}
+	if string(doc) != original {
+		t.Fatalf("the document has been changed: %s", doc)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	if _, err := Decode([]byte(`{"op":"add"}`)); err == nil {
+		t.Fatal("want an error for a patch which isn't an array")
+	}
+}
+
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
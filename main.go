@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,8 +14,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -21,7 +25,13 @@ import (
 
 	"github.com/iharsuvorau/garlic/eki"
 	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/jsonpatch"
+	"github.com/iharsuvorau/garlic/qianim"
+	"github.com/iharsuvorau/garlic/runner"
+	"github.com/iharsuvorau/garlic/script"
+	"github.com/iharsuvorau/garlic/spreadsheet"
 	"github.com/iharsuvorau/garlic/store"
+	"github.com/iharsuvorau/garlic/synthesis"
 )
 
 // TODO: communicate over WSS
@@ -44,17 +54,40 @@ var (
 
 	fileStore     *store.Files
 	sessionsStore *store.Sessions
+	revisions     *store.Revisions
 	moveStore     *store.Moves
 	audioStore    *store.Audio
 	actionsStore  *store.Actions
-
-	pepperStatus uint8 // 0 -- disconnected, 1 -- connected
+	sessionRunner *runner.Runner
+	runsStore     *store.Runs
+	commandLog    *store.CommandLog
+	notesStore    *store.Notes
+	participants  *store.Participants
+	synthesisJobs *synthesis.Jobs
+
+	pepperStatus uint8  // 0 -- disconnected, 1 -- connected
+	pepperAddr   string // address of the connected robot for the command log
+
+	// robotMoves are names of built-in moves of the connected robot, nil until the robot reports them
+	robotMoves   []string
+	robotMovesMu sync.RWMutex
+
+	// variantCycles are round-robin cycles of variants by run IDs, the zero ID is for commands outside runs
+	variantCycles   = map[uuid.UUID]*instruction.Cycles{}
+	variantCyclesMu sync.Mutex
 )
 
+// maxMoveSize limits the size of an uploaded .qianim file in bytes.
+const maxMoveSize = 10 << 20
+
+// csvMappingPath keeps the mapping of CSV columns to session items for importing spreadsheets.
+const csvMappingPath = "data/csv_mapping.json"
+
 // CLI arguments
 var (
 	servingAddr = flag.String("addr", "0.0.0.0:8080", "http service address")
 	motionsDir  = flag.String("moves", "data/pepper-core-anims-master", "path to the folder with moves")
+	trashPeriod = flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted sessions can be recovered, 0 keeps them forever")
 	// TODO: data dir flag instead of motionsDir
 )
 
@@ -72,10 +105,20 @@ func main() {
 
 	// creating new stores or loading ones which exist
 	fileStore = store.NewFileStore("data/uploads")
-	sessionsStore, err = store.NewSessionStore("data/sessions.json")
+	revisions, err = store.NewRevisionsStore("data/revisions")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sessionsStore, err = store.NewSessionStore("data/sessions.json", revisions)
 	if err != nil {
 		log.Fatal(err)
 	}
+	sessionsStore.TrashRetention = *trashPeriod
+	if n, err := sessionsStore.PurgeExpired(); err != nil {
+		log.Printf("failed to purge the sessions trash: %v", err)
+	} else if n > 0 {
+		log.Printf("%v deleted sessions have been purged", n)
+	}
 	moveStore, err = store.NewMoveStore("data/moves.json", *motionsDir)
 	if err != nil {
 		log.Fatal(err)
@@ -89,6 +132,29 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	runsStore, err = store.NewRunsStore("data/runs.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	commandLog, err = store.NewCommandLog("data/commands.jsonl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	notesStore, err = store.NewNotesStore("data/notes.json", "data/note_tags.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	participants, err = store.NewParticipantsStore("data/participants.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	reportIntegrity()
+	synthesisJobs = synthesis.New(sessionsStore, fileStore, synthesis.EKI)
+
+	sessionRunner, err = runner.New("data/runner.json", sessionsStore, sendSessionAction)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	engine := newEngine()
 	log.Fatal(engine.Run(*servingAddr))
@@ -108,6 +174,8 @@ func newEngine() *gin.Engine {
 	r.GET("/api/pepper/status", pepperStatusJSONHandler)
 	r.POST("/api/pepper/send_command", sendCommandHandler)
 	r.OPTIONS("/api/pepper/send_command", emptyResponseOK)
+	r.POST("/api/pepper/stop", stopHandler)
+	r.OPTIONS("/api/pepper/stop", emptyResponseOK)
 
 	// sessions management
 	r.GET("/api/sessions/", sessionsJSONHandler)
@@ -115,14 +183,99 @@ func newEngine() *gin.Engine {
 	r.OPTIONS("/api/sessions/", emptyResponseOK)
 	r.GET("/api/sessions/:id", getSessionJSONHandler)
 	r.PUT("/api/sessions/:id", updateSessionJSONHandler)
+	r.PATCH("/api/sessions/:id", patchSessionJSONHandler)
 	r.DELETE("/api/sessions/:id", deleteSessionJSONHandler)
 	r.OPTIONS("/api/sessions/:id", emptyResponseOK)
+	r.GET("/api/session_graph/:id", getSessionGraphJSONHandler)
+	r.GET("/api/session_durations/:id", getSessionDurationsJSONHandler)
+	r.GET("/api/session_revisions/:id", sessionRevisionsJSONHandler)
+	r.GET("/api/session_diff/:id", sessionDiffJSONHandler)
+	r.POST("/api/session_restore/:id", restoreSessionJSONHandler)
+	r.OPTIONS("/api/session_restore/:id", emptyResponseOK)
+	r.GET("/api/session_trash/", sessionTrashJSONHandler)
+	r.DELETE("/api/session_trash/:id", purgeSessionJSONHandler)
+	r.OPTIONS("/api/session_trash/:id", emptyResponseOK)
+	r.POST("/api/session_undelete/:id", undeleteSessionJSONHandler)
+	r.POST("/api/session_clone/:id", cloneSessionJSONHandler)
+	r.OPTIONS("/api/session_clone/:id", emptyResponseOK)
+	r.OPTIONS("/api/session_undelete/:id", emptyResponseOK)
+	r.POST("/api/session_items/", addSessionItemJSONHandler)
+	r.OPTIONS("/api/session_items/", emptyResponseOK)
 	r.GET("/api/session_items/:id", getSessionItemJSONHandler)
+	r.PUT("/api/session_items/:id", updateSessionItemJSONHandler)
+	r.DELETE("/api/session_items/:id", deleteSessionItemJSONHandler)
 	r.OPTIONS("/api/session_items/:id", emptyResponseOK)
+	r.POST("/api/session_item_move/:id", moveSessionItemJSONHandler)
+	r.OPTIONS("/api/session_item_move/:id", emptyResponseOK)
+	r.POST("/api/session_actions/", addSessionActionJSONHandler)
+	r.OPTIONS("/api/session_actions/", emptyResponseOK)
+	r.PUT("/api/session_actions/:id", updateSessionActionJSONHandler)
+	r.DELETE("/api/session_actions/:id", deleteSessionActionJSONHandler)
+	r.OPTIONS("/api/session_actions/:id", emptyResponseOK)
+	r.POST("/api/session_action_move/:id", moveSessionActionJSONHandler)
+	r.OPTIONS("/api/session_action_move/:id", emptyResponseOK)
 	r.GET("/api/session_export/:id", exportSessionJSONHandler)
 	r.OPTIONS("/api/session_export/:id", emptyResponseOK)
 	r.POST("/api/session_import", importSessionHandler)
 	r.OPTIONS("/api/session_import", emptyResponseOK)
+	r.GET("/api/session_script/:id", exportSessionScriptHandler)
+	r.GET("/api/session_print/:id", printSessionHandler)
+	r.POST("/api/session_script/", importSessionScriptJSONHandler)
+	r.OPTIONS("/api/session_script/", emptyResponseOK)
+	r.POST("/api/session_csv_import", importSessionCSVHandler)
+	r.OPTIONS("/api/session_csv_import", emptyResponseOK)
+	r.GET("/api/csv_mapping/", csvMappingJSONHandler)
+	r.PUT("/api/csv_mapping/", updateCSVMappingJSONHandler)
+	r.OPTIONS("/api/csv_mapping/", emptyResponseOK)
+
+	// running sessions on the server side
+	r.GET("/api/runner/status", runnerStatusJSONHandler)
+	r.POST("/api/runner/start", runnerStartJSONHandler)
+	r.OPTIONS("/api/runner/start", emptyResponseOK)
+	r.POST("/api/runner/pause", runnerControlJSONHandler(sessionRunner.Pause))
+	r.OPTIONS("/api/runner/pause", emptyResponseOK)
+	r.POST("/api/runner/resume", runnerControlJSONHandler(sessionRunner.Resume))
+	r.OPTIONS("/api/runner/resume", emptyResponseOK)
+	r.POST("/api/runner/skip", runnerControlJSONHandler(sessionRunner.Skip))
+	r.OPTIONS("/api/runner/skip", emptyResponseOK)
+	r.POST("/api/runner/back", runnerControlJSONHandler(sessionRunner.Back))
+	r.OPTIONS("/api/runner/back", emptyResponseOK)
+	r.POST("/api/runner/ack", runnerControlJSONHandler(sessionRunner.Ack))
+	r.OPTIONS("/api/runner/ack", emptyResponseOK)
+	r.POST("/api/runner/stop", runnerStopJSONHandler)
+	r.OPTIONS("/api/runner/stop", emptyResponseOK)
+	r.POST("/api/runner/jump", runnerJumpJSONHandler)
+	r.OPTIONS("/api/runner/jump", emptyResponseOK)
+	r.POST("/api/runner/choose", runnerChooseJSONHandler)
+	r.OPTIONS("/api/runner/choose", emptyResponseOK)
+
+	// runs of sessions and the command log
+	r.GET("/api/runs/", runsJSONHandler)
+	r.POST("/api/runs/", createRunJSONHandler)
+	r.OPTIONS("/api/runs/", emptyResponseOK)
+	r.GET("/api/runs/:id", getRunJSONHandler)
+	r.OPTIONS("/api/runs/:id", emptyResponseOK)
+	r.POST("/api/run_finish/:id", finishRunJSONHandler)
+	r.OPTIONS("/api/run_finish/:id", emptyResponseOK)
+	r.GET("/api/run_export/:id", exportRunHandler)
+	r.GET("/api/notes/", notesJSONHandler)
+	r.POST("/api/notes/", createNoteJSONHandler)
+	r.OPTIONS("/api/notes/", emptyResponseOK)
+	r.DELETE("/api/notes/:id", deleteNoteJSONHandler)
+	r.OPTIONS("/api/notes/:id", emptyResponseOK)
+	r.GET("/api/note_tags/", noteTagsJSONHandler)
+	r.PUT("/api/note_tags/", updateNoteTagsJSONHandler)
+	r.OPTIONS("/api/note_tags/", emptyResponseOK)
+
+	// participants
+	r.GET("/api/participants/", participantsJSONHandler)
+	r.POST("/api/participants/", createParticipantJSONHandler)
+	r.OPTIONS("/api/participants/", emptyResponseOK)
+	r.GET("/api/participants/:id", getParticipantJSONHandler)
+	r.PUT("/api/participants/:id", updateParticipantJSONHandler)
+	r.DELETE("/api/participants/:id", deleteParticipantJSONHandler)
+	r.OPTIONS("/api/participants/:id", emptyResponseOK)
+	r.GET("/api/participant_history/:id", participantHistoryJSONHandler)
 
 	// ?
 	r.GET("/api/instruction/:id", getInstructionJSONHandler)
@@ -144,6 +297,11 @@ func newEngine() *gin.Engine {
 	r.GET("/api/moves/:id", getMoveJSONHandler)
 	r.DELETE("/api/moves/:id", deleteMoveJSONHandler)
 	r.OPTIONS("/api/moves/:id", emptyResponseOK)
+	r.GET("/api/move_preview/:id", getMovePreviewJSONHandler)
+	r.POST("/api/move_mirror/:id", mirrorMoveJSONHandler)
+	r.OPTIONS("/api/move_mirror/:id", emptyResponseOK)
+	r.POST("/api/move_scale/:id", scaleMoveJSONHandler)
+	r.OPTIONS("/api/move_scale/:id", emptyResponseOK)
 
 	// serving audioStore
 	r.GET("/api/audio/", audioJSONHandler)
@@ -162,11 +320,18 @@ func newEngine() *gin.Engine {
 
 	// utilities: helpful endpoints for the client application or other
 	r.GET("/api/move_groups/", moveGroupsJSONHandler)
+	r.GET("/api/integrity_check", integrityCheckJSONHandler)
+	r.POST("/api/integrity_fix", integrityFixJSONHandler)
+	r.OPTIONS("/api/integrity_fix", emptyResponseOK)
 	r.GET("/api/server_ip", getServerIPJSONHandler)
 
 	// speech synthesizer proxy to avoid CORS problem
 	r.POST("/api/synthesize", speechSynthJSONHandler)
 	r.OPTIONS("/api/synthesize", emptyResponseOK)
+	r.POST("/api/session_synthesize/:id", synthesizeSessionJSONHandler)
+	r.OPTIONS("/api/session_synthesize/:id", emptyResponseOK)
+	r.GET("/api/synthesis_jobs/", synthesisJobsJSONHandler)
+	r.GET("/api/synthesis_jobs/:id", getSynthesisJobJSONHandler)
 
 	// main fallback: nothing to serve here at the moment, but could be a place for API documentation
 	r.GET("/", emptyResponseOK)
@@ -178,8 +343,9 @@ func newEngine() *gin.Engine {
 
 func allowCORS(c *gin.Context) {
 	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
-	c.Writer.Header().Add("Access-Control-Allow-Methods", "GET, PUT, POST, DELETE, OPTIONS")
-	c.Writer.Header().Add("Access-Control-Allow-Headers", "Content-Type")
+	c.Writer.Header().Add("Access-Control-Allow-Methods", "GET, PUT, PATCH, POST, DELETE, OPTIONS")
+	c.Writer.Header().Add("Access-Control-Allow-Headers", "Content-Type, If-Match")
+	c.Writer.Header().Add("Access-Control-Expose-Headers", "ETag")
 }
 
 func logRequest(c *gin.Context) {
@@ -216,7 +382,9 @@ func pepperStatusJSONHandler(c *gin.Context) {
 
 func sendCommandHandler(c *gin.Context) {
 	form := struct {
-		ItemID uuid.UUID `json:"item_id" binding:"required"`
+		ItemID   uuid.UUID `json:"item_id" binding:"required"`
+		RunID    uuid.UUID `json:"run_id"`   // the active run of the session is used if it's empty
+		Operator string    `json:"operator"` // optional, it's written to the command log
 	}{}
 	err := c.BindJSON(&form)
 	if err != nil {
@@ -265,12 +433,54 @@ func sendCommandHandler(c *gin.Context) {
 		})
 		return
 	}
-	if err = instruction.SendInstruction(action, wsConnection, &wsMu); err != nil {
+
+	meta := commandMeta{RunID: form.RunID, Operator: form.Operator}
+	if a, ok := action.(*instruction.Action); ok {
+		meta.ActionID = a.ID
+		if session, item, err := sessionsStore.Locate(a.ID); err == nil {
+			meta.SessionID = session.ID
+			meta.ItemID = item.ID
+			if run, err := runsStore.Active(session.ID); err == nil && (meta.RunID == uuid.UUID{}) {
+				meta.RunID = run.ID
+			}
+		}
+	}
+
+	// an action with variants is replaced by one of its variants, the client app needs to know which one
+	// was picked to play the right audio
+	sent, err := sendInstruction(action, meta)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "the command has been sent"})
+	c.JSON(http.StatusOK, gin.H{"message": "the command has been sent", "data": sent})
+}
+
+// stopHandler interrupts the robot: it cancels the current animation and speech and clears the tablet.
+// The client app should stop playing audio on its side too.
+func stopHandler(c *gin.Context) {
+	form := struct {
+		ResetPosture bool `json:"reset_posture"`
+	}{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&form); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"method": "stopHandler", "error": err.Error()})
+			return
+		}
+	}
+
+	stop := &instruction.Stop{
+		ID:           uuid.Must(uuid.NewRandom()),
+		ResetPosture: form.ResetPosture,
+	}
+	meta := commandMeta{RunID: sessionRunner.Status().RunID}
+	if _, err := sendInstruction(stop, meta); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"method": "stopHandler", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "the stop command has been sent"})
 }
 
 func initiateHandler(c *gin.Context) {
@@ -291,6 +501,7 @@ func initiateHandler(c *gin.Context) {
 	defer wsConnection.Close()
 
 	pepperStatus = 1
+	pepperAddr = c.Request.RemoteAddr
 	log.Printf("websocket connection has been established with %s", c.Request.RemoteAddr)
 
 	wsConnection.SetCloseHandler(func(code int, text string) error {
@@ -309,265 +520,1059 @@ func initiateHandler(c *gin.Context) {
 		if len(m.Moves) > 0 {
 			remoteMoves := makeMoveActionsFromNames(m.Moves, "Remote")
 			moveStore.AddMany(remoteMoves)
+
+			robotMovesMu.Lock()
+			robotMoves = m.Moves
+			robotMovesMu.Unlock()
 		}
 	}
 }
 
-func sessionsJSONHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"data": sessionsStore.Sessions,
-	})
+func runnerStatusJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": sessionRunner.Status()})
 }
 
-func updateSessionJSONHandler(c *gin.Context) {
-	var updatedSession store.Session
-	err := c.BindJSON(&updatedSession)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+func runnerStartJSONHandler(c *gin.Context) {
+	form := struct {
+		SessionID     string    `json:"session_id" binding:"required"`
+		ParticipantID uuid.UUID `json:"participant_id"` // optional
+		Gap           int64     `json:"gap"`            // in seconds
+		WaitAck       bool      `json:"wait_ack"`
+		Operator      string    `json:"operator"`
+		Languages     []string  `json:"languages"` // preference order, the participant's language by default
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err = sessionsStore.Update(&updatedSession)
+	session, err := sessionsStore.Get(form.SessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err = checkParticipant(form.ParticipantID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err = finishRunnerRun(); err != nil {
+		log.Printf("runnerStartJSONHandler: %v", err)
+	}
+	run, err := runsStore.Start(session, form.ParticipantID, form.Operator, runLanguages(form.Languages, form.ParticipantID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "session has been saved successfully",
-	})
+	if err := sessionRunner.Start(form.SessionID, run.ID, form.Gap, form.WaitAck); err != nil {
+		// the run is kept when the runner has started it but paused on failure, e.g., the robot is disconnected
+		if sessionRunner.Status().RunID != run.ID {
+			if e := runsStore.Finish(run.ID); e != nil {
+				log.Printf("runnerStartJSONHandler: %v", e)
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "data": sessionRunner.Status()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session run has been started", "data": sessionRunner.Status()})
 }
 
-func getSessionJSONHandler(c *gin.Context) {
-	id := c.Param("id")
-	session, err := sessionsStore.Get(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": err.Error(),
-		})
-		return
+// runnerControlJSONHandler wraps a runner's control operation like pause or skip into a handler.
+func runnerControlJSONHandler(operation func() error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := operation(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "data": sessionRunner.Status()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": sessionRunner.Status()})
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": session,
-	})
+func runnerStopJSONHandler(c *gin.Context) {
+	if err := finishRunnerRun(); err != nil {
+		log.Printf("runnerStopJSONHandler: %v", err)
+	}
+	runnerControlJSONHandler(sessionRunner.Stop)(c)
 }
 
-func importSessionHandler(c *gin.Context) {
-	var overwrite bool
-	if s := c.Request.FormValue("overwrite"); s == "true" {
-		overwrite = true
+// finishRunnerRun marks the run of the session runner as finished if there is one.
+func finishRunnerRun() error {
+	runID := sessionRunner.Status().RunID
+	if (runID == uuid.UUID{}) {
+		return nil
 	}
+	forgetCycles(runID)
+	return runsStore.Finish(runID)
+}
 
-	inFile, fh, err := c.Request.FormFile("file_content")
-	if err != nil {
-		log.Printf("importSessionHandler: %v", err)
+func runnerJumpJSONHandler(c *gin.Context) {
+	form := struct {
+		Position *int      `json:"position"`
+		ItemID   uuid.UUID `json:"item_id"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer inFile.Close()
 
-	// uploading archive to ./tmp
-	dst := path.Join("tmp", fh.Filename)
-	err = os.MkdirAll("tmp", 0777)
-	if err != nil {
-		log.Printf("importSessionHandler: failed to create ./tmp: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	var err error
+	switch {
+	case form.Position != nil:
+		err = sessionRunner.JumpTo(*form.Position)
+	case form.ItemID != uuid.UUID{}:
+		err = sessionRunner.JumpToItem(form.ItemID)
+	default:
+		err = fmt.Errorf("either position or item_id must be provided")
 	}
-	defer func() {
-		if err = os.RemoveAll("tmp"); err != nil {
-			log.Printf("importSessionHandler: failed to clean up after importing: %v", err)
-		}
-	}() // cleaning up at the end
-	outFile, err := os.Create(dst)
 	if err != nil {
-		log.Printf("importSessionHandler: failed to create file at %v: %v", dst, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "data": sessionRunner.Status()})
 		return
 	}
-	defer outFile.Close()
-	if _, err = io.Copy(outFile, inFile); err != nil {
-		log.Printf("importSessionHandler: failed to copy uploaded file: %v", err)
+
+	c.JSON(http.StatusOK, gin.H{"data": sessionRunner.Status()})
+}
+
+func runnerChooseJSONHandler(c *gin.Context) {
+	form := struct {
+		ActionID uuid.UUID `json:"action_id" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// initiating an import
-	if err = sessionsStore.Import(dst, overwrite, fileStore); err != nil {
-		log.Printf("importSessionHandler: failed to import the session at %s: %v", dst, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := sessionRunner.Choose(form.ActionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "data": sessionRunner.Status()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "session has been uploaded successfully",
-	})
+	c.JSON(http.StatusOK, gin.H{"data": sessionRunner.Status()})
 }
 
-func exportSessionJSONHandler(c *gin.Context) {
-	id := c.Param("id")
-	session, err := sessionsStore.Get(id)
+func runsJSONHandler(c *gin.Context) {
+	counts, err := commandLog.Counts()
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	relativePath, err := session.Export("tmp")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
-		log.Println(err)
-		return
+	type runWithCount struct {
+		*store.Run
+		Commands int
+	}
+	runs := []runWithCount{}
+	for _, run := range runsStore.Runs {
+		runs = append(runs, runWithCount{Run: run, Commands: counts[run.ID]})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "session has been exported",
-		"relative_path": relativePath,
-	})
+	c.JSON(http.StatusOK, gin.H{"data": runs})
 }
 
-func deleteSessionJSONHandler(c *gin.Context) {
-	id := c.Param("id")
+func createRunJSONHandler(c *gin.Context) {
+	form := struct {
+		SessionID     string    `json:"session_id" binding:"required"`
+		ParticipantID uuid.UUID `json:"participant_id"` // optional
+		Operator      string    `json:"operator"`
+		Languages     []string  `json:"languages"` // preference order, the participant's language by default
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	err := sessionsStore.Delete(id)
+	session, err := sessionsStore.Get(form.SessionID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": err.Error(),
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err = checkParticipant(form.ParticipantID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	run, err := runsStore.Start(session, form.ParticipantID, form.Operator, runLanguages(form.Languages, form.ParticipantID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "session has been deleted",
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "run has been started", "data": run})
 }
 
-func createSessionJSONHandler(c *gin.Context) {
-	var newSession *store.Session
-
-	err := c.ShouldBindJSON(&newSession)
+func getRunJSONHandler(c *gin.Context) {
+	run, err := runsStore.Get(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
-		log.Printf("session: %+v", newSession)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-
-	err = sessionsStore.Create(newSession)
+	entries, err := commandLog.Entries(run.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Errorf("failed to create a session: %v", err),
-		})
-		log.Print(fmt.Errorf("failed to create a session: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "session has been created successfully",
+		"data":     run,
+		"timeline": run.Timeline(entries, notesStore.ByRun(run.ID)),
 	})
 }
 
-func audioUploadJSONHandler(c *gin.Context) {
-	// NOTE: using form data instead of JSON because of file upload in this handler
-
-	f, fh, err := c.Request.FormFile("file_content")
+func finishRunJSONHandler(c *gin.Context) {
+	run, err := runsStore.Get(c.Param("id"))
 	if err != nil {
-		log.Printf("audioUploadJSONHandler: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	defer f.Close()
-
-	uid := uuid.Must(uuid.NewRandom())
-	ext := filepath.Ext(fh.Filename)
-	name := uid.String() + ext
-	dst, err := fileStore.Save(name, f)
-	if err != nil {
-		log.Printf("audioUploadJSONHandler, can't save the file %v: %v", name, err)
+	if err = runsStore.Finish(run.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	forgetCycles(run.ID)
 
-	// NOTE: we don't create an object in Audio, Audio only for commonly used audio items,
-	// session audio items should belong only to a session.
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "file has been uploaded successfully",
-		"id":       uid,
-		"filepath": dst,
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "run has been finished", "data": run})
 }
 
-func createAudioJSONHandler(c *gin.Context) {
-	f, fh, err := c.Request.FormFile("file_content")
+// exportRunHandler responds with the run's commands as a CSV or JSON lines file depending on the format parameter.
+func exportRunHandler(c *gin.Context) {
+	run, err := runsStore.Get(c.Param("id"))
 	if err != nil {
-		log.Printf("createAudioJSONHandler: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	defer f.Close()
-
-	uid := uuid.Must(uuid.NewRandom())
-	ext := filepath.Ext(fh.Filename)
-	name := uid.String() + ext
-	dst, err := fileStore.Save(name, f)
+	entries, err := commandLog.Entries(run.ID)
 	if err != nil {
-		log.Printf("createAudioJSONHandler, can't save the file %v: %v", name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	phrase := c.DefaultPostForm("phrase", "")
-	if phrase == "" {
-		phrase = strings.Replace(fh.Filename, filepath.Ext(fh.Filename), "", -1)
-	}
-	group := c.DefaultPostForm("group", "")
-	if group == "" {
-		group = "Default"
-	}
-	action := &instruction.Say{
-		ID:       uid,
-		Phrase:   phrase,
-		FilePath: dst,
-		Group:    group,
-		Delay:    0,
+
+	buf := &bytes.Buffer{}
+	format := c.DefaultQuery("format", "csv")
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv"
+		err = store.WriteCSV(buf, entries)
+	case "jsonl":
+		contentType = "application/x-ndjson"
+		err = store.WriteJSONLines(buf, entries)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown format %q, use csv or jsonl", format)})
+		return
 	}
-	if err = audioStore.Create(action); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create an audio: %v", err)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "audio has been created successfully",
-		"id":       uid,
-		"filepath": dst,
-	})
+	filename := fmt.Sprintf("run-%s.%s", run.ID, format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
 }
 
-func moveUploadJSONHandler(c *gin.Context) {
-	// NOTE: using form data instead of JSON because of file upload in this handler
-
-	f, fh, err := c.Request.FormFile("file_content")
+// notesJSONHandler returns notes of the run provided by the run_id parameter.
+func notesJSONHandler(c *gin.Context) {
+	runID, err := uuid.Parse(c.Query("run_id"))
 	if err != nil {
-		log.Printf("moveUploadJSONHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("run_id must be provided: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": notesStore.ByRun(runID)})
+}
+
+// createNoteJSONHandler adds a note to the run, when run_id isn't provided, the note is added to the run
+// of the session runner or to the latest active run.
+func createNoteJSONHandler(c *gin.Context) {
+	form := struct {
+		RunID    uuid.UUID `json:"run_id"`
+		Time     time.Time `json:"time"` // optional, the client's time of the note, now if it's missing
+		Tag      string    `json:"tag"`
+		Text     string    `json:"text"`
+		Operator string    `json:"operator"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer f.Close()
 
-	uid := uuid.Must(uuid.NewRandom())
-	ext := filepath.Ext(fh.Filename)
-	name := uid.String() + ext
-	dst, err := fileStore.Save(name, f)
-	if err != nil {
+	runID := form.RunID
+	if (runID == uuid.UUID{}) {
+		runID = sessionRunner.Status().RunID
+	}
+	if (runID == uuid.UUID{}) {
+		if run, err := runsStore.LatestActive(); err == nil {
+			runID = run.ID
+		}
+	}
+	if _, err := runsStore.GetByUUID(runID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("there is no run to add the note to: %v", err)})
+		return
+	}
+
+	note := &store.Note{
+		RunID:    runID,
+		Time:     form.Time,
+		Tag:      form.Tag,
+		Text:     form.Text,
+		Operator: form.Operator,
+	}
+	if err := notesStore.Create(note); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "note has been saved", "data": note})
+}
+
+func deleteNoteJSONHandler(c *gin.Context) {
+	if err := notesStore.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "note has been deleted"})
+}
+
+func noteTagsJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": notesStore.Tags})
+}
+
+func updateNoteTagsJSONHandler(c *gin.Context) {
+	var tags []string
+	if err := c.ShouldBindJSON(&tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := notesStore.SetTags(tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tags have been saved", "data": notesStore.Tags})
+}
+
+func participantsJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": participants.Items})
+}
+
+func getParticipantJSONHandler(c *gin.Context) {
+	p, err := participants.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": p})
+}
+
+func createParticipantJSONHandler(c *gin.Context) {
+	p := &store.Participant{}
+	if err := c.ShouldBindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.ID = uuid.UUID{}
+	if err := participants.Create(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "participant has been created", "data": p})
+}
+
+func updateParticipantJSONHandler(c *gin.Context) {
+	existing, err := participants.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	p := &store.Participant{}
+	if err = c.ShouldBindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.ID = existing.ID
+	if err = participants.Update(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "participant has been updated", "data": p})
+}
+
+func deleteParticipantJSONHandler(c *gin.Context) {
+	if err := participants.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "participant has been deleted"})
+}
+
+// participantHistoryJSONHandler responds with runs of the participant: which sessions were done and when.
+func participantHistoryJSONHandler(c *gin.Context) {
+	p, err := participants.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	counts, err := commandLog.Counts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	type historyEntry struct {
+		*store.Run
+		Commands int
+		Notes    int
+	}
+	history := []historyEntry{}
+	for _, run := range runsStore.ByParticipant(p.ID) {
+		history = append(history, historyEntry{
+			Run:      run,
+			Commands: counts[run.ID],
+			Notes:    len(notesStore.ByRun(run.ID)),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": p, "history": history})
+}
+
+func sessionsJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": sessionsStore.Sessions,
+	})
+}
+
+func updateSessionJSONHandler(c *gin.Context) {
+	var updatedSession store.Session
+	err := c.BindJSON(&updatedSession)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	expected, err := expectedRevision(c, false) // the whole session is saved by the old web UI without revisions
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if expected > 0 {
+		updatedSession.Revision = expected
+	}
+
+	err = sessionsStore.Update(&updatedSession, c.Query("author"))
+	var conflict *store.ConflictError
+	if errors.As(err, &conflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "revision": conflict.Current})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	setETag(c, &updatedSession)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "session has been saved successfully",
+		"revision": updatedSession.Revision,
+	})
+}
+
+func getSessionJSONHandler(c *gin.Context) {
+	id := c.Param("id")
+	session, err := sessionsStore.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	setETag(c, session)
+	c.JSON(http.StatusOK, gin.H{
+		"data":      session,
+		"durations": store.EstimateSession(session),
+	})
+}
+
+// getSessionDurationsJSONHandler responds with estimated lengths of the session, its items and actions in seconds
+// and flags actions whose phrase and move lengths differ a lot.
+func getSessionDurationsJSONHandler(c *gin.Context) {
+	session, err := sessionsStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": store.EstimateSession(session)})
+}
+
+func getSessionGraphJSONHandler(c *gin.Context) {
+	id := c.Param("id")
+	session, err := sessionsStore.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": session.Graph(),
+	})
+}
+
+// sessionRevisionsJSONHandler responds with the list of revisions of the session without their contents or,
+// when the number parameter is provided, with the full revision.
+func sessionRevisionsJSONHandler(c *gin.Context) {
+	session, err := sessionsStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("number") != "" {
+		number, err := strconv.Atoi(c.Query("number"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rev, err := revisions.Get(session.ID, number)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": rev})
+		return
+	}
+
+	list, err := revisions.List(session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	type revisionInfo struct {
+		Number  int
+		Author  string
+		Time    time.Time
+		Comment string
+		Items   int
+	}
+	infos := []revisionInfo{}
+	for _, rev := range list {
+		infos = append(infos, revisionInfo{
+			Number:  rev.Number,
+			Author:  rev.Author,
+			Time:    rev.Time,
+			Comment: rev.Comment,
+			Items:   len(rev.Session.Items),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": infos})
+}
+
+// sessionDiffJSONHandler compares two revisions of the session provided by the from and to parameters,
+// the current version of the session is used if to is missing.
+func sessionDiffJSONHandler(c *gin.Context) {
+	session, err := sessionsStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from must be a revision number: %v", err)})
+		return
+	}
+	a, err := revisions.Get(session.ID, from)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	b := session
+	if c.Query("to") != "" {
+		to, err := strconv.Atoi(c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to must be a revision number: %v", err)})
+			return
+		}
+		rev, err := revisions.Get(session.ID, to)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		b = rev.Session
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": store.Diff(a.Session, b)})
+}
+
+func restoreSessionJSONHandler(c *gin.Context) {
+	form := struct {
+		Number int    `json:"number" binding:"required"`
+		Author string `json:"author"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, missing, err := sessionsStore.Restore(c.Param("id"), form.Number, form.Author)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       fmt.Sprintf("session has been restored from revision %d", form.Number),
+		"data":          session,
+		"missing_files": missing,
+	})
+}
+
+func sessionTrashJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": sessionsStore.Trash, "retention": sessionsStore.TrashRetention.String()})
+}
+
+func undeleteSessionJSONHandler(c *gin.Context) {
+	session, err := sessionsStore.Undelete(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session has been recovered", "data": session})
+}
+
+func purgeSessionJSONHandler(c *gin.Context) {
+	if err := sessionsStore.Purge(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session has been deleted permanently"})
+}
+
+func cloneSessionJSONHandler(c *gin.Context) {
+	form := struct {
+		Name   string `json:"name"` // optional, "<name> (copy)" by default
+		Author string `json:"author"`
+	}{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&form); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	clone, err := sessionsStore.Clone(c.Param("id"), form.Name, fileStore, form.Author)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session has been cloned", "data": clone})
+}
+
+func importSessionHandler(c *gin.Context) {
+	// overwrite=true replaces the existing session, as_new=true imports a copy next to it
+	mode := store.ImportCreate
+	overwrite := c.Request.FormValue("overwrite") == "true"
+	asNew := c.Request.FormValue("as_new") == "true"
+	switch {
+	case overwrite && asNew:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "overwrite and as_new can't be used together"})
+		return
+	case overwrite:
+		mode = store.ImportOverwrite
+	case asNew:
+		mode = store.ImportAsNew
+	}
+
+	inFile, fh, err := c.Request.FormFile("file_content")
+	if err != nil {
+		log.Printf("importSessionHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer inFile.Close()
+
+	// uploading archive to ./tmp
+	dst := path.Join("tmp", filepath.Base(fh.Filename))
+	err = os.MkdirAll("tmp", 0777)
+	if err != nil {
+		log.Printf("importSessionHandler: failed to create ./tmp: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer func() {
+		if err = os.RemoveAll("tmp"); err != nil {
+			log.Printf("importSessionHandler: failed to clean up after importing: %v", err)
+		}
+	}() // cleaning up at the end
+	outFile, err := os.Create(dst)
+	if err != nil {
+		log.Printf("importSessionHandler: failed to create file at %v: %v", dst, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer outFile.Close()
+	if _, err = io.Copy(outFile, inFile); err != nil {
+		log.Printf("importSessionHandler: failed to copy uploaded file: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// initiating an import
+	report, err := sessionsStore.Import(dst, mode, fileStore, moveStore)
+	if err != nil {
+		log.Printf("importSessionHandler: failed to import the session at %s: %v", dst, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "data": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "session has been uploaded successfully",
+		"data":    report,
+	})
+}
+
+func exportSessionJSONHandler(c *gin.Context) {
+	id := c.Param("id")
+	session, err := sessionsStore.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// moves=true bundles moves from outside of uploads, e.g., built-in ones, otherwise only their names are exported
+	relativePath, err := session.Export("tmp", c.Query("moves") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		log.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "session has been exported",
+		"relative_path": relativePath,
+	})
+}
+
+// exportSessionScriptHandler responds with the session as a human-editable script, see the script package.
+func exportSessionScriptHandler(c *gin.Context) {
+	session, err := sessionsStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var b bytes.Buffer
+	if err = script.Write(&b, session); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", session.Name+".md"))
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", b.Bytes())
+}
+
+// printSessionHandler responds with the session as a self-contained HTML document laid out for printing.
+func printSessionHandler(c *gin.Context) {
+	session, err := sessionsStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var b bytes.Buffer
+	if err = script.WriteHTML(&b, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", b.Bytes())
+}
+
+// importSessionScriptJSONHandler creates a session from a script which is either the request body or
+// an uploaded file in the file_content field of a form. Problems of the script are reported with line numbers.
+func importSessionScriptJSONHandler(c *gin.Context) {
+	var src io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		f, _, err := c.Request.FormFile("file_content")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		src = f
+	}
+
+	session, err := script.Parse(src, moveStore)
+	if err != nil {
+		response := gin.H{"error": err.Error()}
+		if errs, ok := err.(script.Errors); ok {
+			response["errors"] = errs
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err = sessionsStore.Create(session, c.Query("author")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session has been imported from the script", "data": session})
+}
+
+// importSessionCSVHandler creates a session from a CSV file in the file_content field of a form. The saved mapping
+// is used unless a mapping is given in the mapping field as JSON. With dry_run=true the session is only previewed.
+func importSessionCSVHandler(c *gin.Context) {
+	f, fh, err := c.Request.FormFile("file_content")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	var mapping *spreadsheet.Mapping
+	if s := c.Request.FormValue("mapping"); s != "" {
+		if err = json.Unmarshal([]byte(s), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("can't decode the mapping: %v", err)})
+			return
+		}
+	} else if mapping, err = spreadsheet.LoadMapping(csvMappingPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(c.Request.FormValue("name"))
+	if name == "" {
+		name = strings.TrimSuffix(fh.Filename, filepath.Ext(fh.Filename))
+	}
+
+	result, err := spreadsheet.Read(f, name, mapping, moveStore)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Request.FormValue("dry_run") == "true" {
+		c.JSON(http.StatusOK, gin.H{"message": "session has been previewed, nothing has been created", "data": result})
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the file has errors, nothing has been created", "data": result})
+		return
+	}
+
+	if err = sessionsStore.Create(result.Session, c.Request.FormValue("author")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session has been imported from the CSV file", "data": result})
+}
+
+func csvMappingJSONHandler(c *gin.Context) {
+	mapping, err := spreadsheet.LoadMapping(csvMappingPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": mapping})
+}
+
+func updateCSVMappingJSONHandler(c *gin.Context) {
+	var mapping *spreadsheet.Mapping
+	if err := c.ShouldBindJSON(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := spreadsheet.SaveMapping(csvMappingPath, mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "mapping has been saved", "data": mapping})
+}
+
+func deleteSessionJSONHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	err := sessionsStore.Delete(id, c.Query("author"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "session has been deleted",
+	})
+}
+
+func createSessionJSONHandler(c *gin.Context) {
+	var newSession *store.Session
+
+	err := c.ShouldBindJSON(&newSession)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		log.Printf("session: %+v", newSession)
+		return
+	}
+
+	err = sessionsStore.Create(newSession, c.Query("author"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Errorf("failed to create a session: %v", err),
+		})
+		log.Print(fmt.Errorf("failed to create a session: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "session has been created successfully",
+	})
+}
+
+func audioUploadJSONHandler(c *gin.Context) {
+	// NOTE: using form data instead of JSON because of file upload in this handler
+
+	f, fh, err := c.Request.FormFile("file_content")
+	if err != nil {
+		log.Printf("audioUploadJSONHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	uid := uuid.Must(uuid.NewRandom())
+	ext := filepath.Ext(fh.Filename)
+	name := uid.String() + ext
+	dst, err := fileStore.Save(name, f)
+	if err != nil {
+		log.Printf("audioUploadJSONHandler, can't save the file %v: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// NOTE: we don't create an object in Audio, Audio only for commonly used audio items,
+	// session audio items should belong only to a session.
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "file has been uploaded successfully",
+		"id":       uid,
+		"filepath": dst,
+	})
+}
+
+func createAudioJSONHandler(c *gin.Context) {
+	f, fh, err := c.Request.FormFile("file_content")
+	if err != nil {
+		log.Printf("createAudioJSONHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	uid := uuid.Must(uuid.NewRandom())
+	ext := filepath.Ext(fh.Filename)
+	name := uid.String() + ext
+	dst, err := fileStore.Save(name, f)
+	if err != nil {
+		log.Printf("createAudioJSONHandler, can't save the file %v: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	phrase := c.DefaultPostForm("phrase", "")
+	if phrase == "" {
+		phrase = strings.Replace(fh.Filename, filepath.Ext(fh.Filename), "", -1)
+	}
+	group := c.DefaultPostForm("group", "")
+	if group == "" {
+		group = "Default"
+	}
+	action := &instruction.Say{
+		ID:       uid,
+		Phrase:   phrase,
+		FilePath: dst,
+		Group:    group,
+		Delay:    0,
+	}
+	if err = audioStore.Create(action); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create an audio: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "audio has been created successfully",
+		"id":       uid,
+		"filepath": dst,
+	})
+}
+
+func moveUploadJSONHandler(c *gin.Context) {
+	// NOTE: using form data instead of JSON because of file upload in this handler
+
+	f, fh, err := c.Request.FormFile("file_content")
+	if err != nil {
+		log.Printf("moveUploadJSONHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	ext := filepath.Ext(fh.Filename)
+	if strings.ToLower(ext) != ".qianim" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("only .qianim files are supported, got %q", ext)})
+		return
+	}
+
+	// checking the animation before it can reach the robot
+	content, err := ioutil.ReadAll(io.LimitReader(f, maxMoveSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(content) > maxMoveSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("move file is larger than %d bytes", maxMoveSize)})
+		return
+	}
+	anim, err := qianim.Parse(bytes.NewReader(content))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err = qianim.Validate(anim); err != nil {
+		response := gin.H{"error": err.Error()}
+		if verr, ok := err.(*qianim.ValidationError); ok {
+			response["violations"] = verr.Violations
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	uid := uuid.Must(uuid.NewRandom())
+	name := uid.String() + ext
+	dst, err := fileStore.Save(name, bytes.NewReader(content))
+	if err != nil {
 		log.Printf("moveUploadJSONHandler, can't save the file %v: %v", name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -638,30 +1643,89 @@ func imageUploadJSONHandler(c *gin.Context) {
 	//}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "file has been uploaded successfully",
-		"id":       uid,
-		"filepath": dst,
+		"message":  "file has been uploaded successfully",
+		"id":       uid,
+		"filepath": dst,
+	})
+}
+
+func movesJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": moveStore.Moves,
+	})
+}
+
+func getMoveJSONHandler(c *gin.Context) {
+	id := c.Param("id")
+	move, err := moveStore.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": move,
 	})
 }
 
-func movesJSONHandler(c *gin.Context) {
+func getMovePreviewJSONHandler(c *gin.Context) {
+	id := c.Param("id")
+	preview, err := moveStore.Preview(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data": moveStore.Moves,
+		"data": preview,
 	})
 }
 
-func getMoveJSONHandler(c *gin.Context) {
+func mirrorMoveJSONHandler(c *gin.Context) {
 	id := c.Param("id")
-	move, err := moveStore.Get(id)
+	move, err := moveStore.Mirror(id, fileStore)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		log.Printf("mirrorMoveJSONHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": move,
+		"message":  "mirrored move has been created successfully",
+		"id":       move.ID,
+		"filepath": move.FilePath,
+	})
+}
+
+func scaleMoveJSONHandler(c *gin.Context) {
+	form := struct {
+		Speed float64 `json:"speed" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	move, err := moveStore.Scale(id, form.Speed, fileStore)
+	if err != nil {
+		log.Printf("scaleMoveJSONHandler: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "scaled move has been created successfully",
+		"id":       move.ID,
+		"filepath": move.FilePath,
 	})
 }
 
@@ -793,6 +1857,159 @@ func deleteActionJSONHandler(c *gin.Context) {
 	})
 }
 
+// patchSessionJSONHandler applies a JSON Patch (RFC 6902) to the session.
+func patchSessionJSONHandler(c *gin.Context) {
+	b, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	patch, err := jsonpatch.Decode(b)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "session has been patched", func(expected int) (*store.Session, error) {
+		return sessionsStore.Patch(c.Param("id"), expected, c.Query("author"), patch)
+	})
+}
+
+func addSessionItemJSONHandler(c *gin.Context) {
+	form := struct {
+		SessionID string             `json:"session_id" binding:"required"`
+		Position  *int               `json:"position"` // the item is appended if it's missing
+		Item      *store.SessionItem `json:"item" binding:"required"`
+		Author    string             `json:"author"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "item has been added", func(expected int) (*store.Session, error) {
+		return sessionsStore.AddItem(form.SessionID, expected, form.Author, form.Item, positionOrEnd(form.Position))
+	})
+}
+
+func updateSessionItemJSONHandler(c *gin.Context) {
+	item := &store.SessionItem{}
+	if err := c.ShouldBindJSON(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item.ID = uid
+
+	editSession(c, "item has been updated", func(expected int) (*store.Session, error) {
+		return sessionsStore.UpdateItem(expected, c.Query("author"), item)
+	})
+}
+
+func deleteSessionItemJSONHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "item has been deleted", func(expected int) (*store.Session, error) {
+		return sessionsStore.DeleteItem(expected, c.Query("author"), uid)
+	})
+}
+
+func moveSessionItemJSONHandler(c *gin.Context) {
+	form := struct {
+		Position *int   `json:"position" binding:"required"`
+		Author   string `json:"author"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "item has been moved", func(expected int) (*store.Session, error) {
+		return sessionsStore.MoveItem(expected, form.Author, uid, *form.Position)
+	})
+}
+
+func addSessionActionJSONHandler(c *gin.Context) {
+	form := struct {
+		ItemID   uuid.UUID           `json:"item_id" binding:"required"`
+		Position *int                `json:"position"` // the action is appended if it's missing
+		Action   *instruction.Action `json:"action" binding:"required"`
+		Author   string              `json:"author"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "action has been added", func(expected int) (*store.Session, error) {
+		return sessionsStore.AddAction(expected, form.Author, form.ItemID, form.Action, positionOrEnd(form.Position))
+	})
+}
+
+func updateSessionActionJSONHandler(c *gin.Context) {
+	action := &instruction.Action{}
+	if err := c.ShouldBindJSON(action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	action.ID = uid
+
+	editSession(c, "action has been updated", func(expected int) (*store.Session, error) {
+		return sessionsStore.UpdateAction(expected, c.Query("author"), action)
+	})
+}
+
+func deleteSessionActionJSONHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "action has been deleted", func(expected int) (*store.Session, error) {
+		return sessionsStore.DeleteAction(expected, c.Query("author"), uid)
+	})
+}
+
+func moveSessionActionJSONHandler(c *gin.Context) {
+	form := struct {
+		Position *int      `json:"position" binding:"required"`
+		ItemID   uuid.UUID `json:"item_id"` // optional, the item to move the action to
+		Author   string    `json:"author"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	editSession(c, "action has been moved", func(expected int) (*store.Session, error) {
+		return sessionsStore.MoveAction(expected, form.Author, uid, form.ItemID, *form.Position)
+	})
+}
+
 func getSessionItemJSONHandler(c *gin.Context) {
 	id := c.Param("id")
 	item, err := sessionsStore.GetItem(id)
@@ -806,6 +2023,31 @@ func getSessionItemJSONHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
+func integrityCheckJSONHandler(c *gin.Context) {
+	report, err := newIntegrityCheck().Run(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report, "counts": report.Counts()})
+}
+
+// integrityFixJSONHandler fixes problems which can be fixed safely and responds with the report.
+func integrityFixJSONHandler(c *gin.Context) {
+	report, err := newIntegrityCheck().Run(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "data": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d problems have been fixed", report.Fixed),
+		"data":    report,
+		"counts":  report.Counts(),
+	})
+}
+
 func getServerIPJSONHandler(c *gin.Context) {
 	ip, err := getOutboundIP()
 	if err != nil {
@@ -844,8 +2086,286 @@ func speechSynthJSONHandler(c *gin.Context) {
 	})
 }
 
+// synthesizeSessionJSONHandler starts a background job which synthesizes audio for all phrases of the session
+// without audio. The job's progress is available at /api/synthesis_jobs/:id.
+func synthesizeSessionJSONHandler(c *gin.Context) {
+	form := struct {
+		Voice   uint8  `json:"voice" binding:"required"`
+		Emotion uint8  `json:"emotion"` // neutral by default
+		Author  string `json:"author"`
+	}{}
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := sessionsStore.Get(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	job, err := synthesisJobs.Start(c.Param("id"), form.Voice, form.Emotion, form.Author)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "speech synthesis has been started", "data": job})
+}
+
+func synthesisJobsJSONHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": synthesisJobs.List()})
+}
+
+func getSynthesisJobJSONHandler(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	job, err := synthesisJobs.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
 // Helpers
 
+// commandMeta describes the context of a command for the command log.
+type commandMeta struct {
+	RunID     uuid.UUID
+	Operator  string
+	SessionID uuid.UUID
+	ItemID    uuid.UUID
+	ActionID  uuid.UUID
+}
+
+// sendInstruction sends an instruction to the robot and writes the result to the command log. An action with
+// variants is resolved to one of them, the actually sent instruction is returned.
+func sendInstruction(instr instruction.Instruction, meta commandMeta) (instruction.Instruction, error) {
+	entry := &store.CommandEntry{
+		Time:      time.Now(),
+		RunID:     meta.RunID,
+		Operator:  meta.Operator,
+		Robot:     pepperAddr,
+		SessionID: meta.SessionID,
+		ItemID:    meta.ItemID,
+		ActionID:  meta.ActionID,
+	}
+	var languages []string
+	if run, err := runsStore.GetByUUID(meta.RunID); err == nil {
+		entry.ParticipantID = run.ParticipantID
+		languages = run.Languages
+	}
+
+	if a, ok := instr.(*instruction.Action); ok && a.VariantsItem != nil {
+		resolved := a.Resolve(cyclesOf(meta.RunID))
+		entry.VariantID = resolved.ID
+		instr = resolved
+	}
+	switch v := instr.(type) {
+	case *instruction.Action:
+		instr = v.Localize(languages)
+	case *instruction.Say:
+		instr = v.Localize(languages)
+	}
+	entry.Command = instr.Command().String()
+	entry.Name = instr.GetName()
+	if b, err := json.Marshal(instr); err == nil {
+		entry.Instruction = b
+	} else {
+		log.Printf("sendInstruction: failed to marshal the instruction for the command log: %v", err)
+	}
+
+	err := instruction.SendInstruction(instr, wsConnection, &wsMu)
+	entry.Result = store.ResultOK
+	if err != nil {
+		entry.Result = store.ResultError
+		entry.Error = err.Error()
+	}
+	if e := commandLog.Append(entry); e != nil {
+		log.Printf("sendInstruction: failed to write the command log: %v", e)
+	}
+
+	return instr, err
+}
+
+// cyclesOf returns round-robin cycles of variants of the run, so variants aren't repeated within the run
+// even if the session is edited meanwhile.
+func cyclesOf(runID uuid.UUID) *instruction.Cycles {
+	variantCyclesMu.Lock()
+	defer variantCyclesMu.Unlock()
+	cycles, ok := variantCycles[runID]
+	if !ok {
+		cycles = instruction.NewCycles()
+		variantCycles[runID] = cycles
+	}
+	return cycles
+}
+
+// forgetCycles drops round-robin cycles of the finished run.
+func forgetCycles(runID uuid.UUID) {
+	variantCyclesMu.Lock()
+	defer variantCyclesMu.Unlock()
+	delete(variantCycles, runID)
+}
+
+// sendSessionAction sends a session item's action for the session runner.
+func sendSessionAction(runID uuid.UUID, session *store.Session, item *store.SessionItem, action *instruction.Action) (*instruction.Action, error) {
+	if !action.IsValid() || action.IsNil() {
+		return nil, fmt.Errorf("got an invalid or empty instruction")
+	}
+	meta := commandMeta{
+		RunID:     runID,
+		SessionID: session.ID,
+		ItemID:    item.ID,
+		ActionID:  action.ID,
+	}
+	if run, err := runsStore.GetByUUID(runID); err == nil {
+		meta.Operator = run.Operator
+	}
+	sent, err := sendInstruction(action, meta)
+	if err != nil {
+		return nil, err
+	}
+	return sent.(*instruction.Action), nil
+}
+
+// runLanguages returns the preferred languages of a run: the requested ones or the participant's language.
+func runLanguages(requested []string, participantID uuid.UUID) []string {
+	languages := []string{}
+	for _, lang := range requested {
+		if lang = instruction.NormalizeLanguage(lang); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+	if len(languages) > 0 {
+		return languages
+	}
+	if p, err := participants.GetByUUID(participantID); err == nil && p.Language != "" {
+		return []string{instruction.NormalizeLanguage(p.Language)}
+	}
+	return nil
+}
+
+// checkParticipant returns an error if the participant's ID is provided but the participant doesn't exist.
+func checkParticipant(id uuid.UUID) error {
+	if (id == uuid.UUID{}) {
+		return nil
+	}
+	if _, err := participants.GetByUUID(id); err != nil {
+		return fmt.Errorf("unknown participant: %v", err)
+	}
+	return nil
+}
+
+// editSession runs the edit of a session with the revision expected by the client and responds with
+// the edited session or 409 Conflict if the session has been changed since that revision. The revision is
+// required, 428 Precondition Required is returned without it.
+func editSession(c *gin.Context, message string, edit func(expected int) (*store.Session, error)) {
+	expected, err := expectedRevision(c, true)
+	if err == errRevisionRequired {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := edit(expected)
+	var conflict *store.ConflictError
+	var editErr *store.EditError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "revision": conflict.Current})
+		return
+	case errors.As(err, &editErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	setETag(c, session)
+	c.JSON(http.StatusOK, gin.H{"message": message, "data": session})
+}
+
+// errRevisionRequired is returned when a client edits a session without telling which revision it has edited.
+var errRevisionRequired = errors.New("the edited revision must be provided in the If-Match header or the revision parameter, use * to overwrite any revision")
+
+// expectedRevision returns the session's revision the client has edited from the If-Match header or
+// the revision parameter. It's 0 for *, which overwrites any revision, and when neither is provided, unless
+// the revision is required.
+func expectedRevision(c *gin.Context, required bool) (int, error) {
+	value := c.GetHeader("If-Match")
+	if value == "" {
+		value = c.Query("revision")
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	if value == "" && required {
+		return 0, errRevisionRequired
+	}
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	revision, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision %q", value)
+	}
+	return revision, nil
+}
+
+func setETag(c *gin.Context, session *store.Session) {
+	c.Header("ETag", fmt.Sprintf("%q", strconv.Itoa(session.Revision)))
+}
+
+// positionOrEnd returns the position or -1 which means the end of the list.
+func positionOrEnd(position *int) int {
+	if position == nil {
+		return -1
+	}
+	return *position
+}
+
+func newIntegrityCheck() *store.IntegrityCheck {
+	robotMovesMu.RLock()
+	defer robotMovesMu.RUnlock()
+
+	return &store.IntegrityCheck{
+		Sessions:   sessionsStore,
+		Moves:      moveStore,
+		Actions:    actionsStore,
+		Audio:      audioStore,
+		RobotMoves: robotMoves,
+	}
+}
+
+// reportIntegrity logs problems of sessions and library items at startup.
+func reportIntegrity() {
+	report, err := newIntegrityCheck().Run(false)
+	if err != nil {
+		log.Printf("integrity check failed: %v", err)
+		return
+	}
+	if len(report.Problems) == 0 {
+		log.Printf("integrity check: no problems found")
+		return
+	}
+
+	const maxLogged = 20
+	log.Printf("integrity check: %d problems found %v, see /api/integrity_check", len(report.Problems), report.Counts())
+	for i, p := range report.Problems {
+		if i == maxLogged {
+			log.Printf("integrity check: ... and %d more", len(report.Problems)-maxLogged)
+			break
+		}
+		log.Printf("integrity check: %s at %s: %s", p.Kind, p.Location, p.Value)
+	}
+}
+
 func makeMoveActionsFromNames(names []string, group string) []*instruction.Move {
 	moves := []*instruction.Move{}
 	for _, n := range names {
@@ -0,0 +1,46 @@
+package qianim
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Mirror returns a left-right mirrored copy of the animation. Curves of the left and right sides are swapped
+// and values of roll and yaw joints change their sign, because these axes are mirrored on Pepper, e.g.,
+// LShoulderRoll is positive when the arm is raised sideways, while RShoulderRoll is negative.
+func Mirror(a *Animation) *Animation {
+	m := a.Copy()
+	for _, curve := range m.Actuators.Curves {
+		curve.Actuator = MirrorActuator(curve.Actuator)
+		if !isMirroredAxis(curve.Actuator) {
+			continue
+		}
+		for _, key := range curve.Keys {
+			key.Value = -key.Value
+			for _, t := range key.Tangents {
+				t.Ordinate = -t.Ordinate
+			}
+		}
+	}
+	return m
+}
+
+// MirrorActuator returns the name of the actuator on the opposite side, e.g., LElbowYaw -> RElbowYaw.
+// Names of central actuators like HeadYaw are returned unchanged.
+func MirrorActuator(name string) string {
+	runes := []rune(name)
+	if len(runes) < 2 || !unicode.IsUpper(runes[1]) {
+		return name
+	}
+	switch runes[0] {
+	case 'L':
+		return "R" + string(runes[1:])
+	case 'R':
+		return "L" + string(runes[1:])
+	}
+	return name
+}
+
+func isMirroredAxis(name string) bool {
+	return strings.HasSuffix(name, "Roll") || strings.HasSuffix(name, "Yaw")
+}
@@ -0,0 +1,107 @@
+package qianim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<Animation xmlns:editor="http://www.aldebaran-robotics.com/animation/editor" typeVersion="2.0">
+  <ActuatorList model="juliette">
+    <ActuatorCurve fps="25" actuator="HeadYaw" mute="false" unit="degree">
+      <Key value="-10" frame="10" smooth="0" symmetrical="0">
+        <Tangent side="right" interpType="bezier" abscissaParam="3.33" ordinateParam="1"/>
+      </Key>
+      <Key value="20" frame="30" smooth="0" symmetrical="0">
+        <Tangent side="left" interpType="bezier" abscissaParam="-6.66" ordinateParam="0"/>
+      </Key>
+    </ActuatorCurve>
+    <ActuatorCurve fps="25" actuator="LShoulderRoll" mute="false" unit="degree">
+      <Key value="10" frame="5" smooth="0" symmetrical="0"/>
+      <Key value="40" frame="30" smooth="0" symmetrical="0"/>
+    </ActuatorCurve>
+    <ActuatorCurve fps="25" actuator="LShoulderPitch" mute="false" unit="degree">
+      <Key value="30" frame="5" smooth="0" symmetrical="0"/>
+      <Key value="50" frame="30" smooth="0" symmetrical="0"/>
+    </ActuatorCurve>
+    <ActuatorCurve fps="25" actuator="LHand" mute="false" unit="dimensionless">
+      <Key value="0.2" frame="5" smooth="0" symmetrical="0"/>
+      <Key value="0.9" frame="30" smooth="0" symmetrical="0"/>
+    </ActuatorCurve>
+  </ActuatorList>
+</Animation>
+`
+
+func parseSample(t *testing.T) *Animation {
+	t.Helper()
+	anim, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return anim
+}
+
+func curveOf(t *testing.T, a *Animation, actuator string) *Curve {
+	t.Helper()
+	for _, c := range a.Actuators.Curves {
+		if c.Actuator == actuator {
+			return c
+		}
+	}
+	t.Fatalf("no curve of %s", actuator)
+	return nil
+}
+
+func TestMirror(t *testing.T) {
+	anim := parseSample(t)
+	mirrored := Mirror(anim)
+
+	tests := []struct {
+		actuator string
+		values   []float64
+	}{
+		{"HeadYaw", []float64{10, -20}},
+		{"RShoulderRoll", []float64{-10, -40}},
+		{"RShoulderPitch", []float64{30, 50}},
+		{"RHand", []float64{0.2, 0.9}},
+	}
+	for _, tt := range tests {
+		curve := curveOf(t, mirrored, tt.actuator)
+		for i, key := range curve.Keys {
+			if key.Value != tt.values[i] {
+				t.Errorf("%s key %d is %v, want %v", tt.actuator, i, key.Value, tt.values[i])
+			}
+		}
+	}
+	if ordinate := curveOf(t, mirrored, "HeadYaw").Keys[0].Tangents[0].Ordinate; ordinate != -1 {
+		t.Errorf("the tangent of a mirrored axis isn't mirrored: %v", ordinate)
+	}
+
+	// the original is kept and mirroring twice gives it back
+	if curveOf(t, anim, "LShoulderRoll").Keys[0].Value != 10 {
+		t.Fatal("the original animation is changed")
+	}
+	original, _ := anim.Bytes()
+	twice, _ := Mirror(mirrored).Bytes()
+	if !bytes.Equal(original, twice) {
+		t.Fatalf("mirroring twice changes the animation:\n%s\nwant:\n%s", twice, original)
+	}
+}
+
+func TestMirrorActuator(t *testing.T) {
+	tests := map[string]string{
+		"LElbowYaw":     "RElbowYaw",
+		"RShoulderRoll": "LShoulderRoll",
+		"RHand":         "LHand",
+		"HeadYaw":       "HeadYaw",
+		"KneePitch":     "KneePitch",
+		"L":             "L",
+		"Lower":         "Lower",
+	}
+	for name, want := range tests {
+		if got := MirrorActuator(name); got != want {
+			t.Errorf("MirrorActuator(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package qianim
+
+import (
+	"math"
+	"sort"
+)
+
+// Preview is a normalised representation of an animation for the web UI: time is in seconds,
+// joint angles are in radians, hands are in the range from 0 to 1.
+type Preview struct {
+	Duration float64         `json:"duration"`
+	FPS      float64         `json:"fps"`
+	Joints   []*JointPreview `json:"joints"`
+	Frames   []*FramePreview `json:"frames"`
+}
+
+// JointPreview contains keyframes of a single joint.
+type JointPreview struct {
+	Name   string    `json:"name"`
+	Unit   string    `json:"unit"`
+	Times  []float64 `json:"times"`
+	Values []float64 `json:"values"`
+}
+
+// FramePreview is a pose of the robot at the moment of time, values are linearly interpolated between keyframes.
+type FramePreview struct {
+	Time   float64            `json:"time"`
+	Joints map[string]float64 `json:"joints"`
+}
+
+// NewPreview converts an animation into a preview sampled at the animation's frame rate.
+func NewPreview(a *Animation) *Preview {
+	p := &Preview{
+		Duration: a.Duration(),
+		FPS:      DefaultFPS,
+		Joints:   []*JointPreview{},
+		Frames:   []*FramePreview{},
+	}
+
+	for _, curve := range a.Actuators.Curves {
+		if curve.Mute || len(curve.Keys) == 0 {
+			continue
+		}
+		p.FPS = math.Max(p.FPS, curve.fps())
+
+		keys := make([]*Key, len(curve.Keys))
+		copy(keys, curve.Keys)
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Frame < keys[j].Frame })
+
+		joint := &JointPreview{
+			Name:   curve.Actuator,
+			Unit:   UnitRadian,
+			Times:  make([]float64, len(keys)),
+			Values: make([]float64, len(keys)),
+		}
+		if curve.IsDimensionless() {
+			joint.Unit = UnitDimensionless
+		}
+		for i, key := range keys {
+			joint.Times[i] = curve.Seconds(float64(key.Frame))
+			joint.Values[i] = curve.Radians(key.Value)
+		}
+		p.Joints = append(p.Joints, joint)
+	}
+
+	frames := int(math.Ceil(p.Duration*p.FPS)) + 1
+	for i := 0; i < frames; i++ {
+		t := math.Min(float64(i)/p.FPS, p.Duration)
+		frame := &FramePreview{Time: t, Joints: map[string]float64{}}
+		for _, joint := range p.Joints {
+			frame.Joints[joint.Name] = joint.valueAt(t)
+		}
+		p.Frames = append(p.Frames, frame)
+	}
+
+	return p
+}
+
+// valueAt interpolates a joint value linearly, before the first and after the last keyframes the value is constant.
+func (j *JointPreview) valueAt(t float64) float64 {
+	n := len(j.Times)
+	if t <= j.Times[0] {
+		return j.Values[0]
+	}
+	if t >= j.Times[n-1] {
+		return j.Values[n-1]
+	}
+	i := sort.SearchFloat64s(j.Times, t)
+	t0, t1 := j.Times[i-1], j.Times[i]
+	v0, v1 := j.Values[i-1], j.Values[i]
+	if t1 == t0 {
+		return v1
+	}
+	return v0 + (v1-v0)*(t-t0)/(t1-t0)
+}
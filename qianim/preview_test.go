@@ -0,0 +1,93 @@
+package qianim
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const previewSample = `<?xml version="1.0" encoding="UTF-8"?>
+<Animation typeVersion="2.0">
+  <ActuatorList model="juliette">
+    <ActuatorCurve fps="25" actuator="HeadYaw" mute="false" unit="degree">
+      <Key value="90" frame="25"/>
+      <Key value="0" frame="0"/>
+    </ActuatorCurve>
+    <ActuatorCurve fps="50" actuator="HeadPitch" mute="false" unit="radian">
+      <Key value="0.5" frame="25"/>
+      <Key value="1" frame="50"/>
+    </ActuatorCurve>
+    <ActuatorCurve fps="25" actuator="RHand" mute="false">
+      <Key value="0.3" frame="0"/>
+      <Key value="0.8" frame="25"/>
+    </ActuatorCurve>
+    <ActuatorCurve fps="25" actuator="LElbowRoll" mute="true" unit="degree">
+      <Key value="-40" frame="10"/>
+    </ActuatorCurve>
+  </ActuatorList>
+</Animation>
+`
+
+func TestNewPreview(t *testing.T) {
+	anim, err := Parse(strings.NewReader(previewSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPreview(anim)
+
+	if p.Duration != 1 || p.FPS != 50 {
+		t.Fatalf("got the duration %v and %v fps, want 1 and 50", p.Duration, p.FPS)
+	}
+
+	// keyframes are sorted by time, angles are in radians, hands stay as they are, muted curves are skipped
+	want := map[string]*JointPreview{
+		"HeadYaw":   {Unit: UnitRadian, Times: []float64{0, 1}, Values: []float64{0, math.Pi / 2}},
+		"HeadPitch": {Unit: UnitRadian, Times: []float64{0.5, 1}, Values: []float64{0.5, 1}},
+		"RHand":     {Unit: UnitDimensionless, Times: []float64{0, 1}, Values: []float64{0.3, 0.8}},
+	}
+	if len(p.Joints) != len(want) {
+		t.Fatalf("got %d joints, want %d", len(p.Joints), len(want))
+	}
+	for _, joint := range p.Joints {
+		w, ok := want[joint.Name]
+		if !ok {
+			t.Fatalf("unexpected joint %s", joint.Name)
+		}
+		if joint.Unit != w.Unit || !almostEqual(joint.Times, w.Times) || !almostEqual(joint.Values, w.Values) {
+			t.Errorf("the joint %s is %+v, want %+v", joint.Name, joint, w)
+		}
+	}
+
+	// frames are sampled at the highest frame rate, values before the first keyframe are constant
+	if len(p.Frames) != 51 {
+		t.Fatalf("got %d frames, want 51", len(p.Frames))
+	}
+	frames := map[int]map[string]float64{
+		0:  {"HeadYaw": 0, "HeadPitch": 0.5, "RHand": 0.3},
+		25: {"HeadYaw": math.Pi / 4, "HeadPitch": 0.5, "RHand": 0.55},
+		50: {"HeadYaw": math.Pi / 2, "HeadPitch": 1, "RHand": 0.8},
+	}
+	for i, joints := range frames {
+		frame := p.Frames[i]
+		if math.Abs(frame.Time-float64(i)/50) > 1e-9 {
+			t.Errorf("frame %d is at %v seconds", i, frame.Time)
+		}
+		for name, v := range joints {
+			if math.Abs(frame.Joints[name]-v) > 1e-9 {
+				t.Errorf("%s in frame %d is %v, want %v", name, i, frame.Joints[name], v)
+			}
+		}
+	}
+}
+
+func almostEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
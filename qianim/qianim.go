@@ -0,0 +1,203 @@
+/*
+Package qianim reads and writes Choregraphe animation files (.qianim) which are used to describe Pepper's moves.
+An animation is a list of actuator curves, each curve is a set of keyframes for a single joint. Values of joints
+are stored in degrees, values of hands are dimensionless and lie in the range from 0 (closed) to 1 (open).
+*/
+package qianim
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// DefaultFPS is used when a curve doesn't specify its frame rate.
+const DefaultFPS = 25
+
+// Units of actuator curves.
+const (
+	UnitDegree        = "degree"
+	UnitRadian        = "radian"
+	UnitDimensionless = "dimensionless"
+)
+
+// Animation is the root element of a .qianim file.
+type Animation struct {
+	XMLName   xml.Name     `xml:"Animation"`
+	Attrs     []xml.Attr   `xml:",any,attr"`
+	Actuators ActuatorList `xml:"ActuatorList"`
+}
+
+// ActuatorList contains all curves of an animation.
+type ActuatorList struct {
+	Attrs  []xml.Attr `xml:",any,attr"`
+	Curves []*Curve   `xml:"ActuatorCurve"`
+}
+
+// Curve is a set of keyframes for a single actuator.
+type Curve struct {
+	Actuator string     `xml:"actuator,attr"`
+	FPS      float64    `xml:"fps,attr,omitempty"`
+	Mute     bool       `xml:"mute,attr"`
+	Unit     string     `xml:"unit,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Keys     []*Key     `xml:"Key"`
+}
+
+// Key is a single keyframe of a curve.
+type Key struct {
+	Frame    int        `xml:"frame,attr"`
+	Value    float64    `xml:"value,attr"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Tangents []*Tangent `xml:"Tangent"`
+}
+
+// Tangent describes the Bezier interpolation around a keyframe. Abscissa is measured in frames,
+// Ordinate in units of the curve.
+type Tangent struct {
+	Side       string     `xml:"side,attr"`
+	InterpType string     `xml:"interpType,attr"`
+	Abscissa   float64    `xml:"abscissaParam,attr"`
+	Ordinate   float64    `xml:"ordinateParam,attr"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+}
+
+// Parse decodes an animation from r.
+func Parse(r io.Reader) (*Animation, error) {
+	anim := &Animation{}
+	if err := xml.NewDecoder(r).Decode(anim); err != nil {
+		return nil, fmt.Errorf("failed to decode an animation: %v", err)
+	}
+	anim.dropNamespacedAttrs()
+	return anim, nil
+}
+
+// ParseFile decodes an animation from the file at fpath.
+func ParseFile(fpath string) (*Animation, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Encode writes an animation to w in the .qianim format.
+func (a *Animation) Encode(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(a); err != nil {
+		return fmt.Errorf("failed to encode an animation: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Bytes returns the animation encoded in the .qianim format.
+func (a *Animation) Bytes() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := a.Encode(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Copy returns a deep copy of the animation.
+func (a *Animation) Copy() *Animation {
+	c := &Animation{
+		XMLName: a.XMLName,
+		Attrs:   append([]xml.Attr{}, a.Attrs...),
+		Actuators: ActuatorList{
+			Attrs: append([]xml.Attr{}, a.Actuators.Attrs...),
+		},
+	}
+	for _, curve := range a.Actuators.Curves {
+		cc := *curve
+		cc.Attrs = append([]xml.Attr{}, curve.Attrs...)
+		cc.Keys = make([]*Key, len(curve.Keys))
+		for i, key := range curve.Keys {
+			kc := *key
+			kc.Attrs = append([]xml.Attr{}, key.Attrs...)
+			kc.Tangents = make([]*Tangent, len(key.Tangents))
+			for j, t := range key.Tangents {
+				tc := *t
+				tc.Attrs = append([]xml.Attr{}, t.Attrs...)
+				kc.Tangents[j] = &tc
+			}
+			cc.Keys[i] = &kc
+		}
+		c.Actuators.Curves = append(c.Actuators.Curves, &cc)
+	}
+	return c
+}
+
+// Duration returns the length of the animation in seconds.
+func (a *Animation) Duration() float64 {
+	var d float64
+	for _, curve := range a.Actuators.Curves {
+		for _, key := range curve.Keys {
+			d = math.Max(d, float64(key.Frame)/curve.fps())
+		}
+	}
+	return d
+}
+
+// dropNamespacedAttrs removes editor-specific attributes like xmlns:editor, because encoding/xml
+// can't write them back correctly and the robot doesn't need them.
+func (a *Animation) dropNamespacedAttrs() {
+	a.Attrs = plainAttrs(a.Attrs)
+	a.Actuators.Attrs = plainAttrs(a.Actuators.Attrs)
+	for _, curve := range a.Actuators.Curves {
+		curve.Attrs = plainAttrs(curve.Attrs)
+		for _, key := range curve.Keys {
+			key.Attrs = plainAttrs(key.Attrs)
+			for _, t := range key.Tangents {
+				t.Attrs = plainAttrs(t.Attrs)
+			}
+		}
+	}
+}
+
+func plainAttrs(attrs []xml.Attr) []xml.Attr {
+	result := []xml.Attr{}
+	for _, attr := range attrs {
+		if attr.Name.Space != "" {
+			continue
+		}
+		result = append(result, attr)
+	}
+	return result
+}
+
+func (c *Curve) fps() float64 {
+	if c.FPS <= 0 {
+		return DefaultFPS
+	}
+	return c.FPS
+}
+
+// IsDimensionless is true for hands, their values are in the range from 0 to 1.
+func (c *Curve) IsDimensionless() bool {
+	return c.Unit == UnitDimensionless || strings.HasSuffix(c.Actuator, "Hand")
+}
+
+// Radians converts a curve value to radians, dimensionless values are returned as is.
+func (c *Curve) Radians(v float64) float64 {
+	if c.IsDimensionless() || c.Unit == UnitRadian {
+		return v
+	}
+	return v * math.Pi / 180
+}
+
+// Seconds converts a frame number to seconds.
+func (c *Curve) Seconds(frame float64) float64 {
+	return frame / c.fps()
+}
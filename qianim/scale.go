@@ -0,0 +1,33 @@
+package qianim
+
+import (
+	"math"
+	"sort"
+)
+
+// Scale returns a copy of the animation played with the speed factor: 2 is twice as fast, 0.5 is twice as slow.
+// Frames are stretched in time, so the trajectory of joints stays the same. Keyframes which would fall
+// on the same frame after rounding are shifted forward to keep them ordered.
+func Scale(a *Animation, factor float64) *Animation {
+	s := a.Copy()
+	if factor <= 0 || factor == 1 {
+		return s
+	}
+
+	for _, curve := range s.Actuators.Curves {
+		sort.Slice(curve.Keys, func(i, j int) bool { return curve.Keys[i].Frame < curve.Keys[j].Frame })
+		previous := -1
+		for _, key := range curve.Keys {
+			frame := int(math.Round(float64(key.Frame) / factor))
+			if frame <= previous {
+				frame = previous + 1
+			}
+			key.Frame = frame
+			previous = frame
+			for _, t := range key.Tangents {
+				t.Abscissa = t.Abscissa / factor
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package qianim
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	anim := parseSample(t)
+
+	faster := Scale(anim, 2)
+	if d := faster.Duration(); math.Abs(d-anim.Duration()/2) > 0.05 {
+		t.Fatalf("twice as fast lasts %vs, want %vs", d, anim.Duration()/2)
+	}
+	headYaw := curveOf(t, faster, "HeadYaw")
+	if headYaw.Keys[0].Frame != 5 || headYaw.Keys[1].Frame != 15 {
+		t.Fatalf("frames are %d and %d, want 5 and 15", headYaw.Keys[0].Frame, headYaw.Keys[1].Frame)
+	}
+	if headYaw.Keys[0].Value != -10 || headYaw.Keys[0].Tangents[0].Abscissa != 3.33/2 || headYaw.Keys[0].Tangents[0].Ordinate != 1 {
+		t.Fatalf("values or tangents are scaled wrong: %+v %+v", headYaw.Keys[0], headYaw.Keys[0].Tangents[0])
+	}
+
+	slower := Scale(anim, 0.5)
+	if d := slower.Duration(); d != anim.Duration()*2 {
+		t.Fatalf("twice as slow lasts %vs, want %vs", d, anim.Duration()*2)
+	}
+
+	if curveOf(t, anim, "HeadYaw").Keys[0].Frame != 10 {
+		t.Fatal("the original animation is changed")
+	}
+	for _, factor := range []float64{1, 0, -1} {
+		if d := Scale(anim, factor).Duration(); d != anim.Duration() {
+			t.Errorf("the factor %v changes the duration to %vs", factor, d)
+		}
+	}
+}
+
+func TestScale_KeepsKeyframesOrdered(t *testing.T) {
+	anim := &Animation{Actuators: ActuatorList{Curves: []*Curve{{
+		Actuator: "HeadYaw",
+		Keys:     []*Key{{Frame: 12}, {Frame: 10}, {Frame: 11}},
+	}}}}
+	keys := Scale(anim, 4).Actuators.Curves[0].Keys
+	for i, want := range []int{3, 4, 5} {
+		if keys[i].Frame != want {
+			t.Fatalf("key %d is at frame %d, want %d", i, keys[i].Frame, want)
+		}
+	}
+}
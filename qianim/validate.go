@@ -0,0 +1,146 @@
+package qianim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Limit describes the range of a joint and its maximum angular velocity in radians and radians per second.
+// Hands are dimensionless, their velocity isn't checked.
+type Limit struct {
+	Min         float64
+	Max         float64
+	MaxVelocity float64
+}
+
+// Limits of Pepper's joints according to the Aldebaran documentation for Pepper 1.8.
+var Limits = map[string]Limit{
+	"HeadYaw":        {-2.0857, 2.0857, 7.33},
+	"HeadPitch":      {-0.7068, 0.6371, 9.23},
+	"LShoulderPitch": {-2.0857, 2.0857, 7.33},
+	"LShoulderRoll":  {0.0087, 1.5620, 9.23},
+	"LElbowYaw":      {-2.0857, 2.0857, 7.33},
+	"LElbowRoll":     {-1.5620, -0.0087, 9.23},
+	"LWristYaw":      {-1.8239, 1.8239, 17.38},
+	"LHand":          {0, 1, 0},
+	"RShoulderPitch": {-2.0857, 2.0857, 7.33},
+	"RShoulderRoll":  {-1.5620, -0.0087, 9.23},
+	"RElbowYaw":      {-2.0857, 2.0857, 7.33},
+	"RElbowRoll":     {0.0087, 1.5620, 9.23},
+	"RWristYaw":      {-1.8239, 1.8239, 17.38},
+	"RHand":          {0, 1, 0},
+	"HipRoll":        {-0.5149, 0.5149, 2.27},
+	"HipPitch":       {-1.0385, 1.0385, 2.27},
+	"KneePitch":      {-0.5149, 0.5149, 2.94},
+}
+
+// Tolerances for rounding errors of animations exported from Choregraphe, values are stored there in degrees
+// with a limited precision.
+const (
+	positionTolerance = 0.01 // radians
+	velocityTolerance = 1.05 // ratio
+)
+
+// Violation describes a single problem of an animation.
+type Violation struct {
+	Joint   string  `json:"joint"`
+	Time    float64 `json:"time"` // in seconds
+	Frame   int     `json:"frame"`
+	Problem string  `json:"problem"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s at %.2fs (frame %d): %s", v.Joint, v.Time, v.Frame, v.Problem)
+}
+
+// ValidationError is returned when an animation is malformed or is unsafe to be played on the robot.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		problems[i] = v.String()
+	}
+	return fmt.Sprintf("animation is unsafe or malformed: %s", strings.Join(problems, "; "))
+}
+
+// Validate checks an animation against Pepper's joint limits and maximum angular velocities.
+// The returned error is of type *ValidationError when there are violations.
+func Validate(a *Animation) error {
+	violations := []Violation{}
+	add := func(joint string, frame int, curve *Curve, problem string, args ...interface{}) {
+		v := Violation{Joint: joint, Frame: frame, Problem: fmt.Sprintf(problem, args...)}
+		if curve != nil {
+			v.Time = curve.Seconds(float64(frame))
+		}
+		violations = append(violations, v)
+	}
+
+	if len(a.Actuators.Curves) == 0 {
+		add("", 0, nil, "animation has no actuator curves")
+	}
+
+	seen := map[string]bool{}
+	for _, curve := range a.Actuators.Curves {
+		joint := curve.Actuator
+		limit, ok := Limits[joint]
+		if !ok {
+			add(joint, 0, nil, "unknown actuator")
+			continue
+		}
+		if seen[joint] {
+			add(joint, 0, nil, "duplicated actuator curve")
+			continue
+		}
+		seen[joint] = true
+		if curve.FPS < 0 {
+			add(joint, 0, nil, "negative frame rate %v", curve.FPS)
+			continue
+		}
+		if len(curve.Keys) == 0 {
+			add(joint, 0, nil, "curve has no keyframes")
+			continue
+		}
+
+		keys := make([]*Key, len(curve.Keys))
+		copy(keys, curve.Keys)
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Frame < keys[j].Frame })
+
+		for i, key := range keys {
+			value := curve.Radians(key.Value)
+			if key.Frame < 0 {
+				add(joint, key.Frame, curve, "negative frame")
+			}
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				add(joint, key.Frame, curve, "value is not a number")
+				continue
+			}
+			if value < limit.Min-positionTolerance || value > limit.Max+positionTolerance {
+				add(joint, key.Frame, curve, "position %.4f is out of the range [%.4f, %.4f]", value, limit.Min, limit.Max)
+			}
+
+			if i == 0 || limit.MaxVelocity == 0 {
+				continue
+			}
+			previous := keys[i-1]
+			if previous.Frame == key.Frame {
+				add(joint, key.Frame, curve, "duplicated keyframe")
+				continue
+			}
+			dt := curve.Seconds(float64(key.Frame - previous.Frame))
+			velocity := math.Abs(value-curve.Radians(previous.Value)) / dt
+			if velocity > limit.MaxVelocity*velocityTolerance {
+				add(joint, key.Frame, curve, "angular velocity %.2f rad/s exceeds the maximum %.2f rad/s", velocity, limit.MaxVelocity)
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
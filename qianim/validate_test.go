@@ -0,0 +1,65 @@
+package qianim
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	curve := func(actuator, unit string, keys ...*Key) *Curve {
+		return &Curve{Actuator: actuator, FPS: 25, Unit: unit, Keys: keys}
+	}
+	key := func(frame int, value float64) *Key {
+		return &Key{Frame: frame, Value: value}
+	}
+
+	tests := []struct {
+		name    string
+		curves  []*Curve
+		problem string // empty if the animation is valid
+	}{
+		{"valid", []*Curve{curve("HeadYaw", UnitDegree, key(0, -10), key(25, 20)), curve("LHand", UnitDimensionless, key(0, 0), key(25, 1))}, ""},
+		{"radians", []*Curve{curve("HeadPitch", UnitRadian, key(0, 0), key(25, 0.5))}, ""},
+		{"rounding error", []*Curve{curve("LShoulderRoll", UnitDegree, key(0, 0.4), key(25, 89.7))}, ""},
+		{"no curves", nil, "no actuator curves"},
+		{"unknown actuator", []*Curve{curve("Tail", UnitDegree, key(0, 0))}, "unknown actuator"},
+		{"duplicated curve", []*Curve{curve("HeadYaw", UnitDegree, key(0, 0)), curve("HeadYaw", UnitDegree, key(0, 0))}, "duplicated actuator curve"},
+		{"negative frame rate", []*Curve{{Actuator: "HeadYaw", FPS: -1, Keys: []*Key{key(0, 0)}}}, "negative frame rate"},
+		{"no keyframes", []*Curve{curve("HeadYaw", UnitDegree)}, "no keyframes"},
+		{"negative frame", []*Curve{curve("HeadYaw", UnitDegree, key(-1, 0))}, "negative frame"},
+		{"not a number", []*Curve{curve("HeadYaw", UnitDegree, key(0, math.NaN()))}, "not a number"},
+		{"out of range", []*Curve{curve("HeadPitch", UnitDegree, key(0, 60))}, "out of the range"},
+		{"hand out of range", []*Curve{curve("RHand", UnitDimensionless, key(0, 1.5))}, "out of the range"},
+		{"too fast", []*Curve{curve("HeadYaw", UnitDegree, key(0, -100), key(1, 100))}, "angular velocity"},
+		{"duplicated keyframe", []*Curve{curve("HeadYaw", UnitDegree, key(5, 0), key(5, 1))}, "duplicated keyframe"},
+		{"unsorted keyframes", []*Curve{curve("HeadYaw", UnitDegree, key(25, 20), key(0, -10))}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&Animation{Actuators: ActuatorList{Curves: tt.curves}})
+			if tt.problem == "" {
+				if err != nil {
+					t.Fatalf("want a valid animation, got %v", err)
+				}
+				return
+			}
+			ve, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("want ValidationError, got %v", err)
+			}
+			for _, v := range ve.Violations {
+				if strings.Contains(v.Problem, tt.problem) {
+					return
+				}
+			}
+			t.Fatalf("want a violation %q, got %v", tt.problem, err)
+		})
+	}
+}
+
+func TestValidate_Sample(t *testing.T) {
+	if err := Validate(parseSample(t)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,572 @@
+/*
+Package runner steps through a session on the server side. It sends the main action of every session item
+to the robot and waits for a configured gap or for an acknowledgement from the client app before going
+to the next item. The run can be paused, resumed and navigated. The state of the runner is saved to a file,
+so it survives reloading of the web UI and restarts of the server.
+*/
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// State of the runner.
+type State string
+
+const (
+	Idle     State = "idle"
+	Playing  State = "playing"
+	Paused   State = "paused"
+	Finished State = "finished"
+)
+
+// SendFunc sends an action of a session item to the robot within the run and returns the action which has been
+// actually sent, e.g., a picked variant.
+type SendFunc func(runID uuid.UUID, session *store.Session, item *store.SessionItem, action *instruction.Action) (*instruction.Action, error)
+
+// Runner keeps the position in the session which is being run.
+type Runner struct {
+	State      State
+	RunID      uuid.UUID
+	SessionID  uuid.UUID
+	ItemID     uuid.UUID   // the current session item
+	Gap        int64       // in seconds, time to wait after an item has been sent, if WaitAck is false
+	WaitAck    bool        // wait for an acknowledgement from the client app instead of the gap
+	Sent       bool        // whether the current item has been sent
+	Choice     uuid.UUID   // the answer action picked for the current item, it decides the next item
+	History    []uuid.UUID // previously run items for going back
+	StartedAt  time.Time
+	LastSentAt time.Time
+	LastAction *instruction.Action // the last sent action, the client app plays its audio
+	LastError  string
+
+	filepath   string
+	sessions   *store.Sessions
+	send       SendFunc
+	timer      *time.Timer
+	generation int // invalidates scheduled steps and pending deliveries after any change of the state
+	mu         sync.Mutex
+}
+
+// Status is a snapshot of the runner for the client app.
+type Status struct {
+	State      State               `json:"state"`
+	RunID      uuid.UUID           `json:"run_id"`
+	SessionID  uuid.UUID           `json:"session_id"`
+	Position   int                 `json:"position"` // index of the current item, -1 if it has been removed from the session
+	ItemID     uuid.UUID           `json:"item_id"`
+	ItemsCount int                 `json:"items_count"`
+	Gap        int64               `json:"gap"`
+	WaitAck    bool                `json:"wait_ack"`
+	Sent       bool                `json:"sent"`
+	Choice     uuid.UUID           `json:"choice"`
+	StartedAt  time.Time           `json:"started_at"`
+	LastSentAt time.Time           `json:"last_sent_at"`
+	LastAction *instruction.Action `json:"last_action"`
+	LastError  string              `json:"last_error"`
+}
+
+// delivery is an action which is sent after the runner has been unlocked, because sending to the robot
+// may take a while and the runner must stay responsive meanwhile.
+type delivery struct {
+	runID      uuid.UUID
+	session    *store.Session
+	item       *store.SessionItem
+	action     *instruction.Action
+	answer     bool // the action is an answer picked by the operator, not the main action of the item
+	generation int
+}
+
+// New creates a runner or loads the saved one from fpath. A run which was playing when the server stopped
+// is loaded paused, so the robot doesn't start moving on its own after a restart.
+func New(fpath string, sessions *store.Sessions, send SendFunc) (*Runner, error) {
+	var file *os.File
+	_, err := os.Stat(fpath)
+	if os.IsNotExist(err) {
+		file, err = os.Create(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("can't create a runner state at %s: %v", fpath, err)
+		}
+	} else {
+		file, err = os.Open(fpath)
+	}
+	defer file.Close()
+
+	r := &Runner{
+		State:    Idle,
+		filepath: fpath,
+		sessions: sessions,
+		send:     send,
+	}
+	if err = json.NewDecoder(file).Decode(r); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode the runner state from %s: %v", fpath, err)
+	}
+	if r.State == Playing {
+		r.State = Paused
+	}
+
+	return r, r.dump()
+}
+
+// Start begins the run of the session from its start item.
+func (r *Runner) Start(sessionID string, runID uuid.UUID, gap int64, waitAck bool) error {
+	session, err := r.sessions.Get(sessionID)
+	if err != nil {
+		return err
+	}
+	if len(session.Items) == 0 {
+		return fmt.Errorf("session has no items")
+	}
+	if gap < 0 {
+		return fmt.Errorf("gap must not be negative")
+	}
+	start := session.Items[session.StartPosition()]
+	if start == nil {
+		return fmt.Errorf("the start item is empty")
+	}
+
+	r.mu.Lock()
+	r.reset()
+	r.RunID = runID
+	r.SessionID = session.ID
+	r.Gap = gap
+	r.WaitAck = waitAck
+	r.StartedAt = time.Now()
+	r.ItemID = start.ID
+	r.State = Playing
+	d, err := r.playCurrent()
+	err = r.dumpAfter(err)
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+// Pause stops the runner from going to the next item.
+func (r *Runner) Pause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.State != Playing {
+		return fmt.Errorf("runner is not playing")
+	}
+	r.cancelScheduled()
+	r.State = Paused
+	return r.dump()
+}
+
+// Resume continues a paused run: the current item is sent if it hasn't been sent yet, then the runner
+// waits for the gap or an acknowledgement as usual.
+func (r *Runner) Resume() error {
+	r.mu.Lock()
+	if r.State != Paused {
+		r.mu.Unlock()
+		return fmt.Errorf("runner is not paused")
+	}
+	r.State = Playing
+	if r.Sent {
+		r.scheduleNext()
+		err := r.dump()
+		r.mu.Unlock()
+		return err
+	}
+	d, err := r.playCurrent()
+	err = r.dumpAfter(err)
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+// Skip goes to the next item according to the session's graph.
+func (r *Runner) Skip() error {
+	r.mu.Lock()
+	d, err := r.skip()
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+func (r *Runner) skip() (*delivery, error) {
+	session, err := r.session()
+	if err != nil {
+		return nil, err
+	}
+	position, err := r.position(session)
+	if err != nil {
+		return nil, err
+	}
+	next, ok := nextItemID(session, position, r.Choice)
+	if !ok {
+		return nil, fmt.Errorf("the current item is the last one")
+	}
+	return r.jump(next, true)
+}
+
+// Back goes to the previously run item.
+func (r *Runner) Back() error {
+	r.mu.Lock()
+	d, err := r.back()
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+func (r *Runner) back() (*delivery, error) {
+	if len(r.History) == 0 {
+		return nil, fmt.Errorf("there is no previous item")
+	}
+	d, err := r.jump(r.History[len(r.History)-1], false)
+	if err != nil {
+		return nil, err
+	}
+	r.History = r.History[:len(r.History)-1]
+	return d, r.dump()
+}
+
+// Choose sends the answer action of the current item, the next item is decided by the answer.
+func (r *Runner) Choose(actionID uuid.UUID) error {
+	r.mu.Lock()
+	d, err := r.choose(actionID)
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+func (r *Runner) choose(actionID uuid.UUID) (*delivery, error) {
+	if r.State != Playing && r.State != Paused {
+		return nil, fmt.Errorf("runner is not running a session")
+	}
+	session, err := r.session()
+	if err != nil {
+		return nil, err
+	}
+	position, err := r.position(session)
+	if err != nil {
+		return nil, err
+	}
+	item := session.Items[position]
+	var answer *instruction.Action
+	for _, action := range item.Actions {
+		if action != nil && action.ID == actionID {
+			answer = action
+		}
+	}
+	if answer == nil {
+		return nil, fmt.Errorf("action %s is not found in the current item", actionID)
+	}
+
+	// the gap starts after the answer has been sent
+	r.cancelScheduled()
+	return &delivery{runID: r.RunID, session: session, item: item, action: answer, answer: true, generation: r.generation}, nil
+}
+
+// JumpTo goes to the item with the provided position.
+func (r *Runner) JumpTo(position int) error {
+	r.mu.Lock()
+	d, err := r.jumpTo(position)
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+func (r *Runner) jumpTo(position int) (*delivery, error) {
+	session, err := r.session()
+	if err != nil {
+		return nil, err
+	}
+	if position < 0 || position >= len(session.Items) || session.Items[position] == nil {
+		return nil, fmt.Errorf("position %d is out of the session's range [0, %d)", position, len(session.Items))
+	}
+	return r.jump(session.Items[position].ID, true)
+}
+
+// JumpToItem goes to the item with the provided ID.
+func (r *Runner) JumpToItem(itemID uuid.UUID) error {
+	r.mu.Lock()
+	d, err := r.jump(itemID, true)
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+// Ack acknowledges that the current item has been completed, the runner goes to the next item
+// if it's waiting for acknowledgements.
+func (r *Runner) Ack() error {
+	r.mu.Lock()
+	if r.State != Playing || !r.WaitAck {
+		r.mu.Unlock()
+		return fmt.Errorf("runner is not waiting for an acknowledgement")
+	}
+	d, err := r.advance()
+	err = r.dumpAfter(err)
+	r.mu.Unlock()
+
+	return r.deliver(d, err)
+}
+
+// Stop finishes the run.
+func (r *Runner) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reset()
+	return r.dump()
+}
+
+// Status returns the current state of the runner.
+func (r *Runner) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := Status{
+		State:      r.State,
+		RunID:      r.RunID,
+		SessionID:  r.SessionID,
+		ItemID:     r.ItemID,
+		Gap:        r.Gap,
+		WaitAck:    r.WaitAck,
+		Sent:       r.Sent,
+		Choice:     r.Choice,
+		StartedAt:  r.StartedAt,
+		LastSentAt: r.LastSentAt,
+		LastAction: r.LastAction,
+		LastError:  r.LastError,
+	}
+	if session, err := r.session(); err == nil {
+		status.ItemsCount = len(session.Items)
+		status.Position = itemIndex(session, r.ItemID)
+	}
+	return status
+}
+
+// jump moves to the item, while playing the item is sent immediately, while paused it's sent on resume.
+// The current item is remembered for going back if record is true.
+func (r *Runner) jump(itemID uuid.UUID, record bool) (*delivery, error) {
+	if r.State == Finished {
+		// going back to a finished run, e.g., to repeat the last item
+		r.State = Paused
+	}
+	if r.State != Playing && r.State != Paused {
+		return nil, fmt.Errorf("runner is not running a session")
+	}
+	session, err := r.session()
+	if err != nil {
+		return nil, err
+	}
+	if itemIndex(session, itemID) < 0 {
+		return nil, fmt.Errorf("item %s is not found in the session", itemID)
+	}
+
+	r.cancelScheduled()
+	if record {
+		r.History = append(r.History, r.ItemID)
+	}
+	r.ItemID = itemID
+	r.Sent = false
+	r.Choice = uuid.UUID{}
+	if r.State == Playing {
+		d, err := r.playCurrent()
+		return d, r.dumpAfter(err)
+	}
+	return nil, r.dump()
+}
+
+// advance goes to the next item or finishes the run after the last one.
+func (r *Runner) advance() (*delivery, error) {
+	r.cancelScheduled()
+	session, err := r.session()
+	if err != nil {
+		return nil, r.fail(err)
+	}
+	position, err := r.position(session)
+	if err != nil {
+		return nil, r.fail(err)
+	}
+	next, ok := nextItemID(session, position, r.Choice)
+	if !ok {
+		r.State = Finished
+		return nil, nil
+	}
+	r.History = append(r.History, r.ItemID)
+	r.ItemID = next
+	r.Sent = false
+	r.Choice = uuid.UUID{}
+	return r.playCurrent()
+}
+
+// playCurrent prepares the main action of the current item for sending. If the item has no actions,
+// the next step is scheduled immediately.
+func (r *Runner) playCurrent() (*delivery, error) {
+	session, err := r.session()
+	if err != nil {
+		return nil, r.fail(err)
+	}
+	position, err := r.position(session)
+	if err != nil {
+		return nil, r.fail(err)
+	}
+
+	r.cancelScheduled()
+	item := session.Items[position]
+	if len(item.Actions) > 0 && item.Actions[0] != nil {
+		return &delivery{runID: r.RunID, session: session, item: item, action: item.Actions[0], generation: r.generation}, nil
+	}
+	r.Sent = true
+	r.LastError = ""
+	r.scheduleNext()
+	return nil, nil
+}
+
+// deliver sends the prepared action without holding the lock and applies the result. The next step is
+// scheduled only if nothing has changed the runner meanwhile, e.g., the operator hasn't paused the run.
+func (r *Runner) deliver(d *delivery, stepErr error) error {
+	if d == nil || stepErr != nil {
+		return stepErr
+	}
+	sent, err := r.send(d.runID, d.session, d.item, d.action)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d.runID != r.RunID {
+		// the run has been stopped or another one has started
+		return err
+	}
+	current := d.generation == r.generation
+	if err != nil {
+		if !current {
+			return err
+		}
+		return r.dumpAfter(r.fail(err))
+	}
+
+	r.LastAction = sent
+	r.LastSentAt = time.Now()
+	if d.item.ID == r.ItemID {
+		if d.answer {
+			r.Choice = d.action.ID
+		} else {
+			r.Sent = true
+		}
+	}
+	if current {
+		r.LastError = ""
+		if r.State == Playing {
+			r.scheduleNext()
+		}
+	}
+	return r.dump()
+}
+
+// scheduleNext arranges going to the next item after the gap, when acknowledgements aren't used.
+func (r *Runner) scheduleNext() {
+	r.cancelScheduled()
+	if r.WaitAck {
+		return
+	}
+
+	generation := r.generation
+	r.timer = time.AfterFunc(time.Duration(r.Gap)*time.Second, func() {
+		r.mu.Lock()
+		if generation != r.generation || r.State != Playing {
+			r.mu.Unlock()
+			return
+		}
+		d, err := r.advance()
+		err = r.dumpAfter(err)
+		r.mu.Unlock()
+
+		// errors are kept in LastError and shown to the operator by the status
+		_ = r.deliver(d, err)
+	})
+}
+
+func (r *Runner) cancelScheduled() {
+	r.generation++
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// fail pauses the run, so the operator can fix the problem, e.g., reconnect the robot, and resume.
+func (r *Runner) fail(err error) error {
+	r.cancelScheduled()
+	r.State = Paused
+	r.LastError = err.Error()
+	return err
+}
+
+func (r *Runner) reset() {
+	r.cancelScheduled()
+	r.State = Idle
+	r.RunID = uuid.UUID{}
+	r.SessionID = uuid.UUID{}
+	r.ItemID = uuid.UUID{}
+	r.Sent = false
+	r.Choice = uuid.UUID{}
+	r.History = nil
+	r.LastAction = nil
+	r.LastError = ""
+}
+
+func (r *Runner) session() (*store.Session, error) {
+	if (r.SessionID == uuid.UUID{}) {
+		return nil, fmt.Errorf("no session is being run")
+	}
+	return r.sessions.Get(r.SessionID.String())
+}
+
+// position returns the index of the current item, which changes when items are added, removed or reordered
+// during the run.
+func (r *Runner) position(session *store.Session) (int, error) {
+	i := itemIndex(session, r.ItemID)
+	if i < 0 {
+		return 0, fmt.Errorf("the current item %s has been removed from the session", r.ItemID)
+	}
+	return i, nil
+}
+
+// nextItemID returns the item following the one at the position according to the session's graph.
+func nextItemID(session *store.Session, position int, choice uuid.UUID) (uuid.UUID, bool) {
+	next, ok := session.Next(position, choice)
+	if !ok || session.Items[next] == nil {
+		return uuid.UUID{}, false
+	}
+	return session.Items[next].ID, true
+}
+
+func itemIndex(session *store.Session, itemID uuid.UUID) int {
+	for i, item := range session.Items {
+		if item != nil && item.ID == itemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dumpAfter saves the state even if the step has failed, because the failure pauses the run.
+func (r *Runner) dumpAfter(stepErr error) error {
+	if err := r.dump(); err != nil {
+		return err
+	}
+	return stepErr
+}
+
+func (r *Runner) dump() error {
+	f, err := os.Create(r.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(r)
+}
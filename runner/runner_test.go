@@ -0,0 +1,304 @@
+package runner
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// fakeRobot records sent actions instead of sending them to the robot.
+type fakeRobot struct {
+	mu      sync.Mutex
+	sent    []string
+	err     error
+	release chan struct{} // if set, sending waits until it's closed
+}
+
+func (f *fakeRobot) send(runID uuid.UUID, session *store.Session, item *store.SessionItem, action *instruction.Action) (*instruction.Action, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.sent = append(f.sent, action.SayItem.Phrase)
+	return action, nil
+}
+
+func (f *fakeRobot) phrases() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.sent...)
+}
+
+func say(phrase string) *instruction.Action {
+	return &instruction.Action{ID: uuid.New(), SayItem: &instruction.Say{ID: uuid.New(), Phrase: phrase}}
+}
+
+// newTestRunner creates a runner of a session with the items A, B and C, where B has two answers.
+func newTestRunner(t *testing.T) (*Runner, *fakeRobot, *store.Sessions, *store.Session) {
+	t.Helper()
+	dir := t.TempDir()
+	sessions, err := store.NewSessionStore(filepath.Join(dir, "sessions.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &store.Session{Name: "Run", Items: []*store.SessionItem{
+		{ID: uuid.New(), Title: "A", Actions: []*instruction.Action{say("a")}},
+		{ID: uuid.New(), Title: "B", Actions: []*instruction.Action{say("b"), say("yes"), say("no")}},
+		{ID: uuid.New(), Title: "C", Actions: []*instruction.Action{say("c")}},
+	}}
+	if err = sessions.Create(session, ""); err != nil {
+		t.Fatal(err)
+	}
+	robot := &fakeRobot{}
+	r, err := New(filepath.Join(dir, "runner.json"), sessions, robot.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Stop() })
+	return r, robot, sessions, session
+}
+
+func assertSent(t *testing.T, robot *fakeRobot, want ...string) {
+	t.Helper()
+	if got := robot.phrases(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+}
+
+func assertItem(t *testing.T, r *Runner, state State, title string, session *store.Session) {
+	t.Helper()
+	status := r.Status()
+	var got string
+	if status.Position >= 0 && status.Position < len(session.Items) {
+		got = session.Items[status.Position].Title
+	}
+	if status.State != state || got != title {
+		t.Fatalf("runner is %s at %q, want %s at %q", status.State, got, state, title)
+	}
+}
+
+// waitFor polls the runner until the condition holds, timers run in their own goroutines.
+func waitFor(t *testing.T, r *Runner, condition func(Status) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition(r.Status()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, the runner is %+v", r.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunner_Controls(t *testing.T) {
+	r, robot, _, session := newTestRunner(t)
+
+	if err := r.Start(session.ID.String(), uuid.New(), 0, true); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Playing, "A", session)
+	assertSent(t, robot, "a")
+
+	if err := r.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Playing, "B", session)
+	assertSent(t, robot, "a", "b")
+
+	if err := r.Choose(session.Items[1].Actions[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if status := r.Status(); status.Choice != session.Items[1].Actions[1].ID || status.LastAction.SayItem.Phrase != "yes" {
+		t.Fatalf("the answer isn't recorded: %+v", status)
+	}
+
+	// items aren't sent while paused, the current one is sent on resume
+	if err := r.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Ack(); err == nil {
+		t.Fatal("a paused runner accepted an acknowledgement")
+	}
+	if err := r.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Paused, "C", session)
+	assertSent(t, robot, "a", "b", "yes")
+	if err := r.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	assertSent(t, robot, "a", "b", "yes", "c")
+
+	if err := r.Back(); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Playing, "B", session)
+	assertSent(t, robot, "a", "b", "yes", "c", "b")
+
+	if err := r.JumpTo(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.JumpToItem(session.Items[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Playing, "A", session)
+	assertSent(t, robot, "a", "b", "yes", "c", "b", "c", "a")
+	if err := r.JumpTo(3); err == nil {
+		t.Fatal("jumped out of the session's range")
+	}
+
+	// going back follows the history of jumps
+	for _, title := range []string{"C", "B"} {
+		if err := r.Back(); err != nil {
+			t.Fatal(err)
+		}
+		assertItem(t, r, Playing, title, session)
+	}
+
+	if err := r.JumpTo(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Skip(); err == nil {
+		t.Fatal("skipped the last item")
+	}
+	if err := r.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Finished, "C", session)
+
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if status := r.Status(); status.State != Idle || (status.ItemID != uuid.UUID{}) {
+		t.Fatalf("the stopped runner is %+v", status)
+	}
+}
+
+func TestRunner_FollowsItemWhenSessionChanges(t *testing.T) {
+	r, robot, sessions, session := newTestRunner(t)
+
+	if err := r.Start(session.ID.String(), uuid.New(), 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an item is inserted before the current one
+	updated, err := sessions.Get(session.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []*store.SessionItem{{ID: uuid.New(), Title: "Intro", Actions: []*instruction.Action{say("intro")}}}
+	updated.Items = append(items, updated.Items...)
+	if err = sessions.Update(updated, ""); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Playing, "B", updated)
+	if r.Status().Position != 2 {
+		t.Fatalf("the position is %d, want 2", r.Status().Position)
+	}
+
+	if err = r.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	assertItem(t, r, Playing, "C", updated)
+	assertSent(t, robot, "a", "b", "c")
+}
+
+func TestRunner_Gap(t *testing.T) {
+	r, robot, _, session := newTestRunner(t)
+
+	if err := r.Start(session.ID.String(), uuid.New(), 0, false); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, r, func(s Status) bool { return s.State == Finished })
+	assertSent(t, robot, "a", "b", "c")
+
+	// a pause cancels going to the next item
+	if err := r.Start(session.ID.String(), uuid.New(), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1200 * time.Millisecond)
+	assertItem(t, r, Paused, "A", session)
+
+	// the gap starts over after resuming
+	if err := r.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, r, func(s Status) bool { return s.Position == 1 })
+	assertSent(t, robot, "a", "b", "c", "a", "b")
+}
+
+func TestRunner_SendFailurePauses(t *testing.T) {
+	r, robot, _, session := newTestRunner(t)
+	robot.err = fmt.Errorf("robot is offline")
+
+	if err := r.Start(session.ID.String(), uuid.New(), 0, true); err == nil {
+		t.Fatal("the failure isn't returned")
+	}
+	if status := r.Status(); status.State != Paused || status.Sent || status.LastError != "robot is offline" {
+		t.Fatalf("unexpected status after the failure: %+v", status)
+	}
+
+	robot.mu.Lock()
+	robot.err = nil
+	robot.mu.Unlock()
+	if err := r.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if status := r.Status(); status.State != Playing || !status.Sent || status.LastError != "" {
+		t.Fatalf("unexpected status after resuming: %+v", status)
+	}
+	assertSent(t, robot, "a")
+}
+
+func TestRunner_SendsWithoutLock(t *testing.T) {
+	r, robot, _, session := newTestRunner(t)
+	robot.release = make(chan struct{})
+
+	done := make(chan error)
+	go func() { done <- r.Start(session.ID.String(), uuid.New(), 0, true) }()
+
+	// the runner responds and can be paused while the action is being sent
+	waitFor(t, r, func(s Status) bool { return s.State == Playing })
+	if err := r.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	close(robot.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if status := r.Status(); status.State != Paused || !status.Sent {
+		t.Fatalf("unexpected status after sending: %+v", status)
+	}
+	assertSent(t, robot, "a")
+}
+
+func TestNew_LoadsPlayingRunPaused(t *testing.T) {
+	r, robot, sessions, session := newTestRunner(t)
+	if err := r.Start(session.ID.String(), uuid.New(), 0, true); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := New(r.filepath, sessions, robot.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := loaded.Status(); status.State != Paused || status.ItemID != session.Items[0].ID || !status.Sent {
+		t.Fatalf("unexpected loaded status: %+v", status)
+	}
+}
@@ -0,0 +1,309 @@
+package script
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	_ "image/gif" // decoders of formats which are embedded besides JPEG and PNG
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// printLine is an instruction of an action on paper.
+type printLine struct {
+	Kind  string
+	Text  string
+	Delay int64
+	Image template.URL // a data URI of the image
+}
+
+type printVariant struct {
+	Number int
+	Lines  []*printLine
+}
+
+type printAction struct {
+	Main     bool
+	Lines    []*printLine
+	Variants []*printVariant
+	Goto     string
+	Duration string
+	Mismatch bool // speech and motion lengths differ a lot
+}
+
+type printItem struct {
+	Number   int
+	Title    string
+	Duration string
+	Actions  []*printAction
+	Next     string
+	End      bool
+}
+
+// WriteHTML renders the session as a self-contained HTML document for printing. Thumbnails of uploaded images
+// are embedded as data URIs, so the document can be saved and printed without the server.
+func WriteHTML(w io.Writer, session *store.Session) error {
+	titles := map[uuid.UUID]string{}
+	for _, item := range session.Items {
+		if item != nil {
+			titles[item.ID] = item.Title
+		}
+	}
+
+	items := []*printItem{}
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		pi := &printItem{
+			Number:   len(items) + 1,
+			Title:    item.Title,
+			Duration: formatDuration(item.Duration()),
+			Next:     titles[item.Next],
+			End:      item.End,
+		}
+		for i, action := range item.Actions {
+			if action == nil {
+				continue
+			}
+			d := store.EstimateAction(action)
+			pa := &printAction{
+				Main:     i == 0,
+				Lines:    printLines(action),
+				Duration: formatDuration(d.Duration),
+				Mismatch: d.Mismatch,
+			}
+			if action.VariantsItem != nil {
+				for _, e := range action.VariantsItem.Entries {
+					if e != nil {
+						pa.Variants = append(pa.Variants, &printVariant{Number: len(pa.Variants) + 1, Lines: printLines(e.Action)})
+					}
+				}
+			}
+			for _, b := range item.Branches {
+				if b != nil && b.ActionID == action.ID {
+					pa.Goto = titles[b.NextItemID]
+				}
+			}
+			pi.Actions = append(pi.Actions, pa)
+		}
+		items = append(items, pi)
+	}
+
+	return printTemplate.Execute(w, map[string]interface{}{
+		"Session":  session,
+		"Items":    items,
+		"Duration": formatDuration(session.Duration()),
+	})
+}
+
+func printLines(a *instruction.Action) []*printLine {
+	lines := []*printLine{}
+	if a == nil {
+		return lines
+	}
+	if say := a.SayItem; say != nil && (say.Phrase != "" || say.FilePath != "") {
+		text := say.Phrase
+		if text == "" {
+			text = filepath.Base(say.FilePath)
+		}
+		lines = append(lines, &printLine{Kind: "Say", Text: text, Delay: say.Delay})
+		languages := make([]string, 0, len(say.Translations))
+		for lang := range say.Translations {
+			languages = append(languages, lang)
+		}
+		sort.Strings(languages)
+		for _, lang := range languages {
+			if t := say.Translations[lang]; t != nil && t.Phrase != "" {
+				lines = append(lines, &printLine{Kind: "Say (" + lang + ")", Text: t.Phrase})
+			}
+		}
+	}
+	if move := a.MoveItem; move != nil && move.Name != "" {
+		text := move.Name
+		if move.Speed != 0 {
+			text = fmt.Sprintf("%s at %v× speed", move.Name, move.Speed)
+		}
+		lines = append(lines, &printLine{Kind: "Move", Text: text, Delay: move.Delay})
+	}
+	if image := a.ImageItem; image != nil && image.FilePath != "" {
+		line := &printLine{Kind: "Image", Text: image.Name, Delay: image.Delay}
+		if uri, err := dataURI(image.FilePath); err == nil {
+			line.Image = uri
+		} else if os.IsNotExist(err) {
+			line.Text += " (the file is missing)"
+		} else {
+			line.Text += " (the image can't be shown)"
+		}
+		lines = append(lines, line)
+	}
+	if url := a.URLItem; url != nil && url.URL != "" {
+		lines = append(lines, &printLine{Kind: "URL", Text: url.URL, Delay: url.Delay})
+	}
+	if stop := a.StopItem; stop != nil {
+		text := "stop the robot"
+		if stop.ResetPosture {
+			text = "stop the robot and reset the posture"
+		}
+		lines = append(lines, &printLine{Kind: "Stop", Text: text, Delay: stop.Delay})
+	}
+	return lines
+}
+
+// Images are embedded as thumbnails, larger ones would make the document heavy for no use on paper.
+const (
+	maxThumbnailSide = 600      // pixels, enough for the printed size of 5×4 cm
+	maxImageFileSize = 20 << 20 // bytes, bigger files aren't embedded
+	maxImagePixels   = 50e6     // pixels of the original image, bigger images aren't decoded
+)
+
+// dataURI encodes a thumbnail of the uploaded image as a data URI. Only images from uploads are embedded.
+func dataURI(fpath string) (template.URL, error) {
+	if !store.IsUploadPath(fpath) {
+		return "", fmt.Errorf("%q isn't in uploads", fpath)
+	}
+	if !strings.HasPrefix(mime.TypeByExtension(filepath.Ext(fpath)), "image/") {
+		return "", fmt.Errorf("%q isn't an image", fpath)
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxImageFileSize {
+		return "", fmt.Errorf("%q is too big", fpath)
+	}
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", err
+	}
+	if float64(config.Width)*float64(config.Height) > maxImagePixels {
+		return "", fmt.Errorf("%q is too big", fpath)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	img, format, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+
+	b := &bytes.Buffer{}
+	mimeType := "image/png"
+	if format == "jpeg" {
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(b, thumbnail(img, maxThumbnailSide), &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(b, thumbnail(img, maxThumbnailSide))
+	}
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(b.Bytes())), nil
+}
+
+// thumbnail scales the image down to fit a square of the side, every pixel of the thumbnail is the average
+// of the pixels it covers. Smaller images are returned as they are.
+func thumbnail(img image.Image, side int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= side && h <= side {
+		return img
+	}
+	scale := math.Max(float64(w), float64(h)) / float64(side)
+	tw, th := int(math.Max(1, math.Round(float64(w)/scale))), int(math.Max(1, math.Round(float64(h)/scale)))
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*h/th, (ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*w/tw, (tx+1)*w/tw
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			thumb.SetRGBA(tx, ty, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+	return thumb
+}
+
+// formatDuration formats seconds as m:ss.
+func formatDuration(seconds float64) string {
+	s := int(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+var printTemplate = template.Must(template.New("session").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Session.Name}}</title>
+<style>
+body { font-family: sans-serif; font-size: 11pt; margin: 2cm; color: #000; }
+h1 { margin-bottom: 0.2em; }
+.meta { color: #555; margin-bottom: 1.5em; }
+.description { white-space: pre-line; }
+.item { border-top: 1px solid #999; padding: 0.5em 0; page-break-inside: avoid; }
+.item h2 { font-size: 13pt; margin: 0.3em 0; }
+.duration { float: right; font-weight: normal; color: #555; }
+.action { margin: 0.4em 0 0.4em 1em; }
+.action.main { font-size: 12pt; }
+.label { display: inline-block; min-width: 4.5em; color: #555; }
+.delay, .goto, .flow { color: #555; font-style: italic; }
+.variants { margin-left: 1.5em; }
+.warning { color: #a00; }
+img { max-width: 5cm; max-height: 4cm; display: block; margin: 0.2em 0 0.2em 4.5em; }
+@media print {
+  body { margin: 0; }
+  @page { margin: 1.5cm; }
+}
+</style>
+</head>
+<body>
+<h1>{{.Session.Name}}</h1>
+<div class="meta">{{len .Items}} items, estimated duration {{.Duration}}</div>
+{{if .Session.Description}}<p class="description">{{.Session.Description}}</p>{{end}}
+{{range .Items}}
+<div class="item">
+<h2>{{.Number}}. {{.Title}} <span class="duration">{{.Duration}}</span></h2>
+{{range .Actions}}
+<div class="action{{if .Main}} main{{end}}"><span class="duration">{{.Duration}}</span>
+{{if not .Main}}<div class="label">Answer</div>{{end}}
+{{template "lines" .Lines}}
+{{if .Variants}}<div class="variants">{{range .Variants}}<div>Variant {{.Number}}:</div>{{template "lines" .Lines}}{{end}}</div>{{end}}
+{{if .Mismatch}}<div class="warning">the phrase and the move differ a lot in length</div>{{end}}
+{{if .Goto}}<div class="goto">then go to “{{.Goto}}”</div>{{end}}
+</div>
+{{end}}
+{{if .End}}<div class="flow">the session ends here</div>{{else if .Next}}<div class="flow">next: “{{.Next}}”</div>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+{{define "lines"}}{{range .}}<div><span class="label">{{.Kind}}</span> {{.Text}}{{if .Delay}} <span class="delay">after {{.Delay}} s</span>{{end}}{{if .Image}}<img src="{{.Image}}" alt="{{.Text}}">{{end}}</div>
+{{end}}{{end}}
+`))
@@ -0,0 +1,82 @@
+package script
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/internal/testdir"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+func TestWriteHTML_Images(t *testing.T) {
+	testdir.WithUploads(t, store.UploadsDir, "notes.txt")
+
+	big := image.NewRGBA(image.Rect(0, 0, 2000, 1000))
+	for x := 0; x < 2000; x++ {
+		big.SetRGBA(x, x/2, color.RGBA{R: 255, A: 255})
+	}
+	f, err := os.Create(filepath.Join(store.UploadsDir, "big.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, big); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err = ioutil.WriteFile("secret.png", []byte("outside of uploads"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imageAction := func(fpath string) *instruction.Action {
+		return &instruction.Action{ID: uuid.New(), ImageItem: &instruction.ShowImage{ID: uuid.New(), Name: filepath.Base(fpath), FilePath: fpath}}
+	}
+	session := &store.Session{ID: uuid.New(), Name: "Images", Items: []*store.SessionItem{{ID: uuid.New(), Title: "A", Actions: []*instruction.Action{
+		imageAction("data/uploads/big.png"),
+		imageAction("secret.png"),
+		imageAction("/etc/passwd"),
+		imageAction("data/uploads/notes.txt"),
+		imageAction("data/uploads/missing.png"),
+	}}}}
+
+	b := &bytes.Buffer{}
+	if err = WriteHTML(b, session); err != nil {
+		t.Fatal(err)
+	}
+	doc := html.UnescapeString(b.String())
+
+	uris := regexp.MustCompile(`src="data:image/png;base64,([^"]+)"`).FindAllStringSubmatch(doc, -1)
+	if len(uris) != 1 {
+		t.Fatalf("want one embedded image, got %d", len(uris))
+	}
+	data, err := base64.StdEncoding.DecodeString(uris[0][1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != maxThumbnailSide || thumb.Height != maxThumbnailSide/2 {
+		t.Fatalf("the thumbnail is %dx%d, want %dx%d", thumb.Width, thumb.Height, maxThumbnailSide, maxThumbnailSide/2)
+	}
+
+	if n := strings.Count(doc, "(the image can't be shown)"); n != 3 {
+		t.Fatalf("want 3 images which can't be shown, got %d", n)
+	}
+	if !strings.Contains(doc, "missing.png (the file is missing)") {
+		t.Fatal("the missing file isn't reported")
+	}
+}
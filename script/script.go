@@ -0,0 +1,408 @@
+/*
+Package script reads and writes sessions in a human-editable Markdown-like format:
+
+	# Session name
+	> Description of the session,
+	> any text before the first item.
+	start: Greeting
+
+	## Greeting
+	- say: Tere! Kuidas läheb?
+	  language: et
+	  translation en: Hi! How are you?
+	  move: Hey_1
+	  speed: 1.5
+	- say: Hästi
+	  goto: Farewell
+	next: Questions
+
+	## Farewell
+	- say: Head aega!
+	  audio: uploads/bye.mp3
+	  image: uploads/bye.png
+	  delay: 2
+	- stop: reset
+	end
+
+Items are headings, actions are list entries, every line of an action adds an instruction (say, move, image, url,
+stop) or sets an option of the preceding instruction (delay, audio, language, translation, speed). Transitions
+between items refer to items by their titles: next and end are set for the item, goto adds a branch for the action.
+Description lines start with > so they are kept as they are, including blank ones and ones looking like directives;
+other lines before the first item are read as the description too. Other blank lines and comments <!-- ... --> are
+ignored. Files must be uploaded before the import and referred to as uploads/<name>.
+
+Sessions can also be rendered as printable HTML documents with WriteHTML.
+*/
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// MoveResolver finds a move of the library by its name, e.g., store.Moves.
+type MoveResolver interface {
+	GetByName(name string) (*instruction.Move, error)
+}
+
+// Error is a problem at a line of the script.
+type Error struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Errors are all problems found in the script.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// reference is a title of an item which must be resolved to the item's ID after all items are parsed.
+type reference struct {
+	line  int
+	title string
+	id    *uuid.UUID
+}
+
+type parser struct {
+	moves      MoveResolver
+	session    *store.Session
+	item       *store.SessionItem
+	action     *instruction.Action
+	current    string // the last instruction of the action, options are applied to it
+	sayLine    int    // the line of the phrase of the action
+	references []*reference
+	errors     Errors
+	line       int
+}
+
+// Parse reads a session from the script, moves are resolved by names with the resolver. The session gets new IDs.
+// All problems found in the script are returned as Errors.
+func Parse(r io.Reader, moves MoveResolver) (*store.Session, error) {
+	p := &parser{
+		moves:   moves,
+		session: &store.Session{ID: uuid.Must(uuid.NewRandom()), Items: []*store.SessionItem{}},
+	}
+	description := []string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.line++
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		line := strings.TrimSpace(raw)
+		if p.item == nil && strings.HasPrefix(line, ">") {
+			// the description is kept as it is, the prefix is "> " or ">" for blank lines
+			text := strings.TrimLeft(strings.TrimRight(scanner.Text(), "\r"), " \t")
+			description = append(description, strings.TrimPrefix(text[1:], " "))
+			continue
+		}
+		if line == "" || (strings.HasPrefix(line, "<!--") && strings.HasSuffix(line, "-->")) {
+			continue
+		}
+		indented := raw != line && (strings.HasPrefix(raw, " ") || strings.HasPrefix(raw, "\t"))
+
+		switch {
+		case strings.HasPrefix(line, "## "):
+			p.startItem(strings.TrimSpace(line[3:]))
+		case strings.HasPrefix(line, "# "):
+			if p.session.Name != "" || p.item != nil {
+				p.fail("the session name must be given once before items")
+				continue
+			}
+			p.session.Name = strings.TrimSpace(line[2:])
+		case p.item == nil:
+			if key, value := split(line); key == "start" {
+				p.refer(value, &p.session.StartItemID)
+				continue
+			}
+			description = append(description, line)
+		case strings.HasPrefix(line, "- ") && !indented:
+			p.startAction()
+			p.parseInstruction(strings.TrimSpace(line[2:]))
+		case indented && p.action != nil:
+			p.parseInstruction(line)
+		default:
+			p.parseItemLine(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p.finishAction()
+
+	p.session.Description = strings.Join(description, "\n")
+	if p.session.Name == "" {
+		p.errors = append(p.errors, &Error{Line: 1, Message: "the session name is missing, add a line # <name>"})
+	}
+	p.resolveReferences()
+
+	if len(p.errors) > 0 {
+		sort.SliceStable(p.errors, func(i, j int) bool { return p.errors[i].Line < p.errors[j].Line })
+		return nil, p.errors
+	}
+	return p.session, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{Line: p.line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) startItem(title string) {
+	p.finishAction()
+	if title == "" {
+		p.fail("the item title is empty")
+	}
+	p.item = &store.SessionItem{
+		ID:       uuid.Must(uuid.NewRandom()),
+		Title:    title,
+		Actions:  []*instruction.Action{},
+		Branches: []*store.Branch{},
+	}
+	p.session.Items = append(p.session.Items, p.item)
+	p.action = nil
+}
+
+func (p *parser) startAction() {
+	p.finishAction()
+	p.action = &instruction.Action{ID: uuid.Must(uuid.NewRandom())}
+	p.item.Actions = append(p.item.Actions, p.action)
+	p.current = ""
+	p.sayLine = 0
+}
+
+// finishAction checks the action when all its lines are parsed.
+func (p *parser) finishAction() {
+	if p.action == nil || p.action.SayItem == nil || p.action.SayItem.IsValid() {
+		return
+	}
+	p.errors = append(p.errors, &Error{Line: p.sayLine, Message: "the phrase is empty, add a phrase, audio or a translation"})
+}
+
+func (p *parser) parseItemLine(line string) {
+	key, value := split(line)
+	switch key {
+	case "next":
+		p.refer(value, &p.item.Next)
+	case "end":
+		if value != "" {
+			p.fail("end doesn't take a value")
+		}
+		p.item.End = true
+	default:
+		p.fail("unexpected line %q, actions must start with - and their lines must be indented", line)
+	}
+}
+
+func (p *parser) parseInstruction(line string) {
+	key, value := split(line)
+	fields := strings.Fields(key)
+	if len(fields) == 0 {
+		p.fail("unexpected line %q", line)
+		return
+	}
+
+	a := p.action
+	switch fields[0] {
+	case "say":
+		if a.SayItem != nil {
+			p.fail("the action already has a phrase")
+			return
+		}
+		a.SayItem = &instruction.Say{ID: uuid.Must(uuid.NewRandom()), Phrase: value}
+		p.sayLine = p.line
+	case "move":
+		if a.MoveItem != nil {
+			p.fail("the action already has a move")
+			return
+		}
+		move, err := p.moves.GetByName(value)
+		if err != nil {
+			p.fail("move %q isn't in the library", value)
+			return
+		}
+		a.MoveItem = &instruction.Move{
+			ID:       uuid.Must(uuid.NewRandom()),
+			Name:     move.Name,
+			FilePath: move.FilePath,
+			Group:    move.Group,
+		}
+	case "image":
+		if a.ImageItem != nil {
+			p.fail("the action already has an image")
+			return
+		}
+		fpath, err := store.UploadPath(value)
+		if err != nil {
+			p.fail("image: %v", err)
+			return
+		}
+		a.ImageItem = &instruction.ShowImage{
+			ID:       uuid.Must(uuid.NewRandom()),
+			Name:     path.Base(fpath),
+			FilePath: fpath,
+		}
+	case "url":
+		if a.URLItem != nil {
+			p.fail("the action already has a URL")
+			return
+		}
+		a.URLItem = &instruction.ShowURI{ID: uuid.Must(uuid.NewRandom()), Name: value, URL: value}
+	case "stop":
+		if a.StopItem != nil {
+			p.fail("the action already has a stop")
+			return
+		}
+		if value != "" && value != "reset" {
+			p.fail("stop can only be followed by reset")
+		}
+		a.StopItem = &instruction.Stop{ID: uuid.Must(uuid.NewRandom()), Name: "Stop", ResetPosture: value == "reset"}
+	case "goto":
+		branch := &store.Branch{ActionID: a.ID}
+		p.item.Branches = append(p.item.Branches, branch)
+		p.refer(value, &branch.NextItemID)
+		return
+	default:
+		p.parseOption(fields, value)
+		return
+	}
+	p.current = fields[0]
+}
+
+// parseOption sets an option of the last instruction of the action.
+func (p *parser) parseOption(fields []string, value string) {
+	a := p.action
+	switch fields[0] {
+	case "delay":
+		delay, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || delay < 0 {
+			p.fail("delay must be a whole number of seconds, got %q", value)
+			return
+		}
+		switch p.current {
+		case "say":
+			a.SayItem.Delay = delay
+		case "move":
+			a.MoveItem.Delay = delay
+		case "image":
+			a.ImageItem.Delay = delay
+		case "url":
+			a.URLItem.Delay = delay
+		case "stop":
+			a.StopItem.Delay = delay
+		default:
+			p.fail("delay must follow an instruction")
+		}
+	case "speed":
+		if p.current != "move" {
+			p.fail("speed must follow a move")
+			return
+		}
+		speed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !instruction.IsValidSpeed(speed) {
+			p.fail("speed must be a number from %v to %v, got %q", instruction.MinSpeed, instruction.MaxSpeed, value)
+			return
+		}
+		a.MoveItem.Speed = speed
+	case "audio", "language", "translation":
+		if p.current != "say" {
+			p.fail("%s must follow a phrase", fields[0])
+			return
+		}
+		p.parseSayOption(fields, value)
+	default:
+		p.fail("unknown key %q", fields[0])
+	}
+}
+
+func (p *parser) parseSayOption(fields []string, value string) {
+	say := p.action.SayItem
+	switch fields[0] {
+	case "audio":
+		fpath, err := store.UploadPath(value)
+		if err != nil {
+			p.fail("audio: %v", err)
+			return
+		}
+		say.FilePath = fpath
+	case "language":
+		say.Language = instruction.NormalizeLanguage(value)
+	case "translation":
+		// translation <language>: <phrase> or translation <language> audio: <path>
+		if len(fields) < 2 || len(fields) > 3 || (len(fields) == 3 && fields[2] != "audio") {
+			p.fail("expected translation <language>: <phrase> or translation <language> audio: <path>")
+			return
+		}
+		lang := instruction.NormalizeLanguage(fields[1])
+		if say.Translations == nil {
+			say.Translations = map[string]*instruction.Translation{}
+		}
+		t := say.Translations[lang]
+		if t == nil {
+			t = &instruction.Translation{}
+			say.Translations[lang] = t
+		}
+		if len(fields) == 3 {
+			fpath, err := store.UploadPath(value)
+			if err != nil {
+				p.fail("translation audio: %v", err)
+				return
+			}
+			t.FilePath = fpath
+		} else {
+			t.Phrase = value
+		}
+	}
+}
+
+func (p *parser) refer(title string, id *uuid.UUID) {
+	if title == "" {
+		p.fail("the item title is empty")
+		return
+	}
+	p.references = append(p.references, &reference{line: p.line, title: title, id: id})
+}
+
+func (p *parser) resolveReferences() {
+	items := map[string][]*store.SessionItem{}
+	for _, item := range p.session.Items {
+		items[item.Title] = append(items[item.Title], item)
+	}
+	for _, ref := range p.references {
+		switch found := items[ref.title]; len(found) {
+		case 0:
+			p.errors = append(p.errors, &Error{Line: ref.line, Message: fmt.Sprintf("item %q not found", ref.title)})
+		case 1:
+			*ref.id = found[0].ID
+		default:
+			p.errors = append(p.errors, &Error{Line: ref.line, Message: fmt.Sprintf("several items are titled %q", ref.title)})
+		}
+	}
+}
+
+// split parses a line "key: value", the key is the whole line if there is no colon.
+func split(line string) (string, string) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return strings.TrimSpace(line), ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+}
@@ -0,0 +1,143 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/internal/testdir"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+type testMoves map[string]*instruction.Move
+
+func (m testMoves) GetByName(name string) (*instruction.Move, error) {
+	move, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("move %q not found", name)
+	}
+	return move, nil
+}
+
+var moves = testMoves{
+	"Hey_1": {ID: uuid.New(), Name: "Hey_1", Group: "Greetings", FilePath: "data/pepper-core-anims-master/Hey_1.qianim"},
+}
+
+func TestWriteParse_RoundTrip(t *testing.T) {
+	testdir.WithUploads(t, store.UploadsDir, "hi.mp3", "hi_en.mp3", "hi.png")
+
+	greeting, farewell := uuid.New(), uuid.New()
+	actionID := uuid.New()
+	session := &store.Session{
+		ID:          uuid.New(),
+		Name:        "Round trip",
+		Description: "First line\n\nstart: not a directive\n# not a name\n  indented",
+		StartItemID: greeting,
+		Items: []*store.SessionItem{
+			{
+				ID:    greeting,
+				Title: "Greeting",
+				Actions: []*instruction.Action{
+					{ID: actionID, SayItem: &instruction.Say{
+						ID: uuid.New(), Phrase: "Tere!", FilePath: "data/uploads/hi.mp3", Language: "et", Delay: 1,
+						Translations: map[string]*instruction.Translation{
+							"en": {Phrase: "Hi!", FilePath: "data/uploads/hi_en.mp3"},
+						},
+					}, MoveItem: &instruction.Move{ID: uuid.New(), Name: "Hey_1", Speed: 1.5}},
+					{ID: uuid.New(), ImageItem: &instruction.ShowImage{ID: uuid.New(), FilePath: "data/uploads/hi.png", Delay: 2}},
+				},
+				Branches: []*store.Branch{{ActionID: actionID, NextItemID: farewell}},
+				Next:     farewell,
+			},
+			{
+				ID:    farewell,
+				Title: "Farewell",
+				Actions: []*instruction.Action{
+					{ID: uuid.New(), SayItem: &instruction.Say{ID: uuid.New(), Phrase: "Head aega!"}},
+					{ID: uuid.New(), StopItem: &instruction.Stop{ID: uuid.New(), ResetPosture: true}},
+				},
+				End: true,
+			},
+		},
+	}
+
+	first := &bytes.Buffer{}
+	if err := Write(first, session); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(bytes.NewReader(first.Bytes()), moves)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, first)
+	}
+	if parsed.Description != session.Description {
+		t.Fatalf("description %q, want %q", parsed.Description, session.Description)
+	}
+	second := &bytes.Buffer{}
+	if err = Write(second, parsed); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Fatalf("the script changes after the round trip:\n%s\nwant:\n%s", second, first)
+	}
+
+	if parsed.StartItemID != parsed.Items[0].ID || parsed.Items[0].Next != parsed.Items[1].ID {
+		t.Fatal("transitions aren't resolved")
+	}
+	if b := parsed.Items[0].Branches; len(b) != 1 || b[0].ActionID != parsed.Items[0].Actions[0].ID || b[0].NextItemID != parsed.Items[1].ID {
+		t.Fatalf("unexpected branches %+v", b)
+	}
+	if move := parsed.Items[0].Actions[0].MoveItem; move.FilePath != moves["Hey_1"].FilePath || move.Speed != 1.5 {
+		t.Fatalf("unexpected move %+v", move)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	testdir.WithUploads(t, store.UploadsDir, "hi.mp3")
+
+	tests := []struct {
+		name   string
+		script string
+		line   int
+		want   string
+	}{
+		{"missing file", "# S\n\n## A\n- say: hi\n  audio: uploads/missing.mp3\n", 5, "not found"},
+		{"absolute path", "# S\n\n## A\n- image: /etc/passwd\n", 4, "isn't in uploads"},
+		{"parent directory", "# S\n\n## A\n- say: hi\n  audio: uploads/../../sessions.json\n", 5, "isn't a file directly in uploads"},
+		{"translation audio", "# S\n\n## A\n- say: hi\n  translation en audio: data/sessions.json\n", 5, "isn't in uploads"},
+		{"empty phrase", "# S\n\n## A\n- say:\n  delay: 1\n- say: ok\n", 4, "the phrase is empty"},
+		{"empty phrase at the end", "# S\n\n## A\n- say: ok\n- move: Hey_1\n  say:\n", 6, "the phrase is empty"},
+		{"unknown move", "# S\n\n## A\n- move: Nope\n", 4, "isn't in the library"},
+		{"unknown item", "# S\nstart: B\n\n## A\n- say: hi\n", 2, `item "B" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.script), moves)
+			errs, ok := err.(Errors)
+			if !ok || len(errs) != 1 {
+				t.Fatalf("want one error, got %v", err)
+			}
+			if errs[0].Line != tt.line || !strings.Contains(errs[0].Message, tt.want) {
+				t.Fatalf("got %v, want line %d: %s", errs[0], tt.line, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ValidFiles(t *testing.T) {
+	testdir.WithUploads(t, store.UploadsDir, "hi.mp3")
+
+	session, err := Parse(strings.NewReader("# S\nplain description\n\n## A\n- say:\n  audio: uploads/hi.mp3\n"), moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if say := session.Items[0].Actions[0].SayItem; say.FilePath != "data/uploads/hi.mp3" {
+		t.Fatalf("audio path %q", say.FilePath)
+	}
+	if session.Description != "plain description" {
+		t.Fatalf("description %q", session.Description)
+	}
+}
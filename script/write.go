@@ -0,0 +1,181 @@
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// Write writes the session as a script. Items which are referred to by transitions must have unique titles.
+// Variants aren't supported by the format, they are written as comments.
+func Write(w io.Writer, session *store.Session) error {
+	titles := map[uuid.UUID]string{}
+	count := map[string]int{}
+	for _, item := range session.Items {
+		if item != nil {
+			titles[item.ID] = item.Title
+			count[item.Title]++
+		}
+	}
+	title := func(id uuid.UUID) (string, error) {
+		t, ok := titles[id]
+		if !ok {
+			return "", fmt.Errorf("item %v not found", id)
+		}
+		if t == "" || count[t] > 1 {
+			return "", fmt.Errorf("item %v is referred to, but its title %q isn't unique", id, t)
+		}
+		return t, nil
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# %s\n", oneLine(session.Name))
+	if session.Description != "" {
+		for _, line := range strings.Split(session.Description, "\n") {
+			if line == "" {
+				fmt.Fprintln(b, ">")
+			} else {
+				fmt.Fprintf(b, "> %s\n", line)
+			}
+		}
+	}
+	if (session.StartItemID != uuid.UUID{}) {
+		t, err := title(session.StartItemID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "start: %s\n", t)
+	}
+
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		fmt.Fprintf(b, "\n## %s\n", oneLine(item.Title))
+		for _, action := range item.Actions {
+			if action == nil {
+				continue
+			}
+			if action.VariantsItem != nil {
+				fmt.Fprintf(b, "<!-- variants aren't supported by the script format: %d variants omitted -->\n", len(action.VariantsItem.Entries))
+			}
+			lines := actionLines(action)
+			for _, branch := range item.Branches {
+				if branch == nil || branch.ActionID != action.ID {
+					continue
+				}
+				t, err := title(branch.NextItemID)
+				if err != nil {
+					return err
+				}
+				lines = append(lines, "goto: "+t)
+			}
+			if len(lines) == 0 {
+				continue
+			}
+			fmt.Fprintf(b, "- %s\n", lines[0])
+			for _, line := range lines[1:] {
+				fmt.Fprintf(b, "  %s\n", line)
+			}
+		}
+		if (item.Next != uuid.UUID{}) {
+			t, err := title(item.Next)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(b, "next: %s\n", t)
+		}
+		if item.End {
+			fmt.Fprintln(b, "end")
+		}
+	}
+	return b.Flush()
+}
+
+func actionLines(a *instruction.Action) []string {
+	lines := []string{}
+	option := func(key string, value interface{}) {
+		lines = append(lines, fmt.Sprintf("%s: %v", key, value))
+	}
+
+	if say := a.SayItem; say != nil && (say.Phrase != "" || say.FilePath != "" || len(say.Translations) > 0) {
+		option("say", oneLine(say.Phrase))
+		if say.FilePath != "" {
+			option("audio", scriptPath(say.FilePath))
+		}
+		if say.Language != "" {
+			option("language", say.Language)
+		}
+		languages := make([]string, 0, len(say.Translations))
+		for lang := range say.Translations {
+			languages = append(languages, lang)
+		}
+		sort.Strings(languages)
+		for _, lang := range languages {
+			t := say.Translations[lang]
+			if t == nil {
+				continue
+			}
+			if t.Phrase != "" {
+				option("translation "+lang, oneLine(t.Phrase))
+			}
+			if t.FilePath != "" {
+				option("translation "+lang+" audio", scriptPath(t.FilePath))
+			}
+		}
+		if say.Delay > 0 {
+			option("delay", say.Delay)
+		}
+	}
+	if move := a.MoveItem; move != nil && move.Name != "" {
+		option("move", move.Name)
+		if move.Speed != 0 {
+			option("speed", move.Speed)
+		}
+		if move.Delay > 0 {
+			option("delay", move.Delay)
+		}
+	}
+	if image := a.ImageItem; image != nil && image.FilePath != "" {
+		option("image", scriptPath(image.FilePath))
+		if image.Delay > 0 {
+			option("delay", image.Delay)
+		}
+	}
+	if url := a.URLItem; url != nil && url.URL != "" {
+		option("url", url.URL)
+		if url.Delay > 0 {
+			option("delay", url.Delay)
+		}
+	}
+	if stop := a.StopItem; stop != nil {
+		if stop.ResetPosture {
+			option("stop", "reset")
+		} else {
+			lines = append(lines, "stop")
+		}
+		if stop.Delay > 0 {
+			option("delay", stop.Delay)
+		}
+	}
+	return lines
+}
+
+// scriptPath converts a path of an uploaded file to the path relative to the data directory, e.g., uploads/x.png.
+func scriptPath(p string) string {
+	if strings.HasPrefix(p, store.UploadsDir+"/") {
+		return strings.TrimPrefix(p, "data/")
+	}
+	return p
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,259 @@
+/*
+Package spreadsheet imports sessions drafted in spreadsheets and saved as CSV. Every row of the file becomes
+a session item, a mapping tells which columns of the row make up the item's title and actions. Columns are
+referred to by their names in the header row. Move names in cells are matched against the move library, images
+must be uploaded before the import and referred to as uploads/<name>.
+*/
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// Mapping maps columns of the file to fields of a session item.
+type Mapping struct {
+	Delimiter string           `json:"delimiter"` // a comma by default, spreadsheets with some locales use a semicolon
+	Title     string           `json:"title"`     // the title column, the first phrase of the row is the title if it's empty
+	Actions   []*ActionColumns `json:"actions"`   // actions of the item in their order, the first one is the main action
+}
+
+// ActionColumns are columns of a row which make up one action, an empty column name means the field isn't mapped.
+type ActionColumns struct {
+	Say   string `json:"say"`
+	Move  string `json:"move"`
+	Image string `json:"image"`
+	URL   string `json:"url"`
+}
+
+// DefaultMapping reads a row per question with positive and negative answers and suggested moves for each.
+var DefaultMapping = &Mapping{
+	Delimiter: ",",
+	Title:     "Title",
+	Actions: []*ActionColumns{
+		{Say: "Question", Move: "Question move"},
+		{Say: "Positive", Move: "Positive move"},
+		{Say: "Negative", Move: "Negative move"},
+	},
+}
+
+// MoveMatcher finds a move of the library by a name typed by a person, e.g., store.Moves.
+type MoveMatcher interface {
+	Match(name string) (*instruction.Move, error)
+}
+
+// Problem is a problem with a cell or a row, rows are numbered from 1 including the header row. Column is empty
+// if the problem concerns the whole row or the file.
+type Problem struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column"`
+	Message string `json:"message"`
+}
+
+// Result is a session read from the file. The session can be created only if there are no errors, warnings
+// point to data which has been skipped.
+type Result struct {
+	Session  *store.Session `json:"session"`
+	Rows     int            `json:"rows"` // rows with data excluding the header
+	Errors   []*Problem     `json:"errors"`
+	Warnings []*Problem     `json:"warnings"`
+}
+
+// Read reads a session with the name from the CSV file according to the mapping.
+func Read(r io.Reader, name string, mapping *Mapping, moves MoveMatcher) (*Result, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma, _ = utf8.DecodeRuneInString(mapping.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("can't read the CSV file: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the CSV file is empty")
+	}
+
+	result := &Result{
+		Session: &store.Session{
+			ID:    uuid.Must(uuid.NewRandom()),
+			Name:  name,
+			Items: []*store.SessionItem{},
+		},
+		Errors:   []*Problem{},
+		Warnings: []*Problem{},
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		columns[normalize(header)] = i
+	}
+	for _, column := range mapping.columns() {
+		if _, ok := columns[normalize(column)]; !ok {
+			result.Warnings = append(result.Warnings, &Problem{Row: 1, Column: column, Message: "the column isn't in the file and is skipped"})
+		}
+	}
+	cell := func(record []string, column string) string {
+		i, ok := columns[normalize(column)]
+		if column == "" || !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for n, record := range records[1:] {
+		row := n + 2
+		if isEmpty(record) {
+			continue
+		}
+		result.Rows++
+
+		item := &store.SessionItem{
+			ID:       uuid.Must(uuid.NewRandom()),
+			Title:    cell(record, mapping.Title),
+			Actions:  []*instruction.Action{},
+			Branches: []*store.Branch{},
+		}
+		for _, ac := range mapping.Actions {
+			if ac == nil {
+				continue
+			}
+			action := &instruction.Action{ID: uuid.Must(uuid.NewRandom())}
+			if phrase := cell(record, ac.Say); phrase != "" {
+				action.SayItem = &instruction.Say{ID: uuid.Must(uuid.NewRandom()), Phrase: phrase}
+				if item.Title == "" {
+					item.Title = phrase
+				}
+			}
+			if moveName := cell(record, ac.Move); moveName != "" {
+				move, err := moves.Match(moveName)
+				if err != nil {
+					result.Errors = append(result.Errors, &Problem{Row: row, Column: ac.Move, Message: err.Error()})
+				} else {
+					action.MoveItem = &instruction.Move{
+						ID:       uuid.Must(uuid.NewRandom()),
+						Name:     move.Name,
+						FilePath: move.FilePath,
+						Group:    move.Group,
+					}
+				}
+			}
+			if image := cell(record, ac.Image); image != "" {
+				// paths relative to the data directory as the UI shows them, e.g., uploads/a.png
+				fpath, err := store.UploadPath(image)
+				if err != nil {
+					result.Errors = append(result.Errors, &Problem{Row: row, Column: ac.Image, Message: err.Error()})
+				} else {
+					action.ImageItem = &instruction.ShowImage{ID: uuid.Must(uuid.NewRandom()), Name: path.Base(fpath), FilePath: fpath}
+				}
+			}
+			if url := cell(record, ac.URL); url != "" {
+				action.URLItem = &instruction.ShowURI{ID: uuid.Must(uuid.NewRandom()), Name: url, URL: url}
+			}
+			if !action.IsNil() {
+				item.Actions = append(item.Actions, action)
+			}
+		}
+
+		if len(item.Actions) == 0 {
+			result.Warnings = append(result.Warnings, &Problem{Row: row, Message: "the row has no data in mapped columns and is skipped"})
+			continue
+		}
+		result.Session.Items = append(result.Session.Items, item)
+	}
+
+	if len(result.Session.Items) == 0 {
+		result.Errors = append(result.Errors, &Problem{Message: "there are no rows with data in mapped columns"})
+	}
+	return result, nil
+}
+
+// Validate checks the delimiter and that the mapping maps at least one column.
+func (m *Mapping) Validate() error {
+	if m == nil {
+		return fmt.Errorf("mapping must be provided")
+	}
+	if utf8.RuneCountInString(m.Delimiter) != 1 {
+		return fmt.Errorf("delimiter must be a single character, got %q", m.Delimiter)
+	}
+	if len(m.Actions) == 0 || len(m.columns()) == 0 {
+		return fmt.Errorf("mapping must have at least one action with a mapped column")
+	}
+	return nil
+}
+
+func (m *Mapping) columns() []string {
+	columns := []string{}
+	if m.Title != "" {
+		columns = append(columns, m.Title)
+	}
+	for _, ac := range m.Actions {
+		if ac == nil {
+			continue
+		}
+		for _, column := range []string{ac.Say, ac.Move, ac.Image, ac.URL} {
+			if column != "" {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+// LoadMapping reads the mapping from fpath, DefaultMapping is returned if the file doesn't exist.
+func LoadMapping(fpath string) (*Mapping, error) {
+	f, err := os.Open(fpath)
+	if os.IsNotExist(err) {
+		return DefaultMapping, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &Mapping{}
+	if err = json.NewDecoder(f).Decode(m); err != nil {
+		return nil, fmt.Errorf("can't decode the CSV mapping from %s: %v", fpath, err)
+	}
+	return m, nil
+}
+
+// SaveMapping writes the mapping to fpath.
+func SaveMapping(fpath string, m *Mapping) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	f, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(m)
+}
+
+func normalize(column string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+}
+
+func isEmpty(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
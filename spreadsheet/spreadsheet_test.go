@@ -0,0 +1,124 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/internal/testdir"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+type testMoves map[string]*instruction.Move
+
+func (m testMoves) Match(name string) (*instruction.Move, error) {
+	move, ok := m[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("move %q isn't in the library", name)
+	}
+	return move, nil
+}
+
+var moves = testMoves{
+	"hey_1": {ID: uuid.New(), Name: "Hey_1", Group: "Greetings", FilePath: "data/pepper-core-anims-master/Hey_1.qianim"},
+}
+
+func TestRead_DefaultMapping(t *testing.T) {
+	csv := "\ufeffTitle,Question,Question move,Positive,Positive move,Negative,Negative move\n" +
+		"Intro,How are you?,hey_1,Great,,Bad,\n" +
+		",,,,,,\n" +
+		",Do you like robots?,,Yes,,,\n"
+	result, err := Read(strings.NewReader(csv), "Survey", DefaultMapping, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 || len(result.Warnings) > 0 {
+		t.Fatalf("unexpected problems: %v %v", result.Errors, result.Warnings)
+	}
+	if result.Rows != 2 || len(result.Session.Items) != 2 {
+		t.Fatalf("got %d rows and %d items, want 2 and 2", result.Rows, len(result.Session.Items))
+	}
+
+	intro := result.Session.Items[0]
+	if intro.Title != "Intro" || len(intro.Actions) != 3 {
+		t.Fatalf("unexpected item %q with %d actions", intro.Title, len(intro.Actions))
+	}
+	if a := intro.Actions[0]; a.SayItem.Phrase != "How are you?" || a.MoveItem.Name != "Hey_1" || a.MoveItem.FilePath != moves["hey_1"].FilePath {
+		t.Fatalf("unexpected main action %+v", a)
+	}
+	if phrase := intro.Actions[2].SayItem.Phrase; phrase != "Bad" {
+		t.Fatalf("the last action says %q, want Bad", phrase)
+	}
+
+	// the first phrase is the title when the title cell is empty
+	if second := result.Session.Items[1]; second.Title != "Do you like robots?" || len(second.Actions) != 2 {
+		t.Fatalf("unexpected item %q with %d actions", second.Title, len(second.Actions))
+	}
+}
+
+func TestRead_Problems(t *testing.T) {
+	testdir.WithUploads(t, store.UploadsDir, "robot.png")
+
+	mapping := &Mapping{Delimiter: ";", Actions: []*ActionColumns{{Say: "Phrase", Move: "Move", Image: "Image"}, {URL: "Link"}}}
+	csv := "Phrase;Move;Image\n" +
+		"Hello;Nope;uploads/robot.png\n" +
+		"Look;;uploads/missing.png\n" +
+		"Secret;;/etc/passwd\n" +
+		"Up;;uploads/../sessions.json\n" +
+		";;\n"
+	result, err := Read(strings.NewReader(csv), "Problems", mapping, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		row    int
+		column string
+		text   string
+	}{
+		{2, "Move", "isn't in the library"},
+		{3, "Image", "not found"},
+		{4, "Image", "isn't in uploads"},
+		{5, "Image", "isn't a file directly in uploads"},
+	}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("got errors %v, want %d", result.Errors, len(want))
+	}
+	for i, w := range want {
+		got := result.Errors[i]
+		if got.Row != w.row || got.Column != w.column || !strings.Contains(got.Message, w.text) {
+			t.Errorf("error %d is %+v, want row %d column %s: %s", i, got, w.row, w.column, w.text)
+		}
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Column != "Link" {
+		t.Fatalf("want a warning about the missing column Link, got %v", result.Warnings)
+	}
+	if image := result.Session.Items[0].Actions[0].ImageItem; image == nil || image.FilePath != "data/uploads/robot.png" {
+		t.Fatalf("unexpected image %+v", image)
+	}
+}
+
+func TestMapping_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping *Mapping
+		valid   bool
+	}{
+		{"default", DefaultMapping, true},
+		{"nil", nil, false},
+		{"long delimiter", &Mapping{Delimiter: ";;", Actions: []*ActionColumns{{Say: "A"}}}, false},
+		{"no actions", &Mapping{Delimiter: ",", Title: "Title"}, false},
+		{"no columns", &Mapping{Delimiter: ",", Actions: []*ActionColumns{{}}}, false},
+		{"tab", &Mapping{Delimiter: "\t", Actions: []*ActionColumns{{URL: "Link"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mapping.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("valid %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
@@ -21,9 +21,12 @@ type Actions struct {
 }
 
 func NewActionsStore(fpath string) (*Actions, error) {
+	var isFreshDatabase bool
+
 	var file *os.File
 	_, err := os.Stat(fpath)
 	if os.IsNotExist(err) {
+		isFreshDatabase = true
 		file, err = os.Create(fpath)
 		if err != nil {
 			return nil, fmt.Errorf("can't create an actions store at %s: %v", fpath, err)
@@ -41,6 +44,11 @@ func NewActionsStore(fpath string) (*Actions, error) {
 		return nil, fmt.Errorf("can't decode audio items from %s: %v", fpath, err)
 	}
 
+	// add the actions stopping the robot only to a new database, so the user can remove them
+	if isFreshDatabase {
+		store.Items = append(store.Items, stopActions()...)
+	}
+
 	for _, a := range store.Items {
 		a.InitiateItemsIDs()
 	}
@@ -48,6 +56,24 @@ func NewActionsStore(fpath string) (*Actions, error) {
 	return store, store.dump()
 }
 
+// stopActions are library actions to stop the robot.
+func stopActions() []*instruction.Action {
+	return []*instruction.Action{
+		{
+			ID:       uuid.Must(uuid.NewRandom()),
+			Name:     "Stop",
+			Group:    "Control",
+			StopItem: &instruction.Stop{Name: "Stop"},
+		},
+		{
+			ID:       uuid.Must(uuid.NewRandom()),
+			Name:     "Stop and reset posture",
+			Group:    "Control",
+			StopItem: &instruction.Stop{Name: "Stop and reset posture", ResetPosture: true},
+		},
+	}
+}
+
 func (s *Actions) GetByUUID(id uuid.UUID) (*instruction.Action, error) {
 	for _, s := range s.Items {
 		if s.ID == id {
@@ -125,13 +151,8 @@ func (s *Actions) Delete(id string) error {
 	s.mu.Lock()
 
 	// removing resources
-	if action.SayItem != nil && len(action.SayItem.FilePath) > 0 {
-		if err = removeFile(action.SayItem.FilePath); err != nil {
-			return err
-		}
-	}
-	if action.ImageItem != nil && len(action.ImageItem.FilePath) > 0 {
-		if err = removeFile(action.ImageItem.FilePath); err != nil {
+	for _, fpath := range action.OwnedFiles() {
+		if err = removeFile(fpath); err != nil {
 			return err
 		}
 	}
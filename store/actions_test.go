@@ -0,0 +1,36 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+func TestNewActionsStore_StopActions(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "actions.json")
+	actions, err := NewActionsStore(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions.Items) != 2 {
+		t.Fatalf("a fresh store has %d actions, want 2 stop actions", len(actions.Items))
+	}
+	for _, a := range append([]*instruction.Action{}, actions.Items...) {
+		if a.StopItem == nil || !a.IsValid() {
+			t.Fatalf("unexpected action %+v", a)
+		}
+		if err = actions.Delete(a.ID.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// removed stop actions aren't added again
+	loaded, err := NewActionsStore(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Items) != 0 {
+		t.Fatalf("loaded %d actions, want none", len(loaded.Items))
+	}
+}
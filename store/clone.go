@@ -0,0 +1,194 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+// Clone creates a copy of the session with fresh IDs of the session, its items and all nested instructions.
+// Uploaded files of the session are duplicated, so the copy can be deleted without affecting the original.
+// Moves aren't duplicated, because they belong to the moves library. The name of the copy can be empty.
+func (s *Sessions) Clone(id string, name string, fileStore *Files, author string) (*Session, error) {
+	original, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	clone, err := copySession(original)
+	if err != nil {
+		return nil, err
+	}
+
+	clone.Name = strings.TrimSpace(name)
+	if clone.Name == "" {
+		clone.Name = original.Name + " (copy)"
+	}
+
+	renewSessionIDs(clone)
+
+	copied := []string{} // files to remove if cloning fails
+	for _, item := range clone.Items {
+		if item == nil {
+			continue
+		}
+		for _, action := range item.Actions {
+			paths, err := duplicateFiles(action, fileStore)
+			copied = append(copied, paths...)
+			if err != nil {
+				removeFiles(copied)
+				return nil, err
+			}
+		}
+	}
+
+	if err = s.Create(clone, author); err != nil {
+		removeFiles(copied)
+		return nil, err
+	}
+	return clone, nil
+}
+
+// renewSessionIDs gives the session, its items and all nested instructions new IDs and updates transitions
+// between items accordingly.
+func renewSessionIDs(session *Session) {
+	session.ID = uuid.Must(uuid.NewRandom())
+
+	// new IDs of items are needed in advance to update transitions between items
+	itemIDs := map[uuid.UUID]uuid.UUID{}
+	for _, item := range session.Items {
+		if item != nil {
+			itemIDs[item.ID] = uuid.Must(uuid.NewRandom())
+		}
+	}
+
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		item.ID = itemIDs[item.ID]
+		item.Next = itemIDs[item.Next]
+
+		actionIDs := map[uuid.UUID]uuid.UUID{}
+		for _, action := range item.Actions {
+			if action == nil {
+				continue
+			}
+			oldID := action.ID
+			renewIDs(action)
+			actionIDs[oldID] = action.ID
+		}
+		for _, b := range item.Branches {
+			if b == nil {
+				continue
+			}
+			b.ActionID = actionIDs[b.ActionID]
+			b.NextItemID = itemIDs[b.NextItemID]
+		}
+	}
+	session.StartItemID = itemIDs[session.StartItemID]
+}
+
+// renewIDs replaces IDs of the action and its nested instructions including variants with new ones.
+func renewIDs(a *instruction.Action) {
+	if a == nil {
+		return
+	}
+	a.ID = uuid.Must(uuid.NewRandom())
+	if a.SayItem != nil {
+		a.SayItem.ID = uuid.Must(uuid.NewRandom())
+	}
+	if a.MoveItem != nil {
+		a.MoveItem.ID = uuid.Must(uuid.NewRandom())
+	}
+	if a.ImageItem != nil {
+		a.ImageItem.ID = uuid.Must(uuid.NewRandom())
+	}
+	if a.URLItem != nil {
+		a.URLItem.ID = uuid.Must(uuid.NewRandom())
+	}
+	if a.StopItem != nil {
+		a.StopItem.ID = uuid.Must(uuid.NewRandom())
+	}
+	if a.VariantsItem != nil {
+		a.VariantsItem.ID = uuid.Must(uuid.NewRandom())
+		for _, e := range a.VariantsItem.Entries {
+			if e != nil {
+				renewIDs(e.Action)
+			}
+		}
+	}
+}
+
+// duplicateFiles copies uploaded audio including translations and image files of the action with variants and points
+// the action to the copies. Paths of the created copies are returned.
+func duplicateFiles(a *instruction.Action, fileStore *Files) ([]string, error) {
+	copied := []string{}
+	if a == nil {
+		return copied, nil
+	}
+
+	paths := []*string{}
+	if a.SayItem != nil && a.SayItem.FilePath != "" {
+		paths = append(paths, &a.SayItem.FilePath)
+	}
+	if a.SayItem != nil {
+		for _, t := range a.SayItem.Translations {
+			if t != nil && t.FilePath != "" {
+				paths = append(paths, &t.FilePath)
+			}
+		}
+	}
+	if a.ImageItem != nil && a.ImageItem.FilePath != "" {
+		paths = append(paths, &a.ImageItem.FilePath)
+	}
+	for _, fpath := range paths {
+		if !strings.HasPrefix(*fpath, fileStore.base) {
+			continue
+		}
+		if _, err := os.Stat(*fpath); os.IsNotExist(err) {
+			continue // the copy refers to the same missing file
+		}
+		dst, err := duplicateFile(*fpath, fileStore)
+		if err != nil {
+			return copied, err
+		}
+		copied = append(copied, dst)
+		*fpath = dst
+	}
+
+	if a.VariantsItem != nil {
+		for _, e := range a.VariantsItem.Entries {
+			if e == nil {
+				continue
+			}
+			paths, err := duplicateFiles(e.Action, fileStore)
+			copied = append(copied, paths...)
+			if err != nil {
+				return copied, err
+			}
+		}
+	}
+	return copied, nil
+}
+
+func duplicateFile(src string, fileStore *Files) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy %s: %v", src, err)
+	}
+	defer f.Close()
+
+	name := uuid.Must(uuid.NewRandom()).String() + filepath.Ext(src)
+	return fileStore.Save(name, f)
+}
+
+func removeFiles(paths []string) {
+	for _, fpath := range paths {
+		_ = removeFile(fpath)
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Command results.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// CommandEntry is a record about a command sent to the robot.
+type CommandEntry struct {
+	Time          time.Time       `json:"time"`
+	RunID         uuid.UUID       `json:"run_id"`
+	ParticipantID uuid.UUID       `json:"participant_id"`
+	Operator      string          `json:"operator"`
+	Robot         string          `json:"robot"`
+	SessionID     uuid.UUID       `json:"session_id"`
+	ItemID        uuid.UUID       `json:"item_id"`
+	ActionID      uuid.UUID       `json:"action_id"`  // the requested action
+	VariantID     uuid.UUID       `json:"variant_id"` // the picked variant when the action is a pool of variants
+	Command       string          `json:"command"`
+	Name          string          `json:"name"`
+	Instruction   json.RawMessage `json:"instruction"` // resolved contents of the sent instruction
+	Result        string          `json:"result"`
+	Error         string          `json:"error"`
+}
+
+// CommandLog is an append-only log of every command sent to the robot, it's stored as JSON lines.
+type CommandLog struct {
+	filepath string
+	mu       sync.Mutex
+}
+
+func NewCommandLog(fpath string) (*CommandLog, error) {
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("can't create a command log at %s: %v", fpath, err)
+	}
+	return &CommandLog{filepath: fpath}, f.Close()
+}
+
+// Append adds the entry to the end of the log.
+func (l *CommandLog) Append(entry *CommandEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.filepath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries returns entries of the run in the chronological order. Commands sent outside of any run
+// have the zero run ID.
+func (l *CommandLog) Entries(runID uuid.UUID) ([]*CommandEntry, error) {
+	entries := []*CommandEntry{}
+	err := l.walk(func(e *CommandEntry) {
+		if e.RunID == runID {
+			entries = append(entries, e)
+		}
+	})
+	return entries, err
+}
+
+// Counts returns the number of entries per run.
+func (l *CommandLog) Counts() (map[uuid.UUID]int, error) {
+	counts := map[uuid.UUID]int{}
+	err := l.walk(func(e *CommandEntry) {
+		counts[e.RunID]++
+	})
+	return counts, err
+}
+
+func (l *CommandLog) walk(fn func(e *CommandEntry)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20) // instructions can contain long phrases
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := &CommandEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return fmt.Errorf("failed to decode the entry at line %d of %s: %v", line, l.filepath, err)
+		}
+		fn(e)
+	}
+	return scanner.Err()
+}
+
+// WriteJSONLines exports entries as JSON lines.
+func WriteJSONLines(w io.Writer, entries []*CommandEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV exports entries as CSV with a header, the instruction is written as a JSON string.
+func WriteCSV(w io.Writer, entries []*CommandEntry) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"time", "run_id", "participant_id", "operator", "robot", "session_id", "item_id", "action_id", "variant_id",
+		"command", "name", "result", "error", "instruction",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		record := []string{
+			e.Time.Format(time.RFC3339Nano),
+			uuidOrEmpty(e.RunID),
+			uuidOrEmpty(e.ParticipantID),
+			e.Operator,
+			e.Robot,
+			uuidOrEmpty(e.SessionID),
+			uuidOrEmpty(e.ItemID),
+			uuidOrEmpty(e.ActionID),
+			uuidOrEmpty(e.VariantID),
+			e.Command,
+			e.Name,
+			e.Result,
+			e.Error,
+			string(e.Instruction),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func uuidOrEmpty(id uuid.UUID) string {
+	if (id == uuid.UUID{}) {
+		return ""
+	}
+	return id.String()
+}
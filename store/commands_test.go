@@ -0,0 +1,113 @@
+package store
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCommandLog(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "commands.jsonl")
+	commands, err := NewCommandLog(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := uuid.New()
+	entries := []*CommandEntry{
+		{RunID: run, Command: "say", Name: "hello", Instruction: json.RawMessage(`{"Phrase":"Tere, kuidas läheb?"}`), Result: ResultOK},
+		{Command: "move", Name: "Hey_1", Result: ResultOK},
+		{RunID: run, Command: "say", Name: "bye", Result: ResultError, Error: "robot is offline"},
+	}
+	for _, e := range entries {
+		if err = commands.Append(e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Time.IsZero() {
+			t.Fatal("the time of the entry isn't set")
+		}
+	}
+
+	// entries are appended to the file and read back after reopening
+	commands, err = NewCommandLog(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = commands.Append(&CommandEntry{RunID: run, Command: "stop"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := commands.Entries(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Name != "hello" || got[1].Error != "robot is offline" || got[2].Command != "stop" {
+		t.Fatalf("unexpected entries of the run %+v", got)
+	}
+	if string(got[0].Instruction) != string(entries[0].Instruction) {
+		t.Fatalf("the instruction is %s, want %s", got[0].Instruction, entries[0].Instruction)
+	}
+	if outside, err := commands.Entries(uuid.UUID{}); err != nil || len(outside) != 1 {
+		t.Fatalf("got %v, %v entries outside of runs, want 1", outside, err)
+	}
+	counts, err := commands.Counts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[run] != 3 || counts[uuid.UUID{}] != 1 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+
+	// a broken line is reported with its number
+	f, err := os.OpenFile(fpath, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{broken\n")
+	f.Close()
+	if _, err = commands.Entries(run); err == nil || !strings.Contains(err.Error(), "line 5") {
+		t.Fatalf("want an error about line 5, got %v", err)
+	}
+}
+
+func TestWriteCommands(t *testing.T) {
+	entries := []*CommandEntry{
+		{RunID: uuid.New(), Command: "say", Name: "hello, world", Instruction: json.RawMessage(`{"Phrase":"hello, world"}`), Result: ResultOK},
+		{Command: "move", Name: "Hey_1", Result: ResultError, Error: "failed"},
+	}
+
+	b := &bytes.Buffer{}
+	if err := WriteCSV(b, entries); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "time" {
+		t.Fatalf("want a header and 2 records, got %v", records)
+	}
+	if records[1][10] != "hello, world" || records[1][13] != `{"Phrase":"hello, world"}` {
+		t.Fatalf("unexpected record %v", records[1])
+	}
+	if records[2][1] != "" || records[2][12] != "failed" {
+		t.Fatalf("unexpected record %v", records[2])
+	}
+
+	b.Reset()
+	if err = WriteJSONLines(b, entries); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got %d", len(lines))
+	}
+	e := &CommandEntry{}
+	if err = json.Unmarshal([]byte(lines[1]), e); err != nil || e.Name != "Hey_1" {
+		t.Fatalf("unexpected line %s: %v", lines[1], err)
+	}
+}
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+// Kinds of changes between two versions of a session.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+	ChangeMoved    = "moved"
+)
+
+// Change is a difference between two versions of a session. A change of the session itself has the zero item ID,
+// a change of an item has the zero action ID.
+type Change struct {
+	Kind     string    `json:"kind"`
+	ItemID   uuid.UUID `json:"item_id"`
+	ActionID uuid.UUID `json:"action_id"`
+	Title    string    `json:"title"`            // title of the item or name of the action
+	Fields   []string  `json:"fields,omitempty"` // modified fields
+}
+
+// Diff returns changes which turn the session a into the session b at the item and action level.
+func Diff(a, b *Session) []*Change {
+	changes := []*Change{}
+
+	fields := []string{}
+	if a.Name != b.Name {
+		fields = append(fields, "Name")
+	}
+	if a.Description != b.Description {
+		fields = append(fields, "Description")
+	}
+	if a.StartItemID != b.StartItemID {
+		fields = append(fields, "StartItemID")
+	}
+	if len(fields) > 0 {
+		changes = append(changes, &Change{Kind: ChangeModified, Title: b.Name, Fields: fields})
+	}
+
+	oldItems := map[uuid.UUID]int{}
+	oldIDs := []uuid.UUID{}
+	for i, item := range a.Items {
+		if item != nil {
+			oldItems[item.ID] = i
+			oldIDs = append(oldIDs, item.ID)
+		}
+	}
+	newIDs := []uuid.UUID{}
+	for _, item := range b.Items {
+		if item != nil {
+			newIDs = append(newIDs, item.ID)
+		}
+	}
+	moved := reordered(oldIDs, newIDs)
+
+	for _, item := range a.Items {
+		if item != nil && !contains(newIDs, item.ID) {
+			changes = append(changes, &Change{Kind: ChangeRemoved, ItemID: item.ID, Title: item.Title})
+		}
+	}
+	for _, item := range b.Items {
+		if item == nil {
+			continue
+		}
+		i, ok := oldItems[item.ID]
+		if !ok {
+			changes = append(changes, &Change{Kind: ChangeAdded, ItemID: item.ID, Title: item.Title})
+			continue
+		}
+		changes = append(changes, diffItems(a.Items[i], item, moved[item.ID])...)
+	}
+
+	return changes
+}
+
+func diffItems(a, b *SessionItem, moved bool) []*Change {
+	changes := []*Change{}
+	if moved {
+		changes = append(changes, &Change{Kind: ChangeMoved, ItemID: b.ID, Title: b.Title})
+	}
+
+	fields := []string{}
+	if a.Title != b.Title {
+		fields = append(fields, "Title")
+	}
+	if !equalJSON(a.Branches, b.Branches) {
+		fields = append(fields, "Branches")
+	}
+	if a.Next != b.Next {
+		fields = append(fields, "Next")
+	}
+	if a.End != b.End {
+		fields = append(fields, "End")
+	}
+	if len(fields) > 0 {
+		changes = append(changes, &Change{Kind: ChangeModified, ItemID: b.ID, Title: b.Title, Fields: fields})
+	}
+
+	oldActions := map[uuid.UUID]int{}
+	oldIDs := []uuid.UUID{}
+	for i, action := range a.Actions {
+		if action != nil {
+			oldActions[action.ID] = i
+			oldIDs = append(oldIDs, action.ID)
+		}
+	}
+	newIDs := []uuid.UUID{}
+	for _, action := range b.Actions {
+		if action != nil {
+			newIDs = append(newIDs, action.ID)
+		}
+	}
+	movedActions := reordered(oldIDs, newIDs)
+
+	for _, action := range a.Actions {
+		if action != nil && !contains(newIDs, action.ID) {
+			changes = append(changes, &Change{Kind: ChangeRemoved, ItemID: b.ID, ActionID: action.ID, Title: actionTitle(action)})
+		}
+	}
+	for _, action := range b.Actions {
+		if action == nil {
+			continue
+		}
+		i, ok := oldActions[action.ID]
+		if !ok {
+			changes = append(changes, &Change{Kind: ChangeAdded, ItemID: b.ID, ActionID: action.ID, Title: actionTitle(action)})
+			continue
+		}
+		if movedActions[action.ID] {
+			changes = append(changes, &Change{Kind: ChangeMoved, ItemID: b.ID, ActionID: action.ID, Title: actionTitle(action)})
+		}
+		if fields := diffActions(a.Actions[i], action); len(fields) > 0 {
+			changes = append(changes, &Change{
+				Kind:     ChangeModified,
+				ItemID:   b.ID,
+				ActionID: action.ID,
+				Title:    actionTitle(action),
+				Fields:   fields,
+			})
+		}
+	}
+
+	return changes
+}
+
+// diffActions returns names of the modified fields.
+func diffActions(a, b *instruction.Action) []string {
+	fields := []string{}
+	if a.Name != b.Name {
+		fields = append(fields, "Name")
+	}
+	if !equalJSON(a.SayItem, b.SayItem) {
+		fields = append(fields, "SayItem")
+	}
+	if !equalJSON(a.MoveItem, b.MoveItem) {
+		fields = append(fields, "MoveItem")
+	}
+	if !equalJSON(a.ImageItem, b.ImageItem) {
+		fields = append(fields, "ImageItem")
+	}
+	if !equalJSON(a.URLItem, b.URLItem) {
+		fields = append(fields, "URLItem")
+	}
+	if !equalJSON(a.StopItem, b.StopItem) {
+		fields = append(fields, "StopItem")
+	}
+	if !equalJSON(a.VariantsItem, b.VariantsItem) {
+		fields = append(fields, "VariantsItem")
+	}
+	return fields
+}
+
+// actionTitle describes a session's action for humans, actions in sessions usually have no names,
+// so the phrase is used.
+func actionTitle(a *instruction.Action) string {
+	switch {
+	case a.SayItem != nil && a.SayItem.Phrase != "":
+		return a.SayItem.Phrase
+	case a.Name != "":
+		return a.Name
+	case a.MoveItem != nil:
+		return a.MoveItem.Name
+	}
+	return ""
+}
+
+// reordered returns IDs which have changed their position relative to other IDs present in both lists,
+// so an added or removed element doesn't make the following ones moved.
+func reordered(oldIDs, newIDs []uuid.UUID) map[uuid.UUID]bool {
+	common := func(ids, other []uuid.UUID) []uuid.UUID {
+		result := []uuid.UUID{}
+		for _, id := range ids {
+			if contains(other, id) {
+				result = append(result, id)
+			}
+		}
+		return result
+	}
+	before := common(oldIDs, newIDs)
+	after := common(newIDs, oldIDs)
+
+	moved := map[uuid.UUID]bool{}
+	for i := 0; i < len(before) && i < len(after); i++ {
+		if before[i] != after[i] {
+			moved[after[i]] = true
+		}
+	}
+	return moved
+}
+
+func contains(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares values by their JSON. A nil pointer equals a pointer to the zero value, because decoding
+// an action creates empty items, which are nil in sessions that haven't been decoded yet.
+func equalJSON(a, b interface{}) bool {
+	ba, errA := json.Marshal(zeroIfNil(a))
+	bb, errB := json.Marshal(zeroIfNil(b))
+	return errA == nil && errB == nil && bytes.Equal(ba, bb)
+}
+
+func zeroIfNil(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return reflect.New(rv.Type().Elem()).Interface()
+	}
+	return v
+}
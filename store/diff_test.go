@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+func TestDiff(t *testing.T) {
+	say := func(phrase string) *instruction.Action {
+		return &instruction.Action{ID: uuid.New(), SayItem: &instruction.Say{ID: uuid.New(), Phrase: phrase}}
+	}
+	original := &Session{ID: uuid.New(), Name: "Old", Items: []*SessionItem{
+		{ID: uuid.New(), Title: "A", Actions: []*instruction.Action{say("a")}},
+		{ID: uuid.New(), Title: "B", Actions: []*instruction.Action{say("b1"), say("b2"), say("b3"), say("b4")}},
+		{ID: uuid.New(), Title: "C", Actions: []*instruction.Action{say("c")}},
+		{ID: uuid.New(), Title: "E", Actions: []*instruction.Action{say("e")}},
+	}}
+
+	// revisions are compared after they are decoded
+	a, err := copySession(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := copySession(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(a, b); len(changes) != 0 {
+		t.Fatalf("a copy has changes %v", changes)
+	}
+
+	b.Name = "New"
+	itemB, itemC, itemE := b.Items[1], b.Items[2], b.Items[3]
+	itemD := &SessionItem{ID: uuid.New(), Title: "D"}
+	b.Items = []*SessionItem{itemC, itemB, itemD, itemE} // A is removed, B and C are swapped, D is added
+	itemC.Title = "C2"
+	itemC.End = true
+	b2, b3, b4 := itemB.Actions[1], itemB.Actions[2], itemB.Actions[3]
+	b3.SayItem.Phrase = "b3 changed"
+	itemB.Actions = []*instruction.Action{b3, b2, b4, say("b5")} // b1 is removed, b2 and b3 are swapped, b5 is added
+
+	got := map[string]bool{}
+	for _, c := range Diff(a, b) {
+		got[fmt.Sprintf("%s %s %s", c.Kind, c.Title, strings.Join(c.Fields, ","))] = true
+	}
+	want := []string{
+		"modified New Name",
+		"removed A ",
+		"moved C2 ",
+		"modified C2 Title,End",
+		"moved B ",
+		"removed b1 ",
+		"moved b3 changed ",
+		"modified b3 changed SayItem",
+		"moved b2 ",
+		"added b5 ",
+		"added D ",
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("the change %q is missing", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d changes, want %d: %v", len(got), len(want), got)
+	}
+}
+
+func TestDiff_NewSession(t *testing.T) {
+	sessions, _ := newTestSessions(t)
+	session := &Session{Name: "New", Items: []*SessionItem{{Title: "A", Actions: []*instruction.Action{
+		{SayItem: &instruction.Say{Phrase: "Hello"}},
+		{MoveItem: &instruction.Move{Name: "Hey_1", FilePath: "data/uploads/hey.qianim"}},
+	}}}}
+	if err := sessions.Create(session, "author"); err != nil {
+		t.Fatal(err)
+	}
+
+	rev, err := sessions.revisions.Get(session.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := sessions.Get(session.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the revision is decoded, so its actions have empty items where the current session has none
+	if changes := Diff(rev.Session, current); len(changes) != 0 {
+		for _, c := range changes {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+}
+
+func TestReordered(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+	// removing and adding elements doesn't make the following ones moved
+	moved := reordered(ids, []uuid.UUID{ids[1], uuid.New(), ids[2], ids[3]})
+	if len(moved) != 0 {
+		t.Fatalf("unexpected moved %v", moved)
+	}
+	moved = reordered(ids, []uuid.UUID{ids[0], ids[2], ids[1], ids[3]})
+	if len(moved) != 2 || !moved[ids[1]] || !moved[ids[2]] {
+		t.Fatalf("want the second and third to be moved, got %v", moved)
+	}
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/audiofile"
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/qianim"
+)
+
+// speechRate is words per second of a robot's speech, it's used to estimate phrases without audio files.
+const speechRate = 2.5
+
+// Audio and motion of an action differ a lot when the difference is larger than both thresholds.
+const (
+	mismatchSeconds = 2.0
+	mismatchRatio   = 0.5 // of the longer one
+)
+
+// ActionDuration is the estimated length of an action in seconds. Speech and Motion are the moments when
+// the phrase and the move end including their delays.
+type ActionDuration struct {
+	ActionID        uuid.UUID `json:"action_id"`
+	Duration        float64   `json:"duration"`
+	Speech          float64   `json:"speech"`
+	Motion          float64   `json:"motion"`
+	SpeechEstimated bool      `json:"speech_estimated"` // the phrase has no audio file, its length is estimated by words
+	Mismatch        bool      `json:"mismatch"`         // speech and motion lengths differ a lot
+}
+
+// ItemDuration is the estimated length of an item, it's the length of the main action, answers are played
+// on demand.
+type ItemDuration struct {
+	ItemID   uuid.UUID         `json:"item_id"`
+	Duration float64           `json:"duration"`
+	Mismatch bool              `json:"mismatch"` // any action of the item has a speech and motion mismatch
+	Actions  []*ActionDuration `json:"actions"`
+}
+
+// SessionDuration is the estimated length of a session, it's the sum of its items' lengths.
+type SessionDuration struct {
+	SessionID uuid.UUID       `json:"session_id"`
+	Duration  float64         `json:"duration"`
+	Items     []*ItemDuration `json:"items"`
+}
+
+// EstimateAction estimates how long the action plays. Instructions of the action start at the same time after
+// their delays, so the action lasts until the longest of them ends. A phrase is measured by its audio file
+// or estimated by its number of words, a move is measured by its animation file, a move without a file, e.g.,
+// located on the robot, counts only by its delay. The longest variant is taken for variants.
+func EstimateAction(a *instruction.Action) *ActionDuration {
+	d := &ActionDuration{}
+	if a == nil {
+		return d
+	}
+	d.ActionID = a.ID
+
+	if a.SayItem != nil {
+		length, measured := sayDuration(a.SayItem)
+		d.Speech = float64(a.SayItem.Delay) + length
+		d.SpeechEstimated = !measured
+	}
+	if a.MoveItem != nil {
+		d.Motion = float64(a.MoveItem.Delay) + moveDuration(a.MoveItem)
+	}
+	d.Duration = math.Max(d.Speech, d.Motion)
+	if a.ImageItem != nil {
+		d.Duration = math.Max(d.Duration, float64(a.ImageItem.Delay))
+	}
+	if a.URLItem != nil {
+		d.Duration = math.Max(d.Duration, float64(a.URLItem.Delay))
+	}
+	if a.StopItem != nil {
+		d.Duration = math.Max(d.Duration, float64(a.StopItem.Delay))
+	}
+	if a.VariantsItem != nil {
+		for _, e := range a.VariantsItem.Entries {
+			if e == nil {
+				continue
+			}
+			v := EstimateAction(e.Action)
+			d.Duration = math.Max(d.Duration, v.Duration)
+			d.Mismatch = d.Mismatch || v.Mismatch
+		}
+	}
+
+	if d.Speech > 0 && d.Motion > 0 {
+		diff := math.Abs(d.Speech - d.Motion)
+		d.Mismatch = d.Mismatch || (diff > mismatchSeconds && diff > mismatchRatio*math.Max(d.Speech, d.Motion))
+	}
+	return d
+}
+
+// EstimateItem estimates lengths of the item and all its actions.
+func EstimateItem(item *SessionItem) *ItemDuration {
+	d := &ItemDuration{Actions: []*ActionDuration{}}
+	if item == nil {
+		return d
+	}
+	d.ItemID = item.ID
+	for _, action := range item.Actions {
+		if action == nil {
+			continue
+		}
+		ad := EstimateAction(action)
+		if len(d.Actions) == 0 {
+			d.Duration = ad.Duration
+		}
+		d.Mismatch = d.Mismatch || ad.Mismatch
+		d.Actions = append(d.Actions, ad)
+	}
+	return d
+}
+
+// EstimateSession estimates lengths of the session, its items and their actions.
+func EstimateSession(s *Session) *SessionDuration {
+	d := &SessionDuration{SessionID: s.ID, Items: []*ItemDuration{}}
+	for _, item := range s.Items {
+		if item == nil {
+			continue
+		}
+		id := EstimateItem(item)
+		d.Duration += id.Duration
+		d.Items = append(d.Items, id)
+	}
+	return d
+}
+
+// Duration estimates the length of the item by its main action in seconds.
+func (si *SessionItem) Duration() float64 {
+	return EstimateItem(si).Duration
+}
+
+// Duration estimates the length of the session as the sum of its items' lengths in seconds.
+func (s *Session) Duration() float64 {
+	return EstimateSession(s).Duration
+}
+
+// sayDuration returns the length of the phrase and whether it has been measured by the audio file.
+func sayDuration(say *instruction.Say) (float64, bool) {
+	if say.FilePath != "" {
+		if d, err := fileDurations.get(say.FilePath, audiofile.Duration); err == nil {
+			return d, true
+		}
+	}
+	return float64(len(strings.Fields(say.Phrase))) / speechRate, false
+}
+
+func moveDuration(m *instruction.Move) float64 {
+	if m.FilePath == "" {
+		return 0
+	}
+	d, err := fileDurations.get(m.FilePath, animationDuration)
+	if err != nil {
+		return 0
+	}
+	return d / m.SpeedFactor()
+}
+
+func animationDuration(fpath string) (float64, error) {
+	anim, err := qianim.ParseFile(fpath)
+	if err != nil {
+		return 0, err
+	}
+	return anim.Duration(), nil
+}
+
+// fileDurations keeps lengths of audio and animation files, so sessions are estimated without reading
+// all their files every time.
+var fileDurations = &durationCache{files: map[string]*fileDuration{}}
+
+// durationCache keeps measured lengths of files until the files are modified.
+type durationCache struct {
+	mu    sync.Mutex
+	files map[string]*fileDuration
+}
+
+type fileDuration struct {
+	modTime time.Time
+	size    int64
+	seconds float64
+	err     error
+}
+
+// get returns the cached length of the file or measures it if the file is new or has been modified since.
+func (c *durationCache) get(fpath string, measure func(fpath string) (float64, error)) (float64, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.files, fpath)
+		c.mu.Unlock()
+		return 0, err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.files[fpath]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.seconds, cached.err
+	}
+
+	seconds, err := measure(fpath)
+	c.mu.Lock()
+	c.files[fpath] = &fileDuration{modTime: info.ModTime(), size: info.Size(), seconds: seconds, err: err}
+	c.mu.Unlock()
+	return seconds, err
+}
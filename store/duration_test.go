@@ -0,0 +1,41 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDurationCache(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "a.mp3")
+	writeTestFile(t, fpath, "audio")
+
+	c := &durationCache{files: map[string]*fileDuration{}}
+	measured := 0
+	measure := func(string) (float64, error) {
+		measured++
+		return float64(measured), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if d, _ := c.get(fpath, measure); d != 1 {
+			t.Fatalf("got %v, want the cached length 1", d)
+		}
+	}
+
+	modified := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fpath, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := c.get(fpath, measure); d != 2 {
+		t.Fatalf("got %v, want the file to be measured again after a modification", d)
+	}
+
+	if err := os.Remove(fpath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.get(fpath, measure); err == nil || len(c.files) != 0 {
+		t.Fatal("a removed file is still cached")
+	}
+}
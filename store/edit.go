@@ -0,0 +1,309 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/jsonpatch"
+)
+
+// ConflictError is returned when a session has been changed since the revision the client has edited.
+type ConflictError struct {
+	Expected int
+	Current  int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("session has been changed by someone else: expected revision %d, current revision %d", e.Expected, e.Current)
+}
+
+// Edit applies the change to a copy of the session and saves it as a new revision. The change is rejected with
+// a ConflictError if the current revision of the session isn't the expected one, the check is skipped if
+// the expected revision is 0. Files which the change has made unused are kept, because earlier revisions
+// still refer to them, they are removed when the session is purged.
+func (s *Sessions) Edit(id string, expected int, author, comment string, change func(session *Session) error) (*Session, error) {
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+
+	current, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if expected > 0 && expected != current.Revision {
+		return nil, &ConflictError{Expected: expected, Current: current.Revision}
+	}
+
+	edited, err := copySession(current)
+	if err != nil {
+		return nil, err
+	}
+	if err = change(edited); err != nil {
+		return nil, err
+	}
+	edited.ID = current.ID
+
+	if err = s.update(edited, author, comment); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// Patch applies a JSON Patch (RFC 6902) to the session's JSON representation.
+func (s *Sessions) Patch(id string, expected int, author string, patch jsonpatch.Patch) (*Session, error) {
+	return s.Edit(id, expected, author, "patched", func(session *Session) error {
+		doc, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		patched, err := patch.Apply(doc)
+		if err != nil {
+			return &EditError{err}
+		}
+		result := &Session{}
+		if err = json.Unmarshal(patched, result); err != nil {
+			return &EditError{fmt.Errorf("patched session is invalid: %v", err)}
+		}
+		*session = *result
+		return nil
+	})
+}
+
+// EditError is returned when the requested change can't be applied to the session.
+type EditError struct {
+	Err error
+}
+
+func (e *EditError) Error() string {
+	return e.Err.Error()
+}
+
+// AddItem inserts the item at the position, a negative or too large position appends the item.
+func (s *Sessions) AddItem(sessionID string, expected int, author string, item *SessionItem, position int) (*Session, error) {
+	return s.Edit(sessionID, expected, author, "item added", func(session *Session) error {
+		if item == nil {
+			return &EditError{fmt.Errorf("item must be provided")}
+		}
+		if (item.ID != uuid.UUID{}) && session.position(item.ID) >= 0 {
+			return &EditError{fmt.Errorf("item %v already exists", item.ID)}
+		}
+		session.Items = insertItem(session.Items, item, position)
+		return nil
+	})
+}
+
+// UpdateItem replaces the item with the same ID.
+func (s *Sessions) UpdateItem(expected int, author string, item *SessionItem) (*Session, error) {
+	session, err := s.sessionOfItem(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "item updated", func(session *Session) error {
+		i := session.position(item.ID)
+		if i < 0 {
+			return &EditError{fmt.Errorf("item %v not found", item.ID)}
+		}
+		session.Items[i] = item
+		return nil
+	})
+}
+
+// DeleteItem removes the item and clears references to it.
+func (s *Sessions) DeleteItem(expected int, author string, itemID uuid.UUID) (*Session, error) {
+	session, err := s.sessionOfItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "item deleted", func(session *Session) error {
+		i := session.position(itemID)
+		if i < 0 {
+			return &EditError{fmt.Errorf("item %v not found", itemID)}
+		}
+		session.Items = append(session.Items[:i], session.Items[i+1:]...)
+		clearReferences(session, itemID)
+		return nil
+	})
+}
+
+// MoveItem changes the position of the item within its session.
+func (s *Sessions) MoveItem(expected int, author string, itemID uuid.UUID, position int) (*Session, error) {
+	session, err := s.sessionOfItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "item moved", func(session *Session) error {
+		i := session.position(itemID)
+		if i < 0 {
+			return &EditError{fmt.Errorf("item %v not found", itemID)}
+		}
+		item := session.Items[i]
+		session.Items = append(session.Items[:i], session.Items[i+1:]...)
+		session.Items = insertItem(session.Items, item, position)
+		return nil
+	})
+}
+
+// AddAction inserts the action into the item at the position, a negative or too large position appends
+// the action.
+func (s *Sessions) AddAction(expected int, author string, itemID uuid.UUID, action *instruction.Action, position int) (*Session, error) {
+	session, err := s.sessionOfItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "action added", func(session *Session) error {
+		return addAction(session, itemID, action, position)
+	})
+}
+
+func addAction(session *Session, itemID uuid.UUID, action *instruction.Action, position int) error {
+	if action == nil {
+		return &EditError{fmt.Errorf("action must be provided")}
+	}
+	i := session.position(itemID)
+	if i < 0 { // the item has been deleted since its session was found
+		return &EditError{fmt.Errorf("item %v not found", itemID)}
+	}
+	item := session.Items[i]
+	if (action.ID != uuid.UUID{}) && item.hasAction(action.ID) {
+		return &EditError{fmt.Errorf("action %v already exists", action.ID)}
+	}
+	item.Actions = insertAction(item.Actions, action, position)
+	return nil
+}
+
+// UpdateAction replaces the action with the same ID.
+func (s *Sessions) UpdateAction(expected int, author string, action *instruction.Action) (*Session, error) {
+	session, _, err := s.Locate(action.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "action updated", func(session *Session) error {
+		item, i := findAction(session, action.ID)
+		if item == nil {
+			return &EditError{fmt.Errorf("action %v not found", action.ID)}
+		}
+		item.Actions[i] = action
+		return nil
+	})
+}
+
+// DeleteAction removes the action from its item together with branches which refer to it.
+func (s *Sessions) DeleteAction(expected int, author string, actionID uuid.UUID) (*Session, error) {
+	session, _, err := s.Locate(actionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "action deleted", func(session *Session) error {
+		item, i := findAction(session, actionID)
+		if item == nil {
+			return &EditError{fmt.Errorf("action %v not found", actionID)}
+		}
+		item.Actions = append(item.Actions[:i], item.Actions[i+1:]...)
+		branches := []*Branch{}
+		for _, b := range item.Branches {
+			if b != nil && b.ActionID != actionID {
+				branches = append(branches, b)
+			}
+		}
+		item.Branches = branches
+		return nil
+	})
+}
+
+// MoveAction changes the position of the action, the action is moved to another item of the same session
+// if the item's ID is provided.
+func (s *Sessions) MoveAction(expected int, author string, actionID uuid.UUID, itemID uuid.UUID, position int) (*Session, error) {
+	session, _, err := s.Locate(actionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Edit(session.ID.String(), expected, author, "action moved", func(session *Session) error {
+		from, i := findAction(session, actionID)
+		if from == nil {
+			return &EditError{fmt.Errorf("action %v not found", actionID)}
+		}
+		to := from
+		if (itemID != uuid.UUID{}) {
+			j := session.position(itemID)
+			if j < 0 {
+				return &EditError{fmt.Errorf("item %v isn't in the session of the action", itemID)}
+			}
+			to = session.Items[j]
+		}
+
+		action := from.Actions[i]
+		from.Actions = append(from.Actions[:i], from.Actions[i+1:]...)
+		to.Actions = insertAction(to.Actions, action, position)
+		if to != from {
+			branches := []*Branch{}
+			for _, b := range from.Branches {
+				if b != nil && b.ActionID != actionID {
+					branches = append(branches, b)
+				}
+			}
+			from.Branches = branches
+		}
+		return nil
+	})
+}
+
+func (s *Sessions) sessionOfItem(itemID uuid.UUID) (*Session, error) {
+	for _, session := range s.Sessions {
+		if session.position(itemID) >= 0 {
+			return session, nil
+		}
+	}
+	return nil, fmt.Errorf("item not found: %v", itemID)
+}
+
+func findAction(session *Session, actionID uuid.UUID) (*SessionItem, int) {
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		for i, action := range item.Actions {
+			if action != nil && action.ID == actionID {
+				return item, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// clearReferences removes transitions to the deleted item.
+func clearReferences(session *Session, itemID uuid.UUID) {
+	if session.StartItemID == itemID {
+		session.StartItemID = uuid.UUID{}
+	}
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		if item.Next == itemID {
+			item.Next = uuid.UUID{}
+		}
+		branches := []*Branch{}
+		for _, b := range item.Branches {
+			if b != nil && b.NextItemID != itemID {
+				branches = append(branches, b)
+			}
+		}
+		item.Branches = branches
+	}
+}
+
+func insertItem(items []*SessionItem, item *SessionItem, position int) []*SessionItem {
+	if position < 0 || position > len(items) {
+		position = len(items)
+	}
+	return append(items[:position:position], append([]*SessionItem{item}, items[position:]...)...)
+}
+
+func insertAction(actions []*instruction.Action, action *instruction.Action, position int) []*instruction.Action {
+	if position < 0 || position > len(actions) {
+		position = len(actions)
+	}
+	return append(actions[:position:position], append([]*instruction.Action{action}, actions[position:]...)...)
+}
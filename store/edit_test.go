@@ -0,0 +1,140 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+// newTestSessions creates a session store with revisions in a temporary directory.
+func newTestSessions(t *testing.T) (*Sessions, string) {
+	t.Helper()
+	dir := t.TempDir()
+	revisions, err := NewRevisionsStore(filepath.Join(dir, "revisions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := NewSessionStore(filepath.Join(dir, "sessions.json"), revisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessions, dir
+}
+
+func writeTestFile(t *testing.T, fpath string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessions_EditKeepsFilesOfRevisions(t *testing.T) {
+	sessions, dir := newTestSessions(t)
+	oldAudio := filepath.Join(dir, "uploads", "old.mp3")
+	newAudio := filepath.Join(dir, "uploads", "new.mp3")
+	writeTestFile(t, oldAudio, "old")
+	writeTestFile(t, newAudio, "new")
+
+	actionID := uuid.New()
+	session := &Session{ID: uuid.New(), Name: "edit", Items: []*SessionItem{{ID: uuid.New(), Actions: []*instruction.Action{
+		{ID: actionID, SayItem: &instruction.Say{ID: uuid.New(), Phrase: "hi", FilePath: oldAudio}},
+	}}}}
+	if err := sessions.Create(session, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := sessions.Edit(session.ID.String(), 1, "test", "audio replaced", func(s *Session) error {
+		s.Items[0].Actions[0].SayItem.FilePath = newAudio
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists(oldAudio) {
+		t.Fatal("the replaced file is removed while revision 1 refers to it")
+	}
+
+	_, missing, err := sessions.Restore(session.ID.String(), 1, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) > 0 {
+		t.Fatalf("restored revision has missing files: %v", missing)
+	}
+
+	if err = sessions.Delete(session.ID.String(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(oldAudio) || !exists(newAudio) {
+		t.Fatal("files of a session in the trash are removed")
+	}
+	if err = sessions.Purge(session.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if exists(oldAudio) || exists(newAudio) {
+		t.Fatal("files of the purged session and its revisions are kept")
+	}
+}
+
+func TestSessions_PurgeKeepsFilesOfOtherSessions(t *testing.T) {
+	sessions, dir := newTestSessions(t)
+	shared := filepath.Join(dir, "uploads", "shared.png")
+	writeTestFile(t, shared, "png")
+
+	newSession := func() *Session {
+		return &Session{ID: uuid.New(), Name: uuid.New().String(), Items: []*SessionItem{{ID: uuid.New(), Actions: []*instruction.Action{
+			{ID: uuid.New(), ImageItem: &instruction.ShowImage{ID: uuid.New(), FilePath: shared}},
+		}}}}
+	}
+	a, b := newSession(), newSession()
+	for _, s := range []*Session{a, b} {
+		if err := sessions.Create(s, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sessions.Delete(a.ID.String(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessions.Purge(a.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(shared) {
+		t.Fatal("a file used by another session is removed")
+	}
+}
+
+func TestSessions_EditConflict(t *testing.T) {
+	sessions, _ := newTestSessions(t)
+	session := &Session{ID: uuid.New(), Name: "conflict"}
+	if err := sessions.Create(session, "test"); err != nil {
+		t.Fatal(err)
+	}
+	rename := func(s *Session) error {
+		s.Name += "!"
+		return nil
+	}
+	if _, err := sessions.Edit(session.ID.String(), 1, "a", "", rename); err != nil {
+		t.Fatal(err)
+	}
+	_, err := sessions.Edit(session.ID.String(), 1, "b", "", rename)
+	if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("want ConflictError, got %v", err)
+	}
+}
+
+func TestAddAction_DeletedItem(t *testing.T) {
+	session := &Session{ID: uuid.New(), Items: []*SessionItem{{ID: uuid.New()}}}
+	// the item has been deleted after AddAction has found its session
+	err := addAction(session, uuid.New(), &instruction.Action{ID: uuid.New()}, -1)
+	if _, ok := err.(*EditError); !ok {
+		t.Fatalf("want EditError, got %v", err)
+	}
+}
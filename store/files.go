@@ -1,11 +1,16 @@
 package store
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path"
+	"strings"
 )
 
+// UploadsDir keeps uploaded files, sessions refer to them by paths in it, e.g., data/uploads/a.png.
+const UploadsDir = "data/uploads"
+
 type Files struct {
 	base string
 }
@@ -43,3 +48,35 @@ func (s *Files) Get(name string) (*os.File, error) {
 func (s *Files) Delete(filename string) error {
 	return removeFile(filename)
 }
+
+// UploadPath converts a path of an uploaded file written by a person relative to the data directory, e.g.,
+// uploads/a.png, or as sessions keep it, e.g., data/uploads/a.png, to the path kept in sessions. Paths outside
+// of uploads and missing files are rejected.
+func UploadPath(p string) (string, error) {
+	var name string
+	switch {
+	case strings.HasPrefix(p, UploadsDir+"/"):
+		name = strings.TrimPrefix(p, UploadsDir+"/")
+	case strings.HasPrefix(p, "uploads/"):
+		name = strings.TrimPrefix(p, "uploads/")
+	default:
+		return "", fmt.Errorf("%q isn't in uploads, files must be uploaded first and referred to as uploads/<name>", p)
+	}
+	if !isUploadName(name) {
+		return "", fmt.Errorf("%q isn't a file directly in uploads", p)
+	}
+	fpath := path.Join(UploadsDir, name)
+	if _, err := os.Stat(fpath); err != nil {
+		return "", fmt.Errorf("file %q not found in uploads", p)
+	}
+	return fpath, nil
+}
+
+// IsUploadPath tells whether the path kept in a session refers to a file directly in uploads.
+func IsUploadPath(p string) bool {
+	return strings.HasPrefix(p, UploadsDir+"/") && isUploadName(strings.TrimPrefix(p, UploadsDir+"/"))
+}
+
+func isUploadName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
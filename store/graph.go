@@ -0,0 +1,219 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of transitions between session items.
+const (
+	EdgeBranch   = "branch"   // the answer action has been picked
+	EdgeNext     = "next"     // the explicit next item
+	EdgeSequence = "sequence" // the following item in the list
+)
+
+// Graph represents a session as a directed graph of items for visualisation.
+type Graph struct {
+	StartItemID uuid.UUID     `json:"start_item_id"`
+	Nodes       []*GraphNode  `json:"nodes"`
+	Edges       []*GraphEdge  `json:"edges"`
+	Problems    []*GraphIssue `json:"problems"`
+}
+
+type GraphNode struct {
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`
+	Position int       `json:"position"`
+	IsStart  bool      `json:"is_start"`
+	IsEnd    bool      `json:"is_end"`
+}
+
+type GraphEdge struct {
+	From     uuid.UUID `json:"from"`
+	To       uuid.UUID `json:"to"`
+	Kind     string    `json:"kind"`
+	ActionID uuid.UUID `json:"action_id,omitempty"`
+}
+
+// GraphIssue is a problem of the session's structure.
+type GraphIssue struct {
+	ItemID  uuid.UUID `json:"item_id"`
+	Problem string    `json:"problem"`
+}
+
+// StartPosition returns the index of the start item, it's the first item if StartItemID isn't set or is unknown.
+func (s *Session) StartPosition() int {
+	if i := s.position(s.StartItemID); i >= 0 {
+		return i
+	}
+	return 0
+}
+
+// Next returns the index of the item which follows the item at the position when the answer action
+// has been picked, actionID can be empty. It's false when the session ends.
+func (s *Session) Next(position int, actionID uuid.UUID) (int, bool) {
+	if position < 0 || position >= len(s.Items) || s.Items[position] == nil {
+		return 0, false
+	}
+	item := s.Items[position]
+
+	if (actionID != uuid.UUID{}) {
+		for _, b := range item.Branches {
+			if b != nil && b.ActionID == actionID {
+				if i := s.position(b.NextItemID); i >= 0 {
+					return i, true
+				}
+			}
+		}
+	}
+	if item.End {
+		return 0, false
+	}
+	if (item.Next != uuid.UUID{}) {
+		i := s.position(item.Next)
+		return i, i >= 0
+	}
+	if position+1 < len(s.Items) {
+		return position + 1, true
+	}
+	return 0, false
+}
+
+// Graph returns the session's items as nodes and transitions between them as edges together with
+// problems of the structure: dangling references, unreachable items and dead ends.
+func (s *Session) Graph() *Graph {
+	g := &Graph{
+		Nodes:    []*GraphNode{},
+		Edges:    []*GraphEdge{},
+		Problems: []*GraphIssue{},
+	}
+	if len(s.Items) == 0 {
+		return g
+	}
+
+	start := s.StartPosition()
+	if s.Items[start] != nil {
+		g.StartItemID = s.Items[start].ID
+	}
+	if (s.StartItemID != uuid.UUID{}) && s.position(s.StartItemID) < 0 {
+		g.Problems = append(g.Problems, &GraphIssue{ItemID: s.StartItemID, Problem: "start item doesn't exist"})
+	}
+
+	adjacent := make([][]int, len(s.Items))
+	ends := map[int]bool{}
+	for i, item := range s.Items {
+		if item == nil {
+			continue
+		}
+
+		node := &GraphNode{ID: item.ID, Title: item.Title, Position: i, IsStart: i == start}
+		g.Nodes = append(g.Nodes, node)
+
+		for _, b := range item.Branches {
+			if b == nil {
+				continue
+			}
+			if !item.hasAction(b.ActionID) {
+				g.Problems = append(g.Problems, &GraphIssue{
+					ItemID:  item.ID,
+					Problem: fmt.Sprintf("branch refers to the action %s which isn't in the item", b.ActionID),
+				})
+			}
+			j := s.position(b.NextItemID)
+			if j < 0 {
+				g.Problems = append(g.Problems, &GraphIssue{
+					ItemID:  item.ID,
+					Problem: fmt.Sprintf("branch leads to the item %s which doesn't exist", b.NextItemID),
+				})
+				continue
+			}
+			g.Edges = append(g.Edges, &GraphEdge{From: item.ID, To: b.NextItemID, Kind: EdgeBranch, ActionID: b.ActionID})
+			adjacent[i] = append(adjacent[i], j)
+		}
+
+		if (item.Next != uuid.UUID{}) && s.position(item.Next) < 0 {
+			g.Problems = append(g.Problems, &GraphIssue{
+				ItemID:  item.ID,
+				Problem: fmt.Sprintf("next item %s doesn't exist", item.Next),
+			})
+		}
+		if j, ok := s.Next(i, uuid.UUID{}); ok {
+			kind := EdgeSequence
+			if (item.Next != uuid.UUID{}) {
+				kind = EdgeNext
+			}
+			g.Edges = append(g.Edges, &GraphEdge{From: item.ID, To: s.Items[j].ID, Kind: kind})
+			adjacent[i] = append(adjacent[i], j)
+		} else {
+			node.IsEnd = true
+			ends[i] = true
+		}
+	}
+
+	// unreachable items: there is no path from the start
+	reachable := traverse([]int{start}, adjacent)
+	for i, item := range s.Items {
+		if item != nil && !reachable[i] {
+			g.Problems = append(g.Problems, &GraphIssue{ItemID: item.ID, Problem: "item is unreachable from the start"})
+		}
+	}
+
+	// dead ends: there is no path to any end of the session, e.g., items are looped
+	reverse := make([][]int, len(s.Items))
+	for i, targets := range adjacent {
+		for _, j := range targets {
+			reverse[j] = append(reverse[j], i)
+		}
+	}
+	endPositions := []int{}
+	for i := range ends {
+		endPositions = append(endPositions, i)
+	}
+	leadsToEnd := traverse(endPositions, reverse)
+	for i, item := range s.Items {
+		if item != nil && reachable[i] && !leadsToEnd[i] {
+			g.Problems = append(g.Problems, &GraphIssue{ItemID: item.ID, Problem: "item is a dead end, the session can't end from it"})
+		}
+	}
+
+	return g
+}
+
+// position returns the index of the item with the ID or -1.
+func (s *Session) position(id uuid.UUID) int {
+	if (id == uuid.UUID{}) {
+		return -1
+	}
+	for i, item := range s.Items {
+		if item != nil && item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (si *SessionItem) hasAction(id uuid.UUID) bool {
+	for _, action := range si.Actions {
+		if action != nil && action.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// traverse returns positions reachable from the provided ones.
+func traverse(from []int, adjacent [][]int) map[int]bool {
+	visited := map[int]bool{}
+	queue := append([]int{}, from...)
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+		queue = append(queue, adjacent[i]...)
+	}
+	return visited
+}
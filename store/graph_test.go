@@ -0,0 +1,113 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+// newTestGraph is a session: intro -> question -(yes)-> farewell, question -(no)-> extra -> farewell (end),
+// the session starts from the question.
+func newTestGraph() (*Session, uuid.UUID, uuid.UUID) {
+	yes, no := uuid.New(), uuid.New()
+	intro := &SessionItem{ID: uuid.New(), Title: "Intro"}
+	question := &SessionItem{ID: uuid.New(), Title: "Question", Actions: []*instruction.Action{{ID: uuid.New()}, {ID: yes}, {ID: no}}}
+	extra := &SessionItem{ID: uuid.New(), Title: "Extra"}
+	farewell := &SessionItem{ID: uuid.New(), Title: "Farewell", End: true}
+	question.Branches = []*Branch{{ActionID: yes, NextItemID: farewell.ID}}
+	question.Next = extra.ID
+	session := &Session{ID: uuid.New(), StartItemID: question.ID, Items: []*SessionItem{intro, question, extra, farewell}}
+	return session, yes, no
+}
+
+func TestSession_Next(t *testing.T) {
+	session, yes, no := newTestGraph()
+
+	tests := []struct {
+		name     string
+		position int
+		action   uuid.UUID
+		want     int
+		ok       bool
+	}{
+		{"sequence", 0, uuid.UUID{}, 1, true},
+		{"branch", 1, yes, 3, true},
+		{"no branch for the action", 1, no, 2, true},
+		{"next without an action", 1, uuid.UUID{}, 2, true},
+		{"sequence to the end", 2, uuid.UUID{}, 3, true},
+		{"end", 3, uuid.UUID{}, 0, false},
+		{"out of range", 4, uuid.UUID{}, 0, false},
+		{"negative", -1, uuid.UUID{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := session.Next(tt.position, tt.action)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("got %d, %v, want %d, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	if start := session.StartPosition(); start != 1 {
+		t.Fatalf("the start position is %d, want 1", start)
+	}
+	session.Items[1].Next = uuid.New()
+	if _, ok := session.Next(1, uuid.UUID{}); ok {
+		t.Fatal("a missing next item doesn't end the session")
+	}
+	session.StartItemID = uuid.New()
+	if start := session.StartPosition(); start != 0 {
+		t.Fatalf("the start position of a missing start item is %d, want 0", start)
+	}
+}
+
+func TestSession_Graph(t *testing.T) {
+	session, yes, _ := newTestGraph()
+	g := session.Graph()
+
+	if g.StartItemID != session.Items[1].ID || len(g.Nodes) != 4 {
+		t.Fatalf("unexpected graph %+v", g)
+	}
+	kinds := map[string]int{}
+	for _, e := range g.Edges {
+		kinds[e.Kind]++
+		if e.Kind == EdgeBranch && e.ActionID != yes {
+			t.Fatalf("the branch has the action %v, want %v", e.ActionID, yes)
+		}
+	}
+	if kinds[EdgeBranch] != 1 || kinds[EdgeNext] != 1 || kinds[EdgeSequence] != 2 {
+		t.Fatalf("unexpected edges %v", kinds)
+	}
+	if !g.Nodes[3].IsEnd || !g.Nodes[1].IsStart {
+		t.Fatal("the start or the end isn't marked")
+	}
+	if len(g.Problems) != 1 || g.Problems[0].ItemID != session.Items[0].ID || !strings.Contains(g.Problems[0].Problem, "unreachable") {
+		t.Fatalf("want the intro to be unreachable, got %+v", g.Problems)
+	}
+}
+
+func TestSession_GraphProblems(t *testing.T) {
+	session, _, _ := newTestGraph()
+	question, extra := session.Items[1], session.Items[2]
+	// the branch to the end is replaced, so the question and the extra loop without an end
+	question.Branches = []*Branch{
+		{ActionID: uuid.New(), NextItemID: extra.ID},
+		{ActionID: question.Actions[0].ID, NextItemID: uuid.New()},
+	}
+	extra.Next = question.ID
+	session.StartItemID = uuid.New()
+
+	problems := []string{}
+	for _, p := range session.Graph().Problems {
+		problems = append(problems, p.Problem)
+	}
+	all := strings.Join(problems, "; ")
+	for _, want := range []string{"start item doesn't exist", "isn't in the item", "doesn't exist", "dead end"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("want a problem %q, got %s", want, all)
+		}
+	}
+}
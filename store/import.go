@@ -0,0 +1,741 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/qianim"
+)
+
+// Limits of an imported archive, sizes are in bytes of uncompressed entries.
+const (
+	maxImportEntries     = 10000
+	maxImportEntrySize   = 100 << 20
+	maxImportSize        = 1 << 30
+	maxImportSessionSize = 10 << 20
+)
+
+// importFileTypes are extensions of files which can be imported to uploads.
+var importFileTypes = map[string]bool{
+	".mp3": true, ".wav": true, ".ogg": true, ".m4a": true, ".aac": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true,
+	".qianim": true,
+}
+
+// ImportMode tells what happens when the imported session already exists.
+type ImportMode string
+
+const (
+	ImportCreate    ImportMode = "create"    // the import fails if the session exists
+	ImportOverwrite ImportMode = "overwrite" // the existing session is replaced
+	ImportAsNew     ImportMode = "new"       // the session is imported as a copy with new IDs and file names
+)
+
+// ImportProblem is a reason why an archive can't be imported, Entry is the archive entry it concerns if any.
+type ImportProblem struct {
+	Entry   string `json:"entry"`
+	Message string `json:"message"`
+}
+
+// ImportReport describes an imported session or problems which have prevented the import.
+type ImportReport struct {
+	SessionID   uuid.UUID        `json:"session_id"`
+	Name        string           `json:"name"`
+	Overwritten bool             `json:"overwritten"` // an existing session has been replaced
+	Files       []string         `json:"files"`       // saved uploads
+	Problems    []*ImportProblem `json:"problems"`
+
+	FormatVersion int      `json:"format_version"` // of the archive, 1 for archives without a manifest
+	GarlicVersion string   `json:"garlic_version"` // which has exported the archive if known
+	AddedMoves    []string `json:"added_moves"`    // names of moves added to the moves store
+	MissingMoves  []string `json:"missing_moves"`  // names of moves which are neither in the archive nor on the server
+}
+
+func (r *ImportReport) problem(entry, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, &ImportProblem{Entry: entry, Message: fmt.Sprintf(format, args...)})
+}
+
+// ImportError is returned when an archive can't be imported, nothing has been changed in this case.
+type ImportError struct {
+	Report *ImportReport
+}
+
+func (e *ImportError) Error() string {
+	messages := make([]string, len(e.Report.Problems))
+	for i, p := range e.Report.Problems {
+		if p.Entry != "" {
+			messages[i] = p.Entry + ": " + p.Message
+		} else {
+			messages[i] = p.Message
+		}
+	}
+	return "the session can't be imported: " + strings.Join(messages, "; ")
+}
+
+// Import creates a session from an archive made by Session.Export. Depending on the mode, the session with
+// the same ID is replaced or the session is imported as a copy, so the same archive can be imported several
+// times. The archive structure, entry sizes, file types, checksums from the manifest and the session are
+// checked before anything is saved, sessions of older archive format versions are migrated. Moves of the
+// session which are missing in moves are added to it from the archive or uploads, see resolveMoves.
+// Uploads replace files with the same names on the server only when overwriting, otherwise, uploads which differ
+// from the existing files are saved under new names. Uploads and moves are saved only if the session is saved too. An ImportError with all found problems is
+// returned if the archive can't be imported.
+func (s *Sessions) Import(fpath string, mode ImportMode, fileStore *Files, moves *Moves) (*ImportReport, error) {
+	report := &ImportReport{Files: []string{}, Problems: []*ImportProblem{}, AddedMoves: []string{}, MissingMoves: []string{}}
+
+	r, err := zip.OpenReader(fpath)
+	if err != nil {
+		report.problem("", "the file isn't a valid ZIP archive: %v", err)
+		return report, &ImportError{report}
+	}
+	defer r.Close()
+
+	a := readArchive(&r.Reader, report)
+	if len(report.Problems) > 0 {
+		return report, &ImportError{report}
+	}
+	session := a.session
+	if mode == ImportAsNew {
+		a.uploads = renewImported(session, a.uploads)
+	}
+	if mode != ImportOverwrite {
+		// only overwriting may replace existing uploads
+		if a.uploads, err = renameClashingUploads(session, a.uploads, fileStore); err != nil {
+			report.problem("", "%v", err)
+			return report, &ImportError{report}
+		}
+	}
+	report.SessionID = session.ID
+	report.Name = session.Name
+	report.Overwritten = mode == ImportOverwrite && s.isDuplicate(session)
+
+	newMoves := resolveMoves(a, moves, fileStore, report)
+	s.checkImportedSession(session, mode == ImportOverwrite, a.uploads, fileStore, moves, report)
+	if len(report.Problems) > 0 {
+		return report, &ImportError{report}
+	}
+
+	staged := stageUploads(a.uploads, fileStore, report)
+	if len(report.Problems) > 0 {
+		removeStaged(staged)
+		return report, &ImportError{report}
+	}
+
+	committed, err := commitUploads(staged, fileStore)
+	if err != nil {
+		removeStaged(staged)
+		report.problem("", "failed to save uploads: %v", err)
+		return report, &ImportError{report}
+	}
+
+	if err = moves.CreateMany(newMoves); err != nil {
+		committed.rollback()
+		report.problem("", "failed to add moves: %v", err)
+		return report, &ImportError{report}
+	}
+
+	if report.Overwritten {
+		s.editMu.Lock()
+		err = s.update(session, "", "imported")
+		s.editMu.Unlock()
+	} else {
+		err = s.Create(session, "")
+	}
+	if err != nil {
+		if e := moves.remove(newMoves); e != nil {
+			log.Println("failed to remove moves after the failed import:", e)
+		}
+		committed.rollback()
+		report.problem("session.json", "failed to save the session: %v", err)
+		return report, &ImportError{report}
+	}
+	committed.clean()
+
+	report.SessionID = session.ID
+	for name := range staged {
+		report.Files = append(report.Files, path.Join(fileStore.base, name))
+	}
+	sort.Strings(report.Files)
+	for _, m := range newMoves {
+		report.AddedMoves = append(report.AddedMoves, m.Name)
+	}
+	return report, nil
+}
+
+// archive is the checked content of an imported archive.
+type archive struct {
+	session  *Session
+	manifest *Manifest
+	uploads  map[string]*zip.File // by names
+	moves    map[string]*zip.File // bundled moves by paths in the archive
+}
+
+// readArchive checks the structure of the archive, verifies it by the manifest and decodes the session migrating
+// it from older format versions.
+func readArchive(r *zip.Reader, report *ImportReport) *archive {
+	a := &archive{uploads: map[string]*zip.File{}, moves: map[string]*zip.File{}}
+	entries := map[string]*zip.File{} // files except the manifest
+	var sessionFile, manifestFile *zip.File
+
+	if len(r.File) > maxImportEntries {
+		report.problem("", "the archive has %d entries, at most %d are allowed", len(r.File), maxImportEntries)
+		return a
+	}
+
+	var total uint64
+	for _, f := range r.File {
+		total += f.UncompressedSize64
+		if f.FileInfo().IsDir() {
+			if f.Name != "uploads/" && !strings.HasPrefix(f.Name, "moves/") {
+				report.problem(f.Name, "unexpected directory, only uploads/ and moves/ are allowed")
+			}
+			continue
+		}
+		if _, ok := entries[f.Name]; ok || (f.Name == manifestFileName && manifestFile != nil) {
+			report.problem(f.Name, "the file is in the archive twice")
+			continue
+		}
+		if f.UncompressedSize64 > maxImportEntrySize {
+			report.problem(f.Name, "the file is larger than %d bytes", maxImportEntrySize)
+			continue
+		}
+		switch {
+		case f.Name == manifestFileName:
+			if f.UncompressedSize64 > maxImportSessionSize {
+				report.problem(f.Name, "the file is larger than %d bytes", maxImportSessionSize)
+				continue
+			}
+			manifestFile = f
+			continue
+		case f.Name == "session.json":
+			if f.UncompressedSize64 > maxImportSessionSize {
+				report.problem(f.Name, "the file is larger than %d bytes", maxImportSessionSize)
+				continue
+			}
+			sessionFile = f
+		case strings.HasPrefix(f.Name, "uploads/"):
+			name := strings.TrimPrefix(f.Name, "uploads/")
+			if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+				report.problem(f.Name, "invalid file name, uploads must be files directly in uploads/")
+				continue
+			}
+			if !importFileTypes[strings.ToLower(filepath.Ext(name))] {
+				report.problem(f.Name, "the file type isn't allowed")
+				continue
+			}
+			a.uploads[name] = f
+		case strings.HasPrefix(f.Name, "moves/"):
+			if !isBundledMove(f.Name) {
+				report.problem(f.Name, "invalid move, moves must be .qianim files in folders of moves/")
+				continue
+			}
+			a.moves[f.Name] = f
+		default:
+			report.problem(f.Name, "unexpected entry, only manifest.json, session.json, uploads/ and moves/ are allowed")
+			continue
+		}
+		entries[f.Name] = f
+	}
+
+	if total > maxImportSize {
+		report.problem("", "the archive unpacks to %d bytes, at most %d are allowed", total, maxImportSize)
+	}
+	if len(report.Problems) > 0 {
+		return a
+	}
+
+	a.manifest = readManifest(manifestFile, report)
+	if a.manifest == nil {
+		return a
+	}
+	report.FormatVersion = a.manifest.FormatVersion
+	report.GarlicVersion = a.manifest.GarlicVersion
+	verifyManifest(a.manifest, entries, report)
+	if len(report.Problems) > 0 {
+		return a
+	}
+
+	if sessionFile == nil {
+		report.problem("session.json", "the archive has no session")
+		return a
+	}
+	a.session = decodeImportedSession(sessionFile, a.manifest.FormatVersion, report)
+	return a
+}
+
+// isBundledMove tells whether the archive path is a move file of a folder in moves/.
+func isBundledMove(name string) bool {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != "moves" || strings.ContainsRune(name, '\\') {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return strings.ToLower(filepath.Ext(name)) == ".qianim"
+}
+
+func decodeImportedSession(f *zip.File, version int, report *ImportReport) *Session {
+	rc, err := f.Open()
+	if err != nil {
+		report.problem(f.Name, "failed to open: %v", err)
+		return nil
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(rc, maxImportSessionSize))
+	if err != nil {
+		report.problem(f.Name, "failed to read: %v", err)
+		return nil
+	}
+	if b, err = migrateSession(b, version); err != nil {
+		report.problem(f.Name, "the session can't be migrated: %v", err)
+		return nil
+	}
+
+	session := &Session{}
+	if err = json.Unmarshal(b, session); err != nil {
+		report.problem(f.Name, "the session can't be decoded: %v", err)
+		return nil
+	}
+	return session
+}
+
+// renewImported gives the session new IDs and uploads new names, paths in the session are rewritten to the new
+// names. Uploads are returned by their new names.
+func renewImported(session *Session, uploads map[string]*zip.File) map[string]*zip.File {
+	renewSessionIDs(session)
+	return renameUploads(session, uploads, func(string) bool { return true })
+}
+
+// renameClashingUploads gives new names to uploads which would replace different files on the server, so
+// importing a session doesn't change files of other sessions. Uploads with the same content as the existing
+// files keep their names. Uploads are returned by their new names.
+func renameClashingUploads(session *Session, uploads map[string]*zip.File, fileStore *Files) (map[string]*zip.File, error) {
+	var err error
+	renamed := renameUploads(session, uploads, func(name string) bool {
+		existing := path.Join(fileStore.base, name)
+		if _, e := os.Stat(existing); e != nil || err != nil {
+			return false
+		}
+		same, e := sameContent(uploads[name], existing)
+		if e != nil {
+			err = fmt.Errorf("failed to compare %s with the existing file: %v", name, e)
+		}
+		return !same
+	})
+	return renamed, err
+}
+
+// renameUploads gives new names to uploads for which rename is true and rewrites paths in the session to them.
+// Uploads are returned by their new names.
+func renameUploads(session *Session, uploads map[string]*zip.File, rename func(name string) bool) map[string]*zip.File {
+	names := map[string]string{}
+	renamed := map[string]*zip.File{}
+	for name, f := range uploads {
+		if !rename(name) {
+			renamed[name] = f
+			continue
+		}
+		newName := uuid.Must(uuid.NewRandom()).String() + strings.ToLower(filepath.Ext(name))
+		names[name] = newName
+		renamed[newName] = f
+	}
+	if len(names) == 0 {
+		return renamed
+	}
+
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		for _, action := range item.Actions {
+			for _, fpath := range assetPaths(action) {
+				if !strings.HasPrefix(*fpath, "data/uploads/") {
+					continue
+				}
+				if newName, ok := names[path.Base(*fpath)]; ok {
+					*fpath = path.Join(path.Dir(*fpath), newName)
+				}
+			}
+		}
+	}
+	return renamed
+}
+
+// sameContent tells whether the archive entry has the same content as the file.
+func sameContent(f *zip.File, fpath string) (bool, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return false, err
+	}
+	if uint64(info.Size()) != f.UncompressedSize64 {
+		return false, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	file, err := os.Open(fpath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	a := make([]byte, 32<<10)
+	b := make([]byte, 32<<10)
+	for {
+		na, errA := io.ReadFull(rc, a)
+		nb, errB := io.ReadFull(file, b)
+		if na != nb || !bytes.Equal(a[:na], b[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// assetPaths returns pointers to paths of all files used by the action and its variants.
+func assetPaths(a *instruction.Action) []*string {
+	paths := []*string{}
+	if a == nil {
+		return paths
+	}
+	if a.SayItem != nil {
+		paths = append(paths, &a.SayItem.FilePath)
+		for _, t := range a.SayItem.Translations {
+			if t != nil {
+				paths = append(paths, &t.FilePath)
+			}
+		}
+	}
+	if a.MoveItem != nil {
+		paths = append(paths, &a.MoveItem.FilePath)
+	}
+	if a.ImageItem != nil {
+		paths = append(paths, &a.ImageItem.FilePath)
+	}
+	if a.VariantsItem != nil {
+		for _, e := range a.VariantsItem.Entries {
+			if e != nil {
+				paths = append(paths, assetPaths(e.Action)...)
+			}
+		}
+	}
+	return paths
+}
+
+// moveItems returns moves of the action and its variants.
+func moveItems(a *instruction.Action) []*instruction.Move {
+	moves := []*instruction.Move{}
+	if a == nil {
+		return moves
+	}
+	if a.MoveItem != nil {
+		moves = append(moves, a.MoveItem)
+	}
+	if a.VariantsItem != nil {
+		for _, e := range a.VariantsItem.Entries {
+			if e != nil {
+				moves = append(moves, moveItems(e.Action)...)
+			}
+		}
+	}
+	return moves
+}
+
+// resolveMoves points moves of the session to moves of the store with the same names, because built-in moves
+// are located in different folders on different instances. A move which isn't in the store is added to it only
+// from a file of the archive: a bundled move is unpacked to uploads, a move from uploads is taken as it is, both
+// are checked with other uploads of the archive. Other moves are reported as missing and lose their paths,
+// the session is imported anyway, but they can't be played until they are added to the store.
+func resolveMoves(a *archive, moves *Moves, fileStore *Files, report *ImportReport) []*instruction.Move {
+	bundled := map[string]*zip.File{} // by paths referenced by the session
+	for _, m := range a.manifest.Moves {
+		if m == nil || m.Path == "" {
+			continue
+		}
+		f, ok := a.moves[m.Path]
+		if !ok {
+			report.problem(m.Path, "the move %q is listed in the manifest, but it's missing in the archive", m.Name)
+			continue
+		}
+		bundled[m.FilePath] = f
+	}
+
+	added := map[string]*instruction.Move{} // by names
+	newMoves := []*instruction.Move{}
+	missing := map[string]bool{}
+	for _, item := range a.session.Items {
+		if item == nil {
+			continue
+		}
+		for _, action := range item.Actions {
+			for _, move := range moveItems(action) {
+				if move.FilePath == "" || move.Name == "" {
+					continue // the move is located on the robot
+				}
+				isUpload := IsUploadPath(move.FilePath)
+				if known, err := moves.GetByName(move.Name); err == nil {
+					if !isUpload {
+						move.FilePath = known.FilePath
+					}
+					continue
+				}
+				if m, ok := added[move.Name]; ok {
+					move.FilePath = m.FilePath
+					continue
+				}
+
+				f, isBundled := bundled[move.FilePath]
+				switch {
+				case isBundled && !isUpload:
+					name := uuid.Must(uuid.NewRandom()).String() + ".qianim"
+					a.uploads[name] = f
+					move.FilePath = path.Join(fileStore.base, name)
+				case isUpload && a.uploads[path.Base(move.FilePath)] != nil:
+					// the move is uploaded with the archive
+				case isUpload:
+					continue // the upload must be on the server, it's checked with other files of the session
+				default:
+					move.FilePath = ""
+					if !missing[move.Name] {
+						missing[move.Name] = true
+						report.MissingMoves = append(report.MissingMoves, move.Name)
+					}
+					continue
+				}
+
+				m := &instruction.Move{
+					ID:       uuid.Must(uuid.NewRandom()),
+					Name:     move.Name,
+					FilePath: move.FilePath,
+					Group:    move.Group,
+				}
+				added[m.Name] = m
+				newMoves = append(newMoves, m)
+			}
+		}
+	}
+	sort.Strings(report.MissingMoves)
+	return newMoves
+}
+
+// checkImportedSession checks the session's fields, references between its items and actions and that every
+// upload used by the session is either in the archive or already on the server. Files outside of uploads can
+// only be moves of the move library, other paths could make the server read any file.
+func (s *Sessions) checkImportedSession(session *Session, overwrite bool, uploads map[string]*zip.File, fileStore *Files, moves *Moves, report *ImportReport) {
+	const entry = "session.json"
+
+	if strings.TrimSpace(session.Name) == "" {
+		report.problem(entry, "the session has no name")
+	}
+	if !overwrite && s.isDuplicate(session) {
+		report.problem(entry, "session %v already exists, import with overwrite to replace it", session.ID)
+	}
+
+	items := map[uuid.UUID]bool{}
+	for i, item := range session.Items {
+		if item == nil {
+			report.problem(entry, "item %d is empty", i+1)
+			continue
+		}
+		if (item.ID != uuid.UUID{}) {
+			if items[item.ID] {
+				report.problem(entry, "item ID %v is used twice", item.ID)
+			}
+			items[item.ID] = true
+		}
+	}
+	isItem := func(id uuid.UUID) bool {
+		return id == uuid.UUID{} || items[id]
+	}
+	if !isItem(session.StartItemID) {
+		report.problem(entry, "the start item %v doesn't exist", session.StartItemID)
+	}
+
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		actions := map[uuid.UUID]bool{}
+		for j, action := range item.Actions {
+			if action == nil || !action.IsValid() {
+				report.problem(entry, "action %d of the item %q is invalid", j+1, item.Title)
+				continue
+			}
+			actions[action.ID] = true
+		}
+		if !isItem(item.Next) {
+			report.problem(entry, "the next item %v of the item %q doesn't exist", item.Next, item.Title)
+		}
+		for _, b := range item.Branches {
+			if b == nil {
+				continue
+			}
+			if !actions[b.ActionID] {
+				report.problem(entry, "a branch of the item %q refers to a missing action %v", item.Title, b.ActionID)
+			}
+			if !isItem(b.NextItemID) {
+				report.problem(entry, "a branch of the item %q refers to a missing item %v", item.Title, b.NextItemID)
+			}
+		}
+
+		for _, action := range item.Actions {
+			movePaths := map[*string]bool{}
+			for _, move := range moveItems(action) {
+				movePaths[&move.FilePath] = true
+			}
+			for _, asset := range assetPaths(action) {
+				switch {
+				case *asset == "":
+					continue
+				case movePaths[asset] && !IsUploadPath(*asset):
+					if !moves.hasFile(*asset) {
+						report.problem(entry, "the move %s used by the item %q is neither in uploads nor in the move library", *asset, item.Title)
+					}
+					continue
+				case !IsUploadPath(*asset):
+					report.problem(entry, "the file %s used by the item %q isn't in uploads", *asset, item.Title)
+					continue
+				}
+				name := path.Base(*asset)
+				if _, ok := uploads[name]; ok {
+					continue
+				}
+				if _, err := os.Stat(path.Join(fileStore.base, name)); err != nil {
+					report.problem(entry, "the file %s used by the item %q is neither in the archive nor on the server", *asset, item.Title)
+				}
+			}
+		}
+	}
+}
+
+// stageUploads unpacks uploads into temporary files next to their destinations and checks animations.
+// Paths of the staged files are returned by upload names.
+func stageUploads(uploads map[string]*zip.File, fileStore *Files, report *ImportReport) map[string]string {
+	staged := map[string]string{}
+	for name, f := range uploads {
+		tmp := path.Join(fileStore.base, ".import-"+uuid.Must(uuid.NewRandom()).String()+"-"+name)
+		if err := stageUpload(f, tmp); err != nil {
+			report.problem(f.Name, "%v", err)
+			_ = os.Remove(tmp)
+			continue
+		}
+		staged[name] = tmp
+	}
+	return staged
+}
+
+func stageUpload(f *zip.File, dst string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open: %v", err)
+	}
+	defer rc.Close()
+
+	b := &bytes.Buffer{}
+	n, err := io.Copy(b, io.LimitReader(rc, maxImportEntrySize+1))
+	if err != nil {
+		return fmt.Errorf("failed to unpack: %v", err)
+	}
+	if n > maxImportEntrySize {
+		return fmt.Errorf("the file is larger than %d bytes", maxImportEntrySize)
+	}
+
+	// animations can reach the robot, so they are checked like uploaded moves
+	if strings.ToLower(filepath.Ext(f.Name)) == ".qianim" {
+		anim, err := qianim.Parse(bytes.NewReader(b.Bytes()))
+		if err == nil {
+			err = qianim.Validate(anim)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid animation: %v", err)
+		}
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to save: %v", err)
+	}
+	if _, err = out.Write(b.Bytes()); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to save: %v", err)
+	}
+	return out.Close()
+}
+
+// removeStaged removes staged files which haven't been moved to their destinations.
+func removeStaged(staged map[string]string) {
+	for _, tmp := range staged {
+		if _, err := os.Stat(tmp); err == nil {
+			_ = removeFile(tmp)
+		}
+	}
+}
+
+// committedUploads are staged files moved to their destinations, files which they have replaced are kept
+// as backups until the import succeeds.
+type committedUploads struct {
+	moved   []string          // destinations
+	backups map[string]string // backups by destinations
+}
+
+// commitUploads moves staged files to their destinations, all files are put back on failure.
+func commitUploads(staged map[string]string, fileStore *Files) (*committedUploads, error) {
+	c := &committedUploads{moved: []string{}, backups: map[string]string{}}
+	for name, tmp := range staged {
+		dst := path.Join(fileStore.base, name)
+		if _, err := os.Stat(dst); err == nil {
+			backup := tmp + ".backup"
+			if err = os.Rename(dst, backup); err != nil {
+				c.rollback()
+				return nil, err
+			}
+			c.backups[dst] = backup
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			c.rollback()
+			return nil, err
+		}
+		c.moved = append(c.moved, dst)
+	}
+	return c, nil
+}
+
+func (c *committedUploads) rollback() {
+	removeFiles(c.moved)
+	for dst, backup := range c.backups {
+		_ = os.Rename(backup, dst)
+	}
+}
+
+func (c *committedUploads) clean() {
+	for _, backup := range c.backups {
+		_ = removeFile(backup)
+	}
+}
@@ -0,0 +1,487 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/internal/testdir"
+)
+
+// testAnimation is a valid animation for the robot.
+const testAnimation = `<?xml version="1.0" encoding="UTF-8"?>
+<Animation typeVersion="2.0">
+  <ActuatorList model="juliette">
+    <ActuatorCurve fps="25" actuator="HeadYaw" mute="false" unit="degree">
+      <Key value="-10" frame="10"/>
+      <Key value="20" frame="30"/>
+    </ActuatorCurve>
+  </ActuatorList>
+</Animation>
+`
+
+type testEntry struct {
+	name string
+	body string
+}
+
+// newTestImport creates stores for an import in the working directory, moves have Hey_1 in the library.
+func newTestImport(t *testing.T) (*Sessions, *Files, *Moves) {
+	t.Helper()
+	sessions, dir := newTestSessions(t)
+	writeTestFile(t, filepath.Join("anims", "Greetings", "Hey_1.qianim"), testAnimation)
+	moves, err := NewMoveStore(filepath.Join(dir, "moves.json"), "anims")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessions, NewFileStore(UploadsDir), moves
+}
+
+// writeTestArchive writes the entries to an archive with a manifest which lists them, edit changes the manifest
+// before it's written, the manifest isn't written for the format version 1.
+func writeTestArchive(t *testing.T, entries []testEntry, edit func(m *Manifest)) string {
+	t.Helper()
+	m := &Manifest{GarlicVersion: "test", FormatVersion: ArchiveFormatVersion, ExportedAt: time.Now(), Files: []*ManifestFile{}, Moves: []*ManifestMove{}}
+	for _, e := range entries {
+		sum, size, err := checksum(strings.NewReader(e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Files = append(m.Files, &ManifestFile{Path: e.name, Size: size, SHA256: sum, MediaType: mediaType(e.name)})
+	}
+	if edit != nil {
+		edit(m)
+	}
+
+	b := &bytes.Buffer{}
+	w := zip.NewWriter(b)
+	if m.FormatVersion != 1 {
+		manifest, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, testEntry{manifestFileName, string(manifest)})
+	}
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fpath := filepath.Join(t.TempDir(), "session.zip")
+	if err := ioutil.WriteFile(fpath, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fpath
+}
+
+// newTestSession has a phrase with audio and an image from uploads.
+func newTestSession() *Session {
+	return &Session{ID: uuid.New(), Name: "Imported", Items: []*SessionItem{{ID: uuid.New(), Title: "A", Actions: []*instruction.Action{
+		{ID: uuid.New(), SayItem: &instruction.Say{ID: uuid.New(), Phrase: "hi", FilePath: "data/uploads/a.mp3"}},
+		{ID: uuid.New(), ImageItem: &instruction.ShowImage{ID: uuid.New(), Name: "a.png", FilePath: "data/uploads/a.png"}},
+	}}}}
+}
+
+func sessionEntry(t *testing.T, session *Session) testEntry {
+	t.Helper()
+	b, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testEntry{"session.json", string(b)}
+}
+
+func uploadNames(t *testing.T) []string {
+	t.Helper()
+	infos, err := ioutil.ReadDir(UploadsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func importError(t *testing.T, err error) *ImportReport {
+	t.Helper()
+	ie, ok := err.(*ImportError)
+	if !ok {
+		t.Fatalf("want ImportError, got %v", err)
+	}
+	return ie.Report
+}
+
+func hasProblem(report *ImportReport, entry, text string) bool {
+	for _, p := range report.Problems {
+		if p.Entry == entry && strings.Contains(p.Message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestImport_InvalidEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		text  string
+	}{
+		{"zip slip", "uploads/../../evil.mp3", "invalid file name"},
+		{"absolute path", "/tmp/evil.mp3", "unexpected entry"},
+		{"nested upload", "uploads/sub/a.mp3", "invalid file name"},
+		{"backslash", `uploads/..\evil.mp3`, "invalid file name"},
+		{"hidden file", "uploads/.a.mp3", "invalid file name"},
+		{"file type", "uploads/a.sh", "the file type isn't allowed"},
+		{"move outside of a group", "moves/../a.qianim", "invalid move"},
+		{"move of another type", "moves/Greetings/a.mp3", "invalid move"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testdir.WithUploads(t, UploadsDir)
+			sessions, fileStore, moves := newTestImport(t)
+			archive := writeTestArchive(t, []testEntry{sessionEntry(t, newTestSession()), {tt.entry, "evil"}}, nil)
+
+			_, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+			if report := importError(t, err); !hasProblem(report, tt.entry, tt.text) {
+				t.Fatalf("want a problem %q with %s, got %+v", tt.text, tt.entry, report.Problems)
+			}
+			if names := uploadNames(t); len(names) > 0 || len(sessions.Sessions) > 0 {
+				t.Fatalf("a failed import has saved the session or files %v", names)
+			}
+		})
+	}
+}
+
+func TestImport_DuplicateEntries(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+	archive := writeTestArchive(t, []testEntry{
+		sessionEntry(t, newTestSession()),
+		{"uploads/a.mp3", "first"},
+		{"uploads/a.png", "png"},
+		{"uploads/a.mp3", "second"},
+	}, nil)
+
+	_, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+	if report := importError(t, err); !hasProblem(report, "uploads/a.mp3", "twice") {
+		t.Fatalf("the duplicate isn't reported: %+v", report.Problems)
+	}
+}
+
+func TestImport_OversizeEntry(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+
+	// the entry claims to be larger than allowed, the import must not unpack it
+	b := &bytes.Buffer{}
+	w := zip.NewWriter(b)
+	for _, e := range []testEntry{sessionEntry(t, newTestSession()), {"uploads/a.png", "png"}} {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(e.body))
+	}
+	body := []byte("audio")
+	f, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "uploads/a.mp3",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(body),
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: maxImportEntrySize + 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(body)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "session.zip")
+	writeTestFile(t, archive, b.String())
+
+	_, err = sessions.Import(archive, ImportCreate, fileStore, moves)
+	if report := importError(t, err); !hasProblem(report, "uploads/a.mp3", "larger than") {
+		t.Fatalf("the oversize entry isn't reported: %+v", report.Problems)
+	}
+}
+
+func TestImport_RejectsFilesOutsideUploads(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+
+	session := newTestSession()
+	actions := session.Items[0].Actions
+	actions[0].SayItem.FilePath = "data/sessions.json"
+	actions[0].SayItem.Translations = map[string]*instruction.Translation{"en": {FilePath: "data/uploads/../../x.mp3"}}
+	actions[1].ImageItem.FilePath = "/etc/passwd"
+	archive := writeTestArchive(t, []testEntry{sessionEntry(t, session)}, nil)
+
+	_, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+	report := importError(t, err)
+	for _, fpath := range []string{"data/sessions.json", "data/uploads/../../x.mp3", "/etc/passwd"} {
+		if !hasProblem(report, "session.json", fpath) {
+			t.Errorf("%s isn't rejected: %+v", fpath, report.Problems)
+		}
+	}
+}
+
+func TestImport_MissingMoves(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+	writeTestFile(t, "data/secret.qianim", testAnimation)
+
+	session := newTestSession()
+	session.Items[0].Actions = append(session.Items[0].Actions,
+		&instruction.Action{ID: uuid.New(), MoveItem: &instruction.Move{ID: uuid.New(), Name: "Secret", FilePath: "data/secret.qianim"}},
+		&instruction.Action{ID: uuid.New(), MoveItem: &instruction.Move{ID: uuid.New(), Name: "Hey_1", FilePath: "/elsewhere/Hey_1.qianim"}},
+	)
+	archive := writeTestArchive(t, []testEntry{
+		sessionEntry(t, session),
+		{"uploads/a.mp3", "audio"},
+		{"uploads/a.png", "png"},
+	}, nil)
+
+	report, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.MissingMoves) != 1 || report.MissingMoves[0] != "Secret" || len(report.AddedMoves) != 0 {
+		t.Fatalf("want only Secret missing and nothing added, got %+v", report)
+	}
+	if _, err = moves.GetByName("Secret"); err == nil {
+		t.Fatal("a file outside of uploads is added to the move library")
+	}
+
+	imported, err := sessions.Get(session.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := imported.Items[0].Actions
+	if fpath := actions[2].MoveItem.FilePath; fpath != "" {
+		t.Fatalf("the missing move keeps the path %s", fpath)
+	}
+	if fpath := actions[3].MoveItem.FilePath; fpath != filepath.Join("anims", "Greetings", "Hey_1.qianim") {
+		t.Fatalf("the move isn't pointed to the library, its path is %s", fpath)
+	}
+}
+
+func TestImport_InvalidBundledMove(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+
+	session := newTestSession()
+	session.Items[0].Actions = append(session.Items[0].Actions,
+		&instruction.Action{ID: uuid.New(), MoveItem: &instruction.Move{ID: uuid.New(), Name: "Bad", FilePath: "anims/Bad.qianim"}})
+	archive := writeTestArchive(t, []testEntry{
+		sessionEntry(t, session),
+		{"uploads/a.mp3", "audio"},
+		{"uploads/a.png", "png"},
+		{"moves/1/Bad.qianim", "<Animation/>"},
+	}, func(m *Manifest) {
+		m.Moves = append(m.Moves, &ManifestMove{Name: "Bad", FilePath: "anims/Bad.qianim", Path: "moves/1/Bad.qianim"})
+	})
+
+	_, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+	if report := importError(t, err); !hasProblem(report, "moves/1/Bad.qianim", "invalid animation") {
+		t.Fatalf("the invalid move isn't reported: %+v", report.Problems)
+	}
+	if _, err = moves.GetByName("Bad"); err == nil {
+		t.Fatal("the invalid move is added to the move library")
+	}
+}
+
+func TestExportImport_BundledMoves(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	_, _, library := newTestImport(t)
+
+	// moves with the same file and folder names and a move without a folder
+	animations := map[string]string{
+		"Wave_A": filepath.Join("anims", "one", "Greetings", "Wave.qianim"),
+		"Wave_B": filepath.Join("anims", "two", "Greetings", "Wave.qianim"),
+		"Loose":  "Loose.qianim",
+	}
+	values := map[string]string{"Wave_A": "21", "Wave_B": "22", "Loose": "23"}
+	session := newTestSession()
+	writeTestFile(t, "data/uploads/a.mp3", "audio")
+	writeTestFile(t, "data/uploads/a.png", "png")
+	for name, fpath := range animations {
+		writeTestFile(t, fpath, strings.Replace(testAnimation, `value="20"`, `value="`+values[name]+`"`, 1))
+		move := &instruction.Move{ID: uuid.New(), Name: name, FilePath: fpath}
+		if err := library.Create(move); err != nil {
+			t.Fatal(err)
+		}
+		session.Items[0].Actions = append(session.Items[0].Actions, &instruction.Action{ID: uuid.New(), MoveItem: move})
+	}
+	exported, err := session.Export(t.TempDir(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another instance without these moves
+	sources := map[string][]byte{}
+	for name, fpath := range animations {
+		if sources[name], err = ioutil.ReadFile(fpath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+	report, err := sessions.Import(exported, ImportCreate, fileStore, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.AddedMoves) != len(animations) || len(report.MissingMoves) != 0 {
+		t.Fatalf("want all moves to be added, got %+v", report)
+	}
+	for name, source := range sources {
+		move, err := moves.GetByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsUploadPath(move.FilePath) {
+			t.Fatalf("the move %s is saved to %s, not to uploads", name, move.FilePath)
+		}
+		if b, err := ioutil.ReadFile(move.FilePath); err != nil || !bytes.Equal(b, source) {
+			t.Fatalf("the move %s has another file: %v", name, err)
+		}
+	}
+}
+
+func TestImport_AsNew(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+	original := newTestSession()
+	archive := writeTestArchive(t, []testEntry{
+		sessionEntry(t, original),
+		{"uploads/a.mp3", "audio"},
+		{"uploads/a.png", "png"},
+	}, nil)
+
+	ids := map[uuid.UUID]bool{original.ID: true}
+	for i := 0; i < 2; i++ {
+		report, err := sessions.Import(archive, ImportAsNew, fileStore, moves)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids[report.SessionID] {
+			t.Fatalf("import %d has reused the session ID %v", i+1, report.SessionID)
+		}
+		ids[report.SessionID] = true
+
+		imported, err := sessions.Get(report.SessionID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported.Items[0].ID == original.Items[0].ID {
+			t.Fatal("the item ID is reused")
+		}
+		audio := imported.Items[0].Actions[0].SayItem.FilePath
+		image := imported.Items[0].Actions[1].ImageItem.FilePath
+		for fpath, content := range map[string]string{audio: "audio", image: "png"} {
+			if fpath == "data/uploads/a.mp3" || fpath == "data/uploads/a.png" {
+				t.Fatalf("the file %s isn't renamed", fpath)
+			}
+			if b, err := ioutil.ReadFile(fpath); err != nil || string(b) != content {
+				t.Fatalf("the file %s has %q, want %q: %v", fpath, b, content, err)
+			}
+		}
+		if len(report.Files) != 2 {
+			t.Fatalf("want 2 saved files, got %v", report.Files)
+		}
+	}
+	if names := uploadNames(t); len(names) != 4 {
+		t.Fatalf("want 4 files of two copies in uploads, got %v", names)
+	}
+}
+
+func TestImport_RollsBackUploads(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+	writeTestFile(t, "data/uploads/a.mp3", "old")
+	archive := writeTestArchive(t, []testEntry{
+		sessionEntry(t, newTestSession()),
+		{"uploads/a.mp3", "new"},
+		{"uploads/a.png", "png"},
+	}, nil)
+
+	// the session can't be saved after uploads are committed, only overwriting replaces existing uploads
+	sessions.filepath = filepath.Join(t.TempDir(), "missing", "sessions.json")
+	_, err := sessions.Import(archive, ImportOverwrite, fileStore, moves)
+	importError(t, err)
+
+	if b, err := ioutil.ReadFile("data/uploads/a.mp3"); err != nil || string(b) != "old" {
+		t.Fatalf("the replaced upload isn't restored: %q, %v", b, err)
+	}
+	if names := uploadNames(t); len(names) != 1 {
+		t.Fatalf("want only the old upload, got %v", names)
+	}
+}
+
+func TestImport_KeepsExistingUploads(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	sessions, fileStore, moves := newTestImport(t)
+	writeTestFile(t, "data/uploads/a.mp3", "other audio")
+	writeTestFile(t, "data/uploads/a.png", "png")
+	session := newTestSession()
+	archive := writeTestArchive(t, []testEntry{
+		sessionEntry(t, session),
+		{"uploads/a.mp3", "audio"},
+		{"uploads/a.png", "png"},
+	}, nil)
+
+	report, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile("data/uploads/a.mp3"); err != nil || string(b) != "other audio" {
+		t.Fatalf("the existing upload is replaced: %q, %v", b, err)
+	}
+	imported, err := sessions.Get(report.SessionID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the different file is saved under a new name, the same one keeps its name
+	audio := imported.Items[0].Actions[0].SayItem.FilePath
+	if audio == "data/uploads/a.mp3" {
+		t.Fatal("the clashing upload isn't renamed")
+	}
+	if b, err := ioutil.ReadFile(audio); err != nil || string(b) != "audio" {
+		t.Fatalf("the file %s has %q, want audio: %v", audio, b, err)
+	}
+	if image := imported.Items[0].Actions[1].ImageItem.FilePath; image != "data/uploads/a.png" {
+		t.Fatalf("the same upload is renamed to %s", image)
+	}
+	if names := uploadNames(t); len(names) != 3 {
+		t.Fatalf("want the two existing files and the renamed one in uploads, got %v", names)
+	}
+
+	// overwriting replaces them
+	session.Name = "Overwritten"
+	archive = writeTestArchive(t, []testEntry{sessionEntry(t, session), {"uploads/a.mp3", "audio"}}, nil)
+	if _, err = sessions.Import(archive, ImportOverwrite, fileStore, moves); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile("data/uploads/a.mp3"); err != nil || string(b) != "audio" {
+		t.Fatalf("the upload isn't replaced: %q, %v", b, err)
+	}
+}
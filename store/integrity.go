@@ -0,0 +1,385 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+)
+
+// Kinds of integrity problems.
+const (
+	ProblemMissingFile = "missing_file"
+	ProblemUnknownMove = "unknown_move"
+	ProblemRemoteMove  = "remote_move_not_on_robot"
+	ProblemInvalidURL  = "invalid_url"
+	ProblemDuplicateID = "duplicate_id"
+)
+
+// IntegrityProblem is a broken reference of a session or a library item. Library items have the zero session ID.
+type IntegrityProblem struct {
+	Kind      string    `json:"kind"`
+	Location  string    `json:"location"` // human readable location, e.g., session "Intro", item 2, action 1, SayItem
+	SessionID uuid.UUID `json:"session_id"`
+	ItemID    uuid.UUID `json:"item_id"`
+	ActionID  uuid.UUID `json:"action_id"`
+	Value     string    `json:"value"` // the missing file, the move name, the URL or the duplicated ID
+	Fixable   bool      `json:"fixable"`
+	Fixed     bool      `json:"fixed"`
+}
+
+type IntegrityReport struct {
+	Time     time.Time           `json:"time"`
+	Problems []*IntegrityProblem `json:"problems"`
+	Fixed    int                 `json:"fixed"`
+}
+
+// Counts returns the number of problems of each kind.
+func (r *IntegrityReport) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, p := range r.Problems {
+		counts[p.Kind]++
+	}
+	return counts
+}
+
+// IntegrityCheck walks every session and library item looking for broken references.
+//
+// Problems of sessions and library actions are fixed only when it's safe:
+//   - a move with a missing file is pointed to the library move with the same name,
+//   - a missing audio file is detached from a Say which has a phrase, so the phrase can be synthesized again,
+//   - a missing image file is detached from the action,
+//   - a duplicated ID of an action or an instruction is replaced with a new one, IDs of library actions are kept.
+type IntegrityCheck struct {
+	Sessions *Sessions
+	Moves    *Moves
+	Actions  *Actions
+	Audio    *Audio
+
+	// RobotMoves are names of moves of the connected robot, remote moves aren't checked if it's nil.
+	RobotMoves []string
+}
+
+// integrityRun is the state of a single run of the check.
+type integrityRun struct {
+	check  *IntegrityCheck
+	report *IntegrityReport
+	seen   map[uuid.UUID]string // locations of the IDs met so far
+	fix    bool
+}
+
+// Run checks sessions and library items and fixes problems if fix is true. Fixed sessions are saved
+// as new revisions.
+func (ic *IntegrityCheck) Run(fix bool) (*IntegrityReport, error) {
+	r := &integrityRun{
+		check:  ic,
+		report: &IntegrityReport{Time: time.Now(), Problems: []*IntegrityProblem{}},
+		seen:   map[uuid.UUID]string{},
+	}
+
+	// library items go first, so duplicates are reported for sessions, where they can be fixed
+	for _, m := range ic.Moves.Moves {
+		loc := fmt.Sprintf("move %q", m.Name)
+		r.checkID(m.ID, loc, nil, false)
+		if m.FilePath != "" && !exists(m.FilePath) {
+			r.add(&IntegrityProblem{Kind: ProblemMissingFile, Location: loc, Value: m.FilePath})
+		}
+	}
+	for _, a := range ic.Audio.Items {
+		loc := fmt.Sprintf("audio %q", a.Phrase)
+		r.checkID(a.ID, loc, nil, false)
+		if a.FilePath != "" && !exists(a.FilePath) {
+			r.add(&IntegrityProblem{Kind: ProblemMissingFile, Location: loc, Value: a.FilePath})
+		}
+	}
+	for _, a := range ic.Actions.Items {
+		loc := fmt.Sprintf("library action %q", a.Name)
+		base := &IntegrityProblem{ActionID: a.ID}
+		seen := copySeen(r.seen)
+		problems := len(r.report.Problems)
+		fixable := r.checkAction(a, loc, base, true, false)
+		if !fix || !fixable {
+			continue
+		}
+
+		r.seen = seen
+		r.report.Problems = r.report.Problems[:problems]
+		r.fix = true
+		r.checkAction(a, loc, base, true, false)
+		r.fix = false
+		if err := ic.Actions.Update(a); err != nil {
+			return r.report, fmt.Errorf("failed to fix the library action %q: %v", a.Name, err)
+		}
+	}
+
+	for _, session := range ic.Sessions.Sessions {
+		seen := copySeen(r.seen)
+		problems := len(r.report.Problems)
+		fixable := r.checkSession(session, false)
+		if !fix || !fixable {
+			continue
+		}
+
+		// checking again on the copy of the session which is being saved
+		r.seen = seen
+		r.report.Problems = r.report.Problems[:problems]
+		r.fix = true
+		_, err := ic.Sessions.Edit(session.ID.String(), 0, "integrity check", "integrity problems fixed", func(s *Session) error {
+			r.checkSession(s, true)
+			return nil
+		})
+		r.fix = false
+		if err != nil {
+			return r.report, fmt.Errorf("failed to fix the session %q: %v", session.Name, err)
+		}
+	}
+
+	for _, p := range r.report.Problems {
+		if p.Fixed {
+			r.report.Fixed++
+		}
+	}
+	return r.report, nil
+}
+
+// checkSession returns true if the session has fixable problems.
+func (r *integrityRun) checkSession(session *Session, fix bool) bool {
+	fixable := false
+	sessionLoc := fmt.Sprintf("session %q", session.Name)
+	base := &IntegrityProblem{SessionID: session.ID}
+	r.checkID(session.ID, sessionLoc, base, false)
+
+	for i, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		itemLoc := fmt.Sprintf("%s, item %d", sessionLoc, i+1)
+		itemBase := &IntegrityProblem{SessionID: session.ID, ItemID: item.ID}
+		r.checkID(item.ID, itemLoc, itemBase, false)
+
+		for j, action := range item.Actions {
+			if action == nil {
+				continue
+			}
+			actionLoc := fmt.Sprintf("%s, action %d", itemLoc, j+1)
+			oldID := action.ID
+			actionBase := &IntegrityProblem{SessionID: session.ID, ItemID: item.ID, ActionID: action.ID}
+			if r.checkAction(action, actionLoc, actionBase, true, true) {
+				fixable = true
+			}
+			if fix && action.ID != oldID {
+				for _, b := range item.Branches {
+					if b != nil && b.ActionID == oldID {
+						b.ActionID = action.ID
+					}
+				}
+			}
+		}
+	}
+	return fixable
+}
+
+// checkAction checks the action and its variants, idFixable tells if the action's own ID can be replaced.
+// It returns true if there are fixable problems.
+func (r *integrityRun) checkAction(a *instruction.Action, loc string, base *IntegrityProblem, fixable, idFixable bool) bool {
+	if a == nil {
+		return false
+	}
+	found := false
+	note := func(p *IntegrityProblem) {
+		if p.Fixable {
+			found = true
+		}
+	}
+
+	if r.checkID(a.ID, loc, base, fixable && idFixable) {
+		found = true
+		if r.fix {
+			a.ID = uuid.Must(uuid.NewRandom())
+		}
+	}
+	for _, sub := range []struct {
+		id   *uuid.UUID
+		name string
+	}{
+		{idOf(a.SayItem), "SayItem"},
+		{idOf(a.MoveItem), "MoveItem"},
+		{idOf(a.ImageItem), "ImageItem"},
+		{idOf(a.URLItem), "URLItem"},
+		{idOf(a.StopItem), "StopItem"},
+		{idOf(a.VariantsItem), "VariantsItem"},
+	} {
+		if sub.id == nil {
+			continue
+		}
+		if r.checkID(*sub.id, loc+", "+sub.name, base, fixable) {
+			found = true
+			if r.fix {
+				*sub.id = uuid.Must(uuid.NewRandom())
+			}
+		}
+	}
+
+	if a.SayItem != nil && a.SayItem.FilePath != "" && !exists(a.SayItem.FilePath) {
+		p := r.problem(base, ProblemMissingFile, loc+", SayItem", a.SayItem.FilePath, fixable && a.SayItem.Phrase != "")
+		note(p)
+		if p.Fixable && r.fix {
+			a.SayItem.FilePath = ""
+			p.Fixed = true
+		}
+	}
+	if a.SayItem != nil {
+		for _, lang := range sortedKeys(a.SayItem.Translations) {
+			t := a.SayItem.Translations[lang]
+			if t == nil || t.FilePath == "" || exists(t.FilePath) {
+				continue
+			}
+			p := r.problem(base, ProblemMissingFile, fmt.Sprintf("%s, SayItem (%s)", loc, lang), t.FilePath, fixable && t.Phrase != "")
+			note(p)
+			if p.Fixable && r.fix {
+				t.FilePath = ""
+				p.Fixed = true
+			}
+		}
+	}
+	if a.ImageItem != nil && a.ImageItem.FilePath != "" && !exists(a.ImageItem.FilePath) {
+		p := r.problem(base, ProblemMissingFile, loc+", ImageItem", a.ImageItem.FilePath, fixable)
+		note(p)
+		if p.Fixable && r.fix {
+			a.ImageItem = &instruction.ShowImage{}
+			p.Fixed = true
+		}
+	}
+	if m := a.MoveItem; m != nil && (m.Name != "" || m.FilePath != "") {
+		libraryMove, err := r.check.Moves.GetByName(m.Name)
+		switch {
+		case m.FilePath != "" && !exists(m.FilePath):
+			canRelink := err == nil && libraryMove.FilePath != "" && exists(libraryMove.FilePath)
+			p := r.problem(base, ProblemMissingFile, loc+", MoveItem", m.FilePath, fixable && canRelink)
+			note(p)
+			if p.Fixable && r.fix {
+				m.FilePath = libraryMove.FilePath
+				p.Fixed = true
+			}
+		case m.FilePath == "" && r.check.RobotMoves != nil && !containsString(r.check.RobotMoves, m.Name):
+			r.problem(base, ProblemRemoteMove, loc+", MoveItem", m.Name, false)
+		case m.Name != "" && err != nil && m.FilePath == "":
+			r.problem(base, ProblemUnknownMove, loc+", MoveItem", m.Name, false)
+		}
+	}
+	if a.URLItem != nil && a.URLItem.URL != "" && !isValidURL(a.URLItem.URL) {
+		r.problem(base, ProblemInvalidURL, loc+", URLItem", a.URLItem.URL, false)
+	}
+
+	if a.VariantsItem != nil {
+		for i, e := range a.VariantsItem.Entries {
+			if e != nil && r.checkAction(e.Action, fmt.Sprintf("%s, variant %d", loc, i+1), base, fixable, fixable) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// checkID registers the ID and reports it if it has been met already. It returns true if the duplicate
+// can be fixed.
+func (r *integrityRun) checkID(id uuid.UUID, loc string, base *IntegrityProblem, fixable bool) bool {
+	if (id == uuid.UUID{}) {
+		return false
+	}
+	first, ok := r.seen[id]
+	if !ok {
+		r.seen[id] = loc
+		return false
+	}
+	p := r.problem(base, ProblemDuplicateID, fmt.Sprintf("%s (first met at %s)", loc, first), id.String(), fixable)
+	p.Fixed = fixable && r.fix
+	return fixable
+}
+
+func (r *integrityRun) problem(base *IntegrityProblem, kind, loc, value string, fixable bool) *IntegrityProblem {
+	p := &IntegrityProblem{Kind: kind, Location: loc, Value: value, Fixable: fixable}
+	if base != nil {
+		p.SessionID = base.SessionID
+		p.ItemID = base.ItemID
+		p.ActionID = base.ActionID
+	}
+	r.add(p)
+	return p
+}
+
+func (r *integrityRun) add(p *IntegrityProblem) {
+	r.report.Problems = append(r.report.Problems, p)
+}
+
+// idOf returns the pointer to the ID of the instruction or nil if the instruction is nil.
+func idOf(instr interface{}) *uuid.UUID {
+	switch v := instr.(type) {
+	case *instruction.Say:
+		if v != nil {
+			return &v.ID
+		}
+	case *instruction.Move:
+		if v != nil {
+			return &v.ID
+		}
+	case *instruction.ShowImage:
+		if v != nil {
+			return &v.ID
+		}
+	case *instruction.ShowURI:
+		if v != nil {
+			return &v.ID
+		}
+	case *instruction.Stop:
+		if v != nil {
+			return &v.ID
+		}
+	case *instruction.Variants:
+		if v != nil {
+			return &v.ID
+		}
+	}
+	return nil
+}
+
+func isValidURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func exists(fpath string) bool {
+	_, err := os.Stat(fpath)
+	return err == nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(translations map[string]*instruction.Translation) []string {
+	keys := []string{}
+	for k := range translations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func copySeen(seen map[uuid.UUID]string) map[uuid.UUID]string {
+	c := make(map[uuid.UUID]string, len(seen))
+	for k, v := range seen {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Version of garlic which is written to exported archives, it's set at build time:
+//
+//	go build -ldflags "-X github.com/iharsuvorau/garlic/store.Version=v1.2.0"
+var Version = "dev"
+
+// ArchiveFormatVersion is the version of the archive layout and of session.json in it. Archives of version 1
+// were made before the manifest was introduced, they have no manifest.json. Since version 3 archives can have
+// move files from outside of uploads in moves/.
+const ArchiveFormatVersion = 3
+
+const manifestFileName = "manifest.json"
+
+// Manifest describes the contents of an exported archive, so the import can check that the archive is complete
+// and not corrupted, and can migrate archives made by older versions.
+type Manifest struct {
+	GarlicVersion string          `json:"garlic_version"`
+	FormatVersion int             `json:"format_version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	Files         []*ManifestFile `json:"files"`
+	Moves         []*ManifestMove `json:"moves"`
+}
+
+// ManifestFile is an entry of the archive except the manifest itself.
+type ManifestFile struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	MediaType string `json:"media_type"`
+}
+
+// ManifestMove is a move referenced by the session which doesn't belong to uploads, e.g., a built-in move
+// from the moves folder of the exporting instance. Path is the move file in the archive if the move is bundled.
+type ManifestMove struct {
+	Name     string `json:"name"`
+	Group    string `json:"group"`
+	FilePath string `json:"file_path"` // as referenced by the session
+	Path     string `json:"path,omitempty"`
+}
+
+// archiveMigrations upgrade session.json of the archive format version, which is the key, to the next version.
+var archiveMigrations = map[int]func(session map[string]interface{}) error{
+	1: func(session map[string]interface{}) error {
+		return nil // version 2 has only added the manifest, sessions are the same
+	},
+	2: func(session map[string]interface{}) error {
+		return nil // version 3 has only added moves to the archive, sessions are the same
+	},
+}
+
+// writeManifest describes files and moves of the archive in the manifest at fpath. Paths in the archive
+// are relative to dir.
+func writeManifest(fpath, dir string, files []string, moves []*ManifestMove) error {
+	m := &Manifest{
+		GarlicVersion: Version,
+		FormatVersion: ArchiveFormatVersion,
+		ExportedAt:    time.Now(),
+		Files:         []*ManifestFile{},
+		Moves:         moves,
+	}
+	for _, fp := range files {
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+		sum, size, err := checksum(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(fp, dir+"/")
+		m.Files = append(m.Files, &ManifestFile{Path: name, Size: size, SHA256: sum, MediaType: mediaType(name)})
+	}
+
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// readManifest decodes the manifest of the archive, a missing manifest means the archive of version 1.
+func readManifest(f *zip.File, report *ImportReport) *Manifest {
+	if f == nil {
+		return &Manifest{FormatVersion: 1}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		report.problem(f.Name, "failed to open: %v", err)
+		return nil
+	}
+	defer rc.Close()
+
+	m := &Manifest{}
+	if err = json.NewDecoder(io.LimitReader(rc, maxImportSessionSize)).Decode(m); err != nil {
+		report.problem(f.Name, "the manifest can't be decoded: %v", err)
+		return nil
+	}
+	if m.FormatVersion < 1 {
+		report.problem(f.Name, "invalid format version %d", m.FormatVersion)
+		return nil
+	}
+	if m.FormatVersion > ArchiveFormatVersion {
+		report.problem(f.Name, "the archive has been made by garlic %s in the format version %d, this version of garlic supports versions up to %d",
+			m.GarlicVersion, m.FormatVersion, ArchiveFormatVersion)
+		return nil
+	}
+	return m
+}
+
+// verifyManifest checks that the archive has exactly the files listed in the manifest and that their sizes
+// and checksums match.
+func verifyManifest(m *Manifest, entries map[string]*zip.File, report *ImportReport) {
+	if m.FormatVersion < 2 {
+		return // no manifest to verify
+	}
+
+	listed := map[string]bool{}
+	for _, mf := range m.Files {
+		if mf == nil {
+			continue
+		}
+		listed[mf.Path] = true
+		f, ok := entries[mf.Path]
+		if !ok {
+			report.problem(mf.Path, "the file is listed in the manifest, but it's missing in the archive")
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			report.problem(f.Name, "failed to open: %v", err)
+			continue
+		}
+		sum, size, err := checksum(io.LimitReader(rc, maxImportEntrySize+1))
+		rc.Close()
+		if err != nil {
+			report.problem(f.Name, "failed to read: %v", err)
+			continue
+		}
+		if size != mf.Size || sum != strings.ToLower(mf.SHA256) {
+			report.problem(f.Name, "the file doesn't match its checksum in the manifest, the archive is corrupted")
+		}
+	}
+	for name := range entries {
+		if !listed[name] {
+			report.problem(name, "the file isn't listed in the manifest")
+		}
+	}
+}
+
+// migrateSession upgrades session.json of the format version to the current one.
+func migrateSession(b []byte, version int) ([]byte, error) {
+	if version == ArchiveFormatVersion {
+		return b, nil
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	for v := version; v < ArchiveFormatVersion; v++ {
+		migrate, ok := archiveMigrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from the format version %d", v)
+		}
+		if err := migrate(doc); err != nil {
+			return nil, fmt.Errorf("migration from the format version %d has failed: %v", v, err)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func checksum(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func mediaType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == ".qianim" {
+		return "application/xml"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iharsuvorau/garlic/internal/testdir"
+)
+
+func TestImport_Manifest(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(m *Manifest)
+		entry string
+		text  string
+	}{
+		{"checksum mismatch", func(m *Manifest) { m.Files[1].SHA256 = strings.Repeat("0", 64) }, "uploads/a.mp3", "doesn't match its checksum"},
+		{"size mismatch", func(m *Manifest) { m.Files[2].Size++ }, "uploads/a.png", "doesn't match its checksum"},
+		{"missing file", func(m *Manifest) { m.Files = append(m.Files, &ManifestFile{Path: "uploads/b.mp3"}) }, "uploads/b.mp3", "missing in the archive"},
+		{"unlisted file", func(m *Manifest) { m.Files = m.Files[:2] }, "uploads/a.png", "isn't listed in the manifest"},
+		{"newer version", func(m *Manifest) { m.FormatVersion = ArchiveFormatVersion + 1 }, manifestFileName, "supports versions up to"},
+		{"invalid version", func(m *Manifest) { m.FormatVersion = 0 }, manifestFileName, "invalid format version"},
+		{"missing bundled move", func(m *Manifest) {
+			m.Moves = append(m.Moves, &ManifestMove{Name: "Wave", FilePath: "anims/Wave.qianim", Path: "moves/1/Wave.qianim"})
+		}, "moves/1/Wave.qianim", "missing in the archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testdir.WithUploads(t, UploadsDir)
+			sessions, fileStore, moves := newTestImport(t)
+			archive := writeTestArchive(t, []testEntry{
+				sessionEntry(t, newTestSession()),
+				{"uploads/a.mp3", "audio"},
+				{"uploads/a.png", "png"},
+			}, tt.edit)
+
+			_, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+			if report := importError(t, err); !hasProblem(report, tt.entry, tt.text) {
+				t.Fatalf("want a problem %q with %s, got %+v", tt.text, tt.entry, report.Problems)
+			}
+			if names := uploadNames(t); len(names) > 0 || len(sessions.Sessions) > 0 {
+				t.Fatalf("a failed import has saved the session or files %v", names)
+			}
+		})
+	}
+}
+
+func TestImport_OlderFormatVersions(t *testing.T) {
+	for version := 1; version < ArchiveFormatVersion; version++ {
+		testdir.WithUploads(t, UploadsDir)
+		sessions, fileStore, moves := newTestImport(t)
+		session := newTestSession()
+		archive := writeTestArchive(t, []testEntry{
+			sessionEntry(t, session),
+			{"uploads/a.mp3", "audio"},
+			{"uploads/a.png", "png"},
+		}, func(m *Manifest) { m.FormatVersion = version })
+
+		report, err := sessions.Import(archive, ImportCreate, fileStore, moves)
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if report.FormatVersion != version || report.SessionID != session.ID {
+			t.Fatalf("version %d: unexpected report %+v", version, report)
+		}
+	}
+}
+
+func TestMigrateSession(t *testing.T) {
+	b, err := migrateSession([]byte(`{"ID": "0c5e8a3e-5b43-4c8c-9a3a-2f7c1b0f6d11", "Name": "Old"}`), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"Name":"Old"`) {
+		t.Fatalf("the session is changed by the migration: %s", b)
+	}
+
+	if _, err = migrateSession([]byte(`{}`), 0); err == nil || !strings.Contains(err.Error(), "no migration") {
+		t.Fatalf("want an error about a missing migration, got %v", err)
+	}
+	if _, err = migrateSession([]byte(`[`), 1); err == nil {
+		t.Fatal("invalid JSON is migrated")
+	}
+}
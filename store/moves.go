@@ -1,9 +1,11 @@
 package store
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,6 +15,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/qianim"
 )
 
 func collectMoves(dataDir string) ([]*instruction.Move, error) {
@@ -103,6 +106,36 @@ func (s *Moves) GetByName(name string) (*instruction.Move, error) {
 	return nil, fmt.Errorf("not found")
 }
 
+// hasFile tells whether the file belongs to a move of the store.
+func (s *Moves) hasFile(fpath string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.Moves {
+		if m.FilePath == fpath {
+			return true
+		}
+	}
+	return false
+}
+
+// Match finds a move by a name typed by a person: the exact name is preferred, otherwise names are compared
+// ignoring case and treating spaces as underscores, e.g., "happy 4" matches Happy_4.
+func (s *Moves) Match(name string) (*instruction.Move, error) {
+	name = strings.TrimSpace(name)
+	if move, err := s.GetByName(name); err == nil {
+		return move, nil
+	}
+	normalize := func(n string) string {
+		return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(n, "_", " ")), "_"))
+	}
+	for _, move := range s.Moves {
+		if normalize(move.Name) == normalize(name) {
+			return move, nil
+		}
+	}
+	return nil, fmt.Errorf("move %q not found", name)
+}
+
 func (s *Moves) Get(id string) (*instruction.Move, error) {
 	uid, err := uuid.Parse(id)
 	if err != nil {
@@ -151,6 +184,58 @@ func (s *Moves) Create(m *instruction.Move) error {
 	return s.dump()
 }
 
+// CreateMany adds all moves or none of them if a name is already taken.
+func (s *Moves) CreateMany(moves []*instruction.Move) error {
+	if len(moves) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	names := map[string]bool{}
+	for _, m := range s.Moves {
+		names[m.Name] = true
+	}
+	for _, m := range moves {
+		if (m.ID == uuid.UUID{}) {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to create a move: ID must be provided")
+		}
+		if names[m.Name] {
+			s.mu.Unlock()
+			return fmt.Errorf("the move with such name already exists: %v", m.Name)
+		}
+		names[m.Name] = true
+	}
+	s.Moves = append(s.Moves, moves...)
+	s.mu.Unlock()
+
+	if err := s.dump(); err != nil {
+		_ = s.remove(moves)
+		return err
+	}
+	return nil
+}
+
+// remove takes moves out of the store keeping their files.
+func (s *Moves) remove(moves []*instruction.Move) error {
+	ids := map[uuid.UUID]bool{}
+	for _, m := range moves {
+		ids[m.ID] = true
+	}
+
+	s.mu.Lock()
+	kept := []*instruction.Move{}
+	for _, m := range s.Moves {
+		if !ids[m.ID] {
+			kept = append(kept, m)
+		}
+	}
+	s.Moves = kept
+	s.mu.Unlock()
+
+	return s.dump()
+}
+
 func (s *Moves) Update(updatedMove *instruction.Move) error {
 	s.mu.Lock()
 	for _, s := range s.Moves {
@@ -187,12 +272,132 @@ func (s *Moves) Delete(id string) error {
 	if err = os.Remove(move.FilePath); err != nil {
 		return fmt.Errorf("failed to remove a file: %v", err)
 	}
+	if err = removeFile(previewPath(move.FilePath)); err != nil {
+		log.Println(err)
+	}
 	s.Moves = newMoves
 	s.mu.Unlock()
 
 	return s.dump()
 }
 
+// Preview returns keyframes of the move normalised for the web UI. The converted result is cached
+// next to the move file and is rebuilt when the move file is newer than the cache.
+func (s *Moves) Preview(id string) (*qianim.Preview, error) {
+	move, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if move.FilePath == "" {
+		return nil, fmt.Errorf("the move %s has no file, it's located on the robot", move.Name)
+	}
+
+	moveInfo, err := os.Stat(move.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cachePath := previewPath(move.FilePath)
+	if cacheInfo, err := os.Stat(cachePath); err == nil && !cacheInfo.ModTime().Before(moveInfo.ModTime()) {
+		preview, readErr := readPreview(cachePath)
+		if readErr == nil {
+			return preview, nil
+		}
+		log.Printf("failed to read the cached preview %s: %v", cachePath, readErr)
+	}
+
+	anim, err := qianim.ParseFile(move.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	preview := qianim.NewPreview(anim)
+
+	if err = writePreview(cachePath, preview); err != nil {
+		// the moves folder can be read-only, the preview is still useful without caching
+		log.Printf("failed to cache the preview at %s: %v", cachePath, err)
+	}
+
+	return preview, nil
+}
+
+// Mirror creates a new move from the left-right mirrored animation of the move with the provided ID.
+// The animation is saved as a new upload and the move is put in the same group as the original one.
+func (s *Moves) Mirror(id string, fileStore *Files) (*instruction.Move, error) {
+	move, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if move.FilePath == "" {
+		return nil, fmt.Errorf("the move %s has no file, it's located on the robot", move.Name)
+	}
+
+	anim, err := qianim.ParseFile(move.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createFromAnimation(qianim.Mirror(anim), move.Name+" (mirrored)", move.Group, fileStore)
+}
+
+// Scale creates a new move from the animation of the move with the provided ID played with the speed factor.
+func (s *Moves) Scale(id string, factor float64, fileStore *Files) (*instruction.Move, error) {
+	if !instruction.IsValidSpeed(factor) {
+		return nil, fmt.Errorf("speed factor must be in the range [%v, %v], got %v", instruction.MinSpeed, instruction.MaxSpeed, factor)
+	}
+
+	move, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if move.FilePath == "" {
+		return nil, fmt.Errorf("the move %s has no file, it's located on the robot", move.Name)
+	}
+
+	anim, err := qianim.ParseFile(move.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s (x%v)", move.Name, factor)
+	return s.createFromAnimation(qianim.Scale(anim, factor), name, move.Group, fileStore)
+}
+
+// createFromAnimation saves the animation in the file store and creates a new move for it.
+func (s *Moves) createFromAnimation(anim *qianim.Animation, name, group string, fileStore *Files) (*instruction.Move, error) {
+	if _, err := s.GetByName(name); err == nil {
+		return nil, fmt.Errorf("the move with such name already exists: %v", name)
+	}
+
+	if err := qianim.Validate(anim); err != nil {
+		return nil, err
+	}
+
+	b, err := anim.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	uid := uuid.Must(uuid.NewRandom())
+	dst, err := fileStore.Save(uid.String()+".qianim", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("can't save the move file: %v", err)
+	}
+
+	newMove := &instruction.Move{
+		ID:       uid,
+		Name:     name,
+		FilePath: dst,
+		Group:    group,
+	}
+	if err = s.Create(newMove); err != nil {
+		if e := removeFile(dst); e != nil {
+			log.Println(e)
+		}
+		return nil, err
+	}
+	return newMove, nil
+}
+
 func (s *Moves) GetGroups() []string {
 	var groupsMap = map[string]interface{}{}
 
@@ -226,3 +431,29 @@ func (s *Moves) dump() error {
 	defer f.Close()
 	return json.NewEncoder(f).Encode(s.Moves)
 }
+
+// previewPath returns the path of the cached preview for the move file, e.g., Happy_4.qianim -> Happy_4.preview.json.
+func previewPath(movePath string) string {
+	return strings.TrimSuffix(movePath, filepath.Ext(movePath)) + ".preview.json"
+}
+
+func readPreview(fpath string) (*qianim.Preview, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	preview := &qianim.Preview{}
+	return preview, json.NewDecoder(f).Decode(preview)
+}
+
+func writePreview(fpath string, preview *qianim.Preview) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(preview)
+}
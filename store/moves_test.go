@@ -0,0 +1,58 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iharsuvorau/garlic/internal/testdir"
+)
+
+func TestMoves_Preview(t *testing.T) {
+	testdir.WithUploads(t, UploadsDir)
+	_, _, moves := newTestImport(t)
+	move, err := moves.GetByName("Hey_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := moves.Preview(move.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Duration != 1.2 {
+		t.Fatalf("the duration is %v, want 1.2", preview.Duration)
+	}
+	cachePath := filepath.Join("anims", "Greetings", "Hey_1.preview.json")
+	if _, err = os.Stat(cachePath); err != nil {
+		t.Fatalf("the preview isn't cached: %v", err)
+	}
+
+	// the move file is changed, but its modification time is older than the cache, so the cache is used
+	writeTestFile(t, move.FilePath, strings.Replace(testAnimation, `frame="30"`, `frame="50"`, 1))
+	cacheInfo, err := os.Stat(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := cacheInfo.ModTime().Add(-time.Minute)
+	if err = os.Chtimes(move.FilePath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if preview, err = moves.Preview(move.ID.String()); err != nil || preview.Duration != 1.2 {
+		t.Fatalf("want the cached preview, got %+v, %v", preview, err)
+	}
+
+	// a newer move file rebuilds the cache
+	future := cacheInfo.ModTime().Add(time.Minute)
+	if err = os.Chtimes(move.FilePath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if preview, err = moves.Preview(move.ID.String()); err != nil || preview.Duration != 2 {
+		t.Fatalf("want the rebuilt preview, got %+v, %v", preview, err)
+	}
+	if cached, err := readPreview(cachePath); err != nil || cached.Duration != 2 {
+		t.Fatalf("the cache isn't rebuilt: %+v, %v", cached, err)
+	}
+}
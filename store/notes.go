@@ -0,0 +1,202 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultNoteTags are used for quick markers when tags haven't been configured yet.
+var DefaultNoteTags = []string{"child smiled", "lost attention", "distressed", "engaged", "break"}
+
+// Note is an operator's note or a quick marker taken during a run of a session. A marker has a tag
+// and, optionally, a text, a note has only a text.
+type Note struct {
+	ID       uuid.UUID
+	RunID    uuid.UUID
+	Time     time.Time
+	Tag      string
+	Text     string
+	Operator string
+}
+
+type Notes struct {
+	Notes []*Note
+	Tags  []string
+
+	filepath     string
+	tagsFilepath string
+	mu           sync.RWMutex
+}
+
+func NewNotesStore(fpath, tagsPath string) (*Notes, error) {
+	var file *os.File
+	_, err := os.Stat(fpath)
+	if os.IsNotExist(err) {
+		file, err = os.Create(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("can't create a notes store at %s: %v", fpath, err)
+		}
+	} else {
+		file, err = os.Open(fpath)
+	}
+	defer file.Close()
+
+	store := &Notes{
+		filepath:     fpath,
+		tagsFilepath: tagsPath,
+		Notes:        []*Note{},
+		Tags:         []string{},
+	}
+	if err = json.NewDecoder(file).Decode(&store.Notes); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode notes from %s: %v", fpath, err)
+	}
+
+	var tagsFile *os.File
+	_, err = os.Stat(tagsPath)
+	isFreshTags := os.IsNotExist(err)
+	if isFreshTags {
+		tagsFile, err = os.Create(tagsPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't create a note tags store at %s: %v", tagsPath, err)
+		}
+	} else {
+		tagsFile, err = os.Open(tagsPath)
+	}
+	defer tagsFile.Close()
+
+	if err = json.NewDecoder(tagsFile).Decode(&store.Tags); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode note tags from %s: %v", tagsPath, err)
+	}
+	if isFreshTags {
+		store.Tags = append(store.Tags, DefaultNoteTags...)
+	}
+
+	if err = store.dumpTags(); err != nil {
+		return nil, err
+	}
+	return store, store.dump()
+}
+
+// Create adds a note to the run, the time is set to now if it's missing.
+func (s *Notes) Create(n *Note) error {
+	n.Tag = strings.TrimSpace(n.Tag)
+	n.Text = strings.TrimSpace(n.Text)
+	if n.Tag == "" && n.Text == "" {
+		return fmt.Errorf("note must have a tag or a text")
+	}
+	if n.Tag != "" && !s.hasTag(n.Tag) {
+		return fmt.Errorf("unknown tag %q, available tags: %s", n.Tag, strings.Join(s.Tags, ", "))
+	}
+	if (n.ID == uuid.UUID{}) {
+		n.ID = uuid.Must(uuid.NewRandom())
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	s.Notes = append(s.Notes, n)
+	s.mu.Unlock()
+	return s.dump()
+}
+
+func (s *Notes) Delete(id string) error {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	newNotes := []*Note{}
+	found := false
+	for _, n := range s.Notes {
+		if n.ID == uid {
+			found = true
+			continue
+		}
+		newNotes = append(newNotes, n)
+	}
+	s.Notes = newNotes
+	s.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("not found: %v", id)
+	}
+	return s.dump()
+}
+
+// ByRun returns notes of the run.
+func (s *Notes) ByRun(runID uuid.UUID) []*Note {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []*Note{}
+	for _, n := range s.Notes {
+		if n.RunID == runID {
+			notes = append(notes, n)
+		}
+	}
+	return notes
+}
+
+// SetTags replaces the set of tags for quick markers, existing notes keep their tags.
+func (s *Notes) SetTags(tags []string) error {
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		cleaned = append(cleaned, t)
+	}
+
+	s.mu.Lock()
+	s.Tags = cleaned
+	s.mu.Unlock()
+	return s.dumpTags()
+}
+
+func (s *Notes) hasTag(tag string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Notes) dump() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Create(s.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(s.Notes)
+}
+
+func (s *Notes) dumpTags() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Create(s.tagsFilepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(s.Tags)
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNotes(t *testing.T) {
+	dir := t.TempDir()
+	fpath, tagsPath := filepath.Join(dir, "notes.json"), filepath.Join(dir, "note_tags.json")
+	notes, err := NewNotesStore(fpath, tagsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(notes.Tags) != fmt.Sprint(DefaultNoteTags) {
+		t.Fatalf("a fresh store has tags %v, want the default ones", notes.Tags)
+	}
+
+	run, otherRun := uuid.New(), uuid.New()
+	invalid := []*Note{
+		{RunID: run, Text: "  "},
+		{RunID: run, Tag: "unknown"},
+	}
+	for _, n := range invalid {
+		if err = notes.Create(n); err == nil {
+			t.Fatalf("the note %+v is created", n)
+		}
+	}
+	text := &Note{RunID: run, Text: " looks at the robot "}
+	marker := &Note{RunID: run, Tag: "engaged"}
+	for _, n := range []*Note{text, marker, {RunID: otherRun, Tag: "break"}} {
+		if err = notes.Create(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if (text.ID == uuid.UUID{}) || text.Time.IsZero() || text.Text != "looks at the robot" {
+		t.Fatalf("the note isn't completed: %+v", text)
+	}
+	if err = notes.Delete(marker.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err = notes.Delete(marker.ID.String()); err == nil {
+		t.Fatal("a deleted note is deleted again")
+	}
+
+	// the tags file exists, so an empty set of tags isn't replaced with the default ones
+	if err = notes.SetTags(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewNotesStore(fpath, tagsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Tags) != 0 {
+		t.Fatalf("loaded tags %v, want none", loaded.Tags)
+	}
+	if byRun := loaded.ByRun(run); len(byRun) != 1 || byRun[0].ID != text.ID || !byRun[0].Time.Equal(text.Time) {
+		t.Fatalf("unexpected notes of the run %+v", byRun)
+	}
+	if byRun := loaded.ByRun(otherRun); len(byRun) != 1 || byRun[0].Tag != "break" {
+		t.Fatalf("unexpected notes of the other run %+v", byRun)
+	}
+}
+
+func TestNotes_SetTags(t *testing.T) {
+	dir := t.TempDir()
+	notes, err := NewNotesStore(filepath.Join(dir, "notes.json"), filepath.Join(dir, "note_tags.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = notes.SetTags([]string{" smiled", "", "smiled", "cried"}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(notes.Tags) != "[smiled cried]" {
+		t.Fatalf("got tags %v, want [smiled cried]", notes.Tags)
+	}
+	if err = notes.Create(&Note{Tag: "cried"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = notes.Create(&Note{Tag: "engaged"}); err == nil {
+		t.Fatal("a removed tag is accepted")
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Participant is a pseudonymous profile of a child the sessions are done with. Only the code is required,
+// nothing identifying should be stored here.
+type Participant struct {
+	ID            uuid.UUID
+	Code          string   // pseudonymous code, e.g., P-012
+	AgeGroup      string   // e.g., 6-8
+	PreferredName string   // how the robot should call the child, optional
+	Language      string   // preferred language code, e.g., en, et
+	Sensitivities []string // sensory sensitivities, e.g., loud sounds, bright light
+}
+
+func (p *Participant) IsValid() bool {
+	return strings.TrimSpace(p.Code) != ""
+}
+
+type Participants struct {
+	Items []*Participant
+
+	filepath string
+	mu       sync.RWMutex
+}
+
+func NewParticipantsStore(fpath string) (*Participants, error) {
+	var file *os.File
+	_, err := os.Stat(fpath)
+	if os.IsNotExist(err) {
+		file, err = os.Create(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("can't create a participants store at %s: %v", fpath, err)
+		}
+	} else {
+		file, err = os.Open(fpath)
+	}
+	defer file.Close()
+
+	store := &Participants{
+		filepath: fpath,
+		Items:    []*Participant{},
+	}
+	if err = json.NewDecoder(file).Decode(&store.Items); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode participants from %s: %v", fpath, err)
+	}
+
+	return store, store.dump()
+}
+
+func (s *Participants) Get(id string) (*Participant, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByUUID(uid)
+}
+
+func (s *Participants) GetByUUID(id uuid.UUID) (*Participant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.Items {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("not found: %v", id)
+}
+
+// Create adds a participant, the code must be unique.
+func (s *Participants) Create(p *Participant) error {
+	p.Code = strings.TrimSpace(p.Code)
+	if !p.IsValid() {
+		return fmt.Errorf("failed to create a participant: code must be provided")
+	}
+	if (p.ID == uuid.UUID{}) {
+		p.ID = uuid.Must(uuid.NewRandom())
+	}
+	if err := s.checkCode(p); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.Items = append(s.Items, p)
+	s.mu.Unlock()
+	return s.dump()
+}
+
+func (s *Participants) Update(updated *Participant) error {
+	updated.Code = strings.TrimSpace(updated.Code)
+	if !updated.IsValid() {
+		return fmt.Errorf("failed to update the participant: code must be provided")
+	}
+	if err := s.checkCode(updated); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	found := false
+	for _, p := range s.Items {
+		if p.ID == updated.ID {
+			*p = *updated
+			found = true
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("not found: %v", updated.ID)
+	}
+	return s.dump()
+}
+
+// Delete removes the participant's profile, runs keep the participant's ID.
+func (s *Participants) Delete(id string) error {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	if _, err = s.GetByUUID(uid); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	newItems := []*Participant{}
+	for _, p := range s.Items {
+		if p.ID == uid {
+			continue
+		}
+		newItems = append(newItems, p)
+	}
+	s.Items = newItems
+	s.mu.Unlock()
+
+	return s.dump()
+}
+
+// checkCode returns an error if another participant has the same code.
+func (s *Participants) checkCode(p *Participant) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, other := range s.Items {
+		if other.ID != p.ID && strings.EqualFold(other.Code, p.Code) {
+			return fmt.Errorf("participant with the code %q already exists", p.Code)
+		}
+	}
+	return nil
+}
+
+func (s *Participants) dump() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Create(s.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(s.Items)
+}
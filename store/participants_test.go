@@ -0,0 +1,72 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParticipants(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "participants.json")
+	participants, err := NewParticipantsStore(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &Participant{Code: " P-001 ", AgeGroup: "6-8", Language: "et", Sensitivities: []string{"loud sounds"}}
+	second := &Participant{Code: "P-002"}
+	for _, p := range []*Participant{first, second} {
+		if err = participants.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if (first.ID == uuid.UUID{}) || first.Code != "P-001" {
+		t.Fatalf("the participant isn't completed: %+v", first)
+	}
+	for _, p := range []*Participant{{Code: " "}, {Code: "p-001"}} {
+		if err = participants.Create(p); err == nil {
+			t.Fatalf("the participant %+v is created", p)
+		}
+	}
+
+	// the code stays unique on updates
+	if err = participants.Update(&Participant{ID: second.ID, Code: "P-001"}); err == nil {
+		t.Fatal("the code of another participant is taken")
+	}
+	if err = participants.Update(&Participant{ID: second.ID, Code: "P-002", PreferredName: "Mari"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = participants.Update(&Participant{ID: uuid.New(), Code: "P-003"}); err == nil {
+		t.Fatal("an unknown participant is updated")
+	}
+
+	loaded, err := NewParticipantsStore(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Items) != 2 {
+		t.Fatalf("loaded %d participants, want 2", len(loaded.Items))
+	}
+	p, err := loaded.Get(first.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.AgeGroup != "6-8" || p.Language != "et" || len(p.Sensitivities) != 1 {
+		t.Fatalf("unexpected loaded participant %+v", p)
+	}
+	if p, err = loaded.GetByUUID(second.ID); err != nil || p.PreferredName != "Mari" {
+		t.Fatalf("the update isn't saved: %+v, %v", p, err)
+	}
+
+	if err = loaded.Delete(first.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err = loaded.Delete(first.ID.String()); err == nil {
+		t.Fatal("a deleted participant is deleted again")
+	}
+	// the code of the deleted participant is free
+	if err = loaded.Create(&Participant{Code: "P-001"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Revision is a snapshot of a session made on every save.
+type Revision struct {
+	Number    int
+	SessionID uuid.UUID
+	Author    string
+	Time      time.Time
+	Comment   string // e.g., restored from revision 3
+	Session   *Session
+}
+
+// Revisions keeps the history of sessions, revisions of a session are stored in a separate file
+// <dir>/<session ID>.json.
+type Revisions struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewRevisionsStore(dir string) (*Revisions, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("can't create a revisions store at %s: %v", dir, err)
+	}
+	return &Revisions{dir: dir}, nil
+}
+
+// Record saves a copy of the session as the next revision.
+func (s *Revisions) Record(session *Session, author, comment string) (*Revision, error) {
+	snapshot, err := copySession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions, err := s.read(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	// numbers of revisions follow the session's revision counter unless the history is out of sync with it
+	number := session.Revision
+	if len(revisions) > 0 && number <= revisions[len(revisions)-1].Number {
+		number = revisions[len(revisions)-1].Number + 1
+	}
+	if number < 1 {
+		number = 1
+	}
+	rev := &Revision{
+		Number:    number,
+		SessionID: session.ID,
+		Author:    author,
+		Time:      time.Now(),
+		Comment:   comment,
+		Session:   snapshot,
+	}
+	return rev, s.write(session.ID, append(revisions, rev))
+}
+
+// List returns revisions of the session from the oldest to the newest.
+func (s *Revisions) List(sessionID uuid.UUID) ([]*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(sessionID)
+}
+
+func (s *Revisions) Get(sessionID uuid.UUID, number int) (*Revision, error) {
+	revisions, err := s.List(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range revisions {
+		if rev.Number == number {
+			return rev, nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d of the session %v not found", number, sessionID)
+}
+
+// Remove deletes the whole history of the session.
+func (s *Revisions) Remove(sessionID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return removeFile(s.filepath(sessionID))
+}
+
+// SessionIDs returns IDs of sessions which have revisions.
+func (s *Revisions) SessionIDs() ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uuid.UUID{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		if id, err := uuid.Parse(strings.TrimSuffix(e.Name(), ".json")); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *Revisions) read(sessionID uuid.UUID) ([]*Revision, error) {
+	revisions := []*Revision{}
+
+	f, err := os.Open(s.filepath(sessionID))
+	if os.IsNotExist(err) {
+		return revisions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(&revisions); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode revisions of the session %v: %v", sessionID, err)
+	}
+	return revisions, nil
+}
+
+func (s *Revisions) write(sessionID uuid.UUID, revisions []*Revision) error {
+	f, err := os.Create(s.filepath(sessionID))
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(revisions)
+}
+
+func (s *Revisions) filepath(sessionID uuid.UUID) string {
+	return path.Join(s.dir, sessionID.String()+".json")
+}
+
+// copySession makes a deep copy of the session through its JSON representation.
+func copySession(session *Session) (*Session, error) {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	c := &Session{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
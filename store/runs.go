@@ -0,0 +1,214 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Run is a single run of a session with a child, commands sent during the run are kept in the CommandLog.
+type Run struct {
+	ID            uuid.UUID
+	SessionID     uuid.UUID
+	Session       string    // name of the session at the moment of the run
+	ParticipantID uuid.UUID // optional, the child the session is done with
+	Operator      string
+	Languages     []string // preferred languages of phrases, later ones are fallbacks
+	StartedAt     time.Time
+	FinishedAt    time.Time
+}
+
+// IsActive is true when the run hasn't been finished yet.
+func (r *Run) IsActive() bool {
+	return r.FinishedAt.IsZero()
+}
+
+// Kinds of timeline events.
+const (
+	EventCommand = "command"
+	EventNote    = "note"
+	EventMarker  = "marker"
+)
+
+// TimelineEvent is an event of the run with its offset from the start of the run.
+type TimelineEvent struct {
+	Time    time.Time     `json:"time"`
+	Offset  float64       `json:"offset"` // in seconds
+	Kind    string        `json:"kind"`
+	Command *CommandEntry `json:"command,omitempty"`
+	Note    *Note         `json:"note,omitempty"`
+}
+
+// Timeline merges commands and operator's notes of the run into events in the chronological order.
+func (r *Run) Timeline(commands []*CommandEntry, notes []*Note) []*TimelineEvent {
+	events := []*TimelineEvent{}
+	for _, c := range commands {
+		events = append(events, &TimelineEvent{
+			Time:    c.Time,
+			Offset:  c.Time.Sub(r.StartedAt).Seconds(),
+			Kind:    EventCommand,
+			Command: c,
+		})
+	}
+	for _, n := range notes {
+		kind := EventNote
+		if n.Tag != "" {
+			kind = EventMarker
+		}
+		events = append(events, &TimelineEvent{
+			Time:   n.Time,
+			Offset: n.Time.Sub(r.StartedAt).Seconds(),
+			Kind:   kind,
+			Note:   n,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+type Runs struct {
+	Runs []*Run
+
+	filepath string
+	mu       sync.RWMutex
+}
+
+func NewRunsStore(fpath string) (*Runs, error) {
+	var file *os.File
+	_, err := os.Stat(fpath)
+	if os.IsNotExist(err) {
+		file, err = os.Create(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("can't create a runs store at %s: %v", fpath, err)
+		}
+	} else {
+		file, err = os.Open(fpath)
+	}
+	defer file.Close()
+
+	store := &Runs{
+		filepath: fpath,
+		Runs:     []*Run{},
+	}
+	if err = json.NewDecoder(file).Decode(&store.Runs); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode runs from %s: %v", fpath, err)
+	}
+
+	return store, store.dump()
+}
+
+func (s *Runs) Get(id string) (*Run, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByUUID(uid)
+}
+
+func (s *Runs) GetByUUID(id uuid.UUID) (*Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.Runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("not found: %v", id)
+}
+
+// Start creates a new active run of the session, participantID and languages can be empty.
+func (s *Runs) Start(session *Session, participantID uuid.UUID, operator string, languages []string) (*Run, error) {
+	run := &Run{
+		ID:            uuid.Must(uuid.NewRandom()),
+		SessionID:     session.ID,
+		Session:       session.Name,
+		ParticipantID: participantID,
+		Operator:      operator,
+		Languages:     languages,
+		StartedAt:     time.Now(),
+	}
+
+	s.mu.Lock()
+	s.Runs = append(s.Runs, run)
+	s.mu.Unlock()
+	return run, s.dump()
+}
+
+// Finish marks the run as finished, finishing a finished run does nothing.
+func (s *Runs) Finish(id uuid.UUID) error {
+	run, err := s.GetByUUID(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if run.IsActive() {
+		run.FinishedAt = time.Now()
+	}
+	s.mu.Unlock()
+	return s.dump()
+}
+
+// Active returns the latest active run of the session.
+func (s *Runs) Active(sessionID uuid.UUID) (*Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.Runs) - 1; i >= 0; i-- {
+		if s.Runs[i].SessionID == sessionID && s.Runs[i].IsActive() {
+			return s.Runs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no active run for the session %v", sessionID)
+}
+
+// ByParticipant returns runs of the participant in the chronological order.
+func (s *Runs) ByParticipant(participantID uuid.UUID) []*Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []*Run{}
+	for _, r := range s.Runs {
+		if r.ParticipantID == participantID {
+			runs = append(runs, r)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs
+}
+
+// LatestActive returns the most recently started active run of any session.
+func (s *Runs) LatestActive() (*Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest *Run
+	for _, r := range s.Runs {
+		if r.IsActive() && (latest == nil || r.StartedAt.After(latest.StartedAt)) {
+			latest = r
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no active runs")
+	}
+	return latest, nil
+}
+
+func (s *Runs) dump() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Create(s.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(s.Runs)
+}
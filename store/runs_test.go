@@ -0,0 +1,100 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRuns(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "runs.json")
+	runs, err := NewRunsStore(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{ID: uuid.New(), Name: "Greetings"}
+	child := uuid.New()
+
+	first, err := runs.Start(session, child, "Anna", []string{"et", "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := runs.Start(session, uuid.UUID{}, "Anna", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, err := runs.Active(session.ID); err != nil || active.ID != second.ID {
+		t.Fatalf("the active run is %v, %v, want the second one", active, err)
+	}
+	if latest, err := runs.LatestActive(); err != nil || latest.ID != second.ID {
+		t.Fatalf("the latest active run is %v, %v, want the second one", latest, err)
+	}
+
+	if err = runs.Finish(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	finishedAt := second.FinishedAt
+	if err = runs.Finish(second.ID); err != nil || second.FinishedAt != finishedAt {
+		t.Fatalf("finishing a finished run has changed it: %v", err)
+	}
+	if active, err := runs.Active(session.ID); err != nil || active.ID != first.ID {
+		t.Fatalf("the active run is %v, %v, want the first one", active, err)
+	}
+	if err = runs.Finish(uuid.New()); err == nil {
+		t.Fatal("an unknown run is finished")
+	}
+
+	// runs are kept in the file
+	loaded, err := NewRunsStore(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Runs) != 2 {
+		t.Fatalf("loaded %d runs, want 2", len(loaded.Runs))
+	}
+	run, err := loaded.Get(first.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Session != "Greetings" || run.ParticipantID != child || len(run.Languages) != 2 || !run.IsActive() {
+		t.Fatalf("unexpected loaded run %+v", run)
+	}
+	if byChild := loaded.ByParticipant(child); len(byChild) != 1 || byChild[0].ID != first.ID {
+		t.Fatalf("unexpected runs of the participant %v", byChild)
+	}
+	if err = loaded.Finish(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loaded.LatestActive(); err == nil {
+		t.Fatal("there are no active runs, but one is returned")
+	}
+}
+
+func TestRun_Timeline(t *testing.T) {
+	start := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	run := &Run{ID: uuid.New(), StartedAt: start}
+	commands := []*CommandEntry{
+		{Time: start.Add(time.Second), Name: "hello"},
+		{Time: start.Add(3 * time.Second), Name: "bye"},
+	}
+	notes := []*Note{
+		{Time: start.Add(2 * time.Second), Text: "smiles"},
+		{Time: start.Add(4 * time.Second), Tag: "distracted"},
+	}
+
+	events := run.Timeline(commands, notes)
+	want := []struct {
+		kind   string
+		offset float64
+	}{{EventCommand, 1}, {EventNote, 2}, {EventCommand, 3}, {EventMarker, 4}}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		if events[i].Kind != w.kind || events[i].Offset != w.offset {
+			t.Errorf("event %d is %s at %v, want %s at %v", i, events[i].Kind, events[i].Offset, w.kind, w.offset)
+		}
+	}
+}
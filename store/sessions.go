@@ -9,8 +9,10 @@ import (
 	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -24,6 +26,8 @@ type Session struct {
 	Name        string         `json:"Name" form:"Name" binding:"required"`
 	Description string         `json:"Description" form:"Description"`
 	Items       []*SessionItem `json:"Items" form:"Items"`
+	StartItemID uuid.UUID      `json:"StartItemID" form:"StartItemID"` // the first item is the start if it's empty
+	Revision    int            `json:"Revision" form:"Revision"`       // incremented on every save
 }
 
 func (s *Session) initializeIDs() {
@@ -66,11 +70,20 @@ func (s *Session) initializeIDs() {
 					action.ImageItem.ID = uuid.Must(uuid.NewRandom())
 				}
 			}
+			if action.StopItem != nil {
+				if (action.StopItem.ID == uuid.UUID{}) {
+					action.StopItem.ID = uuid.Must(uuid.NewRandom())
+				}
+			}
+			action.VariantsItem.InitiateItemsIDs()
 		}
 	}
 }
 
-func (s *Session) Export(dir string) (archivePath string, err error) {
+// Export archives the session with its uploads in dir. Moves from outside of uploads, e.g., built-in ones, are
+// only listed in the manifest by their names and groups unless bundleMoves is set, then their files are
+// archived too, so the session can be imported on an instance with another moves folder.
+func (s *Session) Export(dir string, bundleMoves bool) (archivePath string, err error) {
 	archiveFiles := []string{}
 
 	// create subdirectory
@@ -104,9 +117,11 @@ func (s *Session) Export(dir string) (archivePath string, err error) {
 
 	// export user data assets: uploads (images, sounds, moves)
 	userAssets := []string{}
+	seen := map[string]bool{} // the same file can be used by several actions
 	for _, item := range s.Items {
 		for _, assetPath := range item.LocateAssets() {
-			if strings.HasPrefix(assetPath, "data/uploads") {
+			if strings.HasPrefix(assetPath, "data/uploads") && !seen[assetPath] {
+				seen[assetPath] = true
 				userAssets = append(userAssets, assetPath)
 			}
 		}
@@ -121,6 +136,53 @@ func (s *Session) Export(dir string) (archivePath string, err error) {
 		archiveFiles = append(archiveFiles, newAsset) // keeping track of archive files
 	}
 
+	// list moves from outside of uploads and collect their files if needed
+	moves := []*ManifestMove{}
+	seen = map[string]bool{}
+	folders := map[string]bool{}
+	for _, item := range s.Items {
+		if item == nil {
+			continue
+		}
+		for _, action := range item.Actions {
+			for _, move := range moveItems(action) {
+				if move.FilePath == "" || strings.HasPrefix(move.FilePath, "data/uploads") || seen[move.FilePath] {
+					continue
+				}
+				seen[move.FilePath] = true
+				m := &ManifestMove{Name: move.Name, Group: move.Group, FilePath: move.FilePath}
+				if bundleMoves {
+					// moves/<move ID>/<file>, the folder keeps moves with the same file name apart
+					folder := move.ID.String()
+					if (move.ID == uuid.UUID{}) || folders[folder] {
+						folder = uuid.Must(uuid.NewRandom()).String()
+					}
+					folders[folder] = true
+					m.Path = path.Join("moves", folder, path.Base(move.FilePath))
+					if !isBundledMove(m.Path) {
+						m.Path = path.Join("moves", folder, "move.qianim")
+					}
+					newAsset := path.Join(subDirName, m.Path)
+					if err = os.MkdirAll(path.Dir(newAsset), 0777); err != nil {
+						return
+					}
+					if err = copyFile(move.FilePath, newAsset); err != nil {
+						return
+					}
+					archiveFiles = append(archiveFiles, newAsset)
+				}
+				moves = append(moves, m)
+			}
+		}
+	}
+
+	// describe the archive with checksums of its files
+	name = path.Join(subDirName, manifestFileName)
+	if err = writeManifest(name, subDirName, archiveFiles, moves); err != nil {
+		return
+	}
+	archiveFiles = append(archiveFiles, name)
+
 	// archive files
 	archivePath = subDirName + ".zip"
 	f, err = os.Create(archivePath)
@@ -158,10 +220,23 @@ func (s *Session) Export(dir string) (archivePath string, err error) {
 
 // SessionItem represents a single unit of a session, it's a question and positive and negative
 // answers accompanied with a robot's moves which are represented in the web UI as a set of buttons.
+// Items form a directed graph: an item can declare which item comes next depending on the picked answer,
+// see Session.Next.
 type SessionItem struct {
 	ID      uuid.UUID
+	Title   string
 	Actions []*instruction.Action // the first item of Actions is the main item, usually, it's the main question
 	// of the session item, other actions are some kind of conversation supportive answers
+
+	Branches []*Branch // transitions depending on the picked answer
+	Next     uuid.UUID // the next item when no branch matches, the following item in Items if it's empty
+	End      bool      // the session ends after this item regardless of Next
+}
+
+// Branch leads to the next item when the answer action has been picked.
+type Branch struct {
+	ActionID   uuid.UUID
+	NextItemID uuid.UUID
 }
 
 func (si *SessionItem) LocateAssets() []string {
@@ -174,12 +249,28 @@ func (si *SessionItem) LocateAssets() []string {
 
 type Sessions struct {
 	Sessions []*Session
+	Trash    []*DeletedSession
+
+	// TrashRetention is how long deleted sessions are kept in the trash before they are purged with their files.
+	TrashRetention time.Duration
 
-	filepath string
-	mu       sync.RWMutex
+	filepath      string
+	trashFilepath string
+	revisions     *Revisions
+	mu            sync.RWMutex
+	editMu        sync.Mutex // serializes changes of sessions to check their revisions
 }
 
-func NewSessionStore(fpath string) (*Sessions, error) {
+// DeletedSession is a session in the trash, it can be recovered until it's purged.
+type DeletedSession struct {
+	Session   *Session
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// NewSessionStore loads sessions from fpath and deleted sessions from the trash file next to it. Every save
+// of a session is recorded to revisions if they are provided.
+func NewSessionStore(fpath string, revisions *Revisions) (*Sessions, error) {
 	var file *os.File
 	_, err := os.Stat(fpath)
 	if os.IsNotExist(err) {
@@ -209,11 +300,30 @@ func NewSessionStore(fpath string) (*Sessions, error) {
 	}
 
 	store := &Sessions{
-		filepath: fpath,
-		Sessions: sessions,
+		filepath:      fpath,
+		trashFilepath: strings.TrimSuffix(fpath, path.Ext(fpath)) + ".trash.json",
+		revisions:     revisions,
+		Sessions:      sessions,
+		Trash:         []*DeletedSession{},
+	}
+
+	var trashFile *os.File
+	_, err = os.Stat(store.trashFilepath)
+	if os.IsNotExist(err) {
+		trashFile, err = os.Create(store.trashFilepath)
+		if err != nil {
+			return nil, fmt.Errorf("can't create a sessions trash at %s: %v", store.trashFilepath, err)
+		}
+	} else {
+		trashFile, err = os.Open(store.trashFilepath)
 	}
+	defer trashFile.Close()
 
-	return store, nil
+	if err = json.NewDecoder(trashFile).Decode(&store.Trash); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("can't decode the sessions trash from %s: %v", store.trashFilepath, err)
+	}
+
+	return store, store.dumpTrash()
 }
 
 // GetAction looks for a top level instruction, which unites Say and Move actions
@@ -239,12 +349,32 @@ func (s *Sessions) GetAction(id uuid.UUID) *instruction.Action {
 				if action.ImageItem != nil && action.ImageItem.ID == id {
 					return action
 				}
+				if action.StopItem != nil && action.StopItem.ID == id {
+					return action
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// Locate returns the session and the session item which contain the action with the ID.
+func (s *Sessions) Locate(actionID uuid.UUID) (*Session, *SessionItem, error) {
+	for _, session := range s.Sessions {
+		for _, item := range session.Items {
+			if item == nil {
+				continue
+			}
+			for _, action := range item.Actions {
+				if action != nil && action.ID == actionID {
+					return session, item, nil
+				}
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("not found")
+}
+
 func (s *Sessions) Get(id string) (*Session, error) {
 	uid, err := uuid.Parse(id)
 	if err != nil {
@@ -307,56 +437,106 @@ func (s *Sessions) GetItem(id string) (*SessionItem, error) {
 //	return nil, fmt.Errorf("not found")
 //}
 
-func (s *Sessions) Create(newSession *Session) error {
+// Create adds a new session and records it as the first revision, author can be empty.
+func (s *Sessions) Create(newSession *Session, author string) error {
 	newSession.initializeIDs()
 	if s.isDuplicate(newSession) {
 		return fmt.Errorf("cannot create a new session, duplicated ID: %v", newSession.ID)
 	}
+	newSession.Revision = 1
 	s.mu.Lock()
 	s.Sessions = append(s.Sessions, newSession)
 	s.mu.Unlock()
-	return s.dump()
+	if err := s.dump(); err != nil {
+		return err
+	}
+	return s.record(newSession, author, "created")
+}
+
+// Update replaces the session and records it as a new revision, author can be empty. If the revision
+// of the updated session is set, it must be the current one, otherwise, a ConflictError is returned.
+func (s *Sessions) Update(updatedSession *Session, author string) error {
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+
+	if current, err := s.Get(updatedSession.ID.String()); err == nil &&
+		updatedSession.Revision > 0 && updatedSession.Revision != current.Revision {
+		return &ConflictError{Expected: updatedSession.Revision, Current: current.Revision}
+	}
+	return s.update(updatedSession, author, "")
 }
 
-func (s *Sessions) Update(updatedSession *Session) error {
+// update replaces the session and increments its revision, callers must hold editMu.
+func (s *Sessions) update(updatedSession *Session, author, comment string) error {
 	updatedSession.initializeIDs()
+	var found *Session
 	for _, s := range s.Sessions {
 		if s.ID == updatedSession.ID {
+			updatedSession.Revision = s.Revision + 1
 			*s = *updatedSession
+			found = s
 		}
 	}
-	return s.dump()
+	if found == nil {
+		return fmt.Errorf("not found: %v", updatedSession.ID)
+	}
+	if err := s.dump(); err != nil {
+		return err
+	}
+	return s.record(found, author, comment)
 }
 
-func (s *Sessions) Delete(id string) error {
-	uid, err := uuid.Parse(id)
-	if err != nil {
-		return err
+// Restore makes the revision of the session its current version, which is recorded as a new revision.
+// Paths of files which are referenced by the revision but don't exist anymore are returned.
+func (s *Sessions) Restore(id string, number int, author string) (*Session, []string, error) {
+	if s.revisions == nil {
+		return nil, nil, fmt.Errorf("revisions aren't kept")
 	}
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
 
-	session, err := s.Get(id)
+	current, err := s.Get(id)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	rev, err := s.revisions.Get(current.ID, number)
+	if err != nil {
+		return nil, nil, err
+	}
+	restored, err := copySession(rev.Session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = s.update(restored, author, fmt.Sprintf("restored from revision %d", number)); err != nil {
+		return nil, nil, err
 	}
 
-	// removing all audio files attached to the session
-	for _, item := range session.Items {
+	missing := []string{}
+	for _, item := range current.Items {
 		if item == nil {
 			continue
 		}
-		for _, action := range item.Actions {
-			if action.SayItem != nil && action.SayItem.FilePath != "" {
-				if err = removeFile(action.SayItem.FilePath); err != nil {
-					return err
-				}
-			}
-			if action.ImageItem != nil && action.ImageItem.FilePath != "" {
-				if err = removeFile(action.ImageItem.FilePath); err != nil {
-					return err
-				}
+		for _, fpath := range item.LocateAssets() {
+			if _, err := os.Stat(fpath); os.IsNotExist(err) {
+				missing = append(missing, fpath)
 			}
 		}
 	}
+	return current, missing, nil
+}
+
+// Delete moves the session to the trash, its files are kept until the session is purged. Sessions which have
+// been in the trash longer than TrashRetention are purged.
+func (s *Sessions) Delete(id string, author string) error {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.Get(id)
+	if err != nil {
+		return err
+	}
 
 	newSessions := []*Session{}
 
@@ -369,112 +549,237 @@ func (s *Sessions) Delete(id string) error {
 
 	s.mu.Lock()
 	s.Sessions = newSessions
+	s.Trash = append(s.Trash, &DeletedSession{Session: session, DeletedAt: time.Now(), DeletedBy: author})
 	s.mu.Unlock()
 
-	return s.dump()
+	if err = s.dump(); err != nil {
+		return err
+	}
+	if err = s.dumpTrash(); err != nil {
+		return err
+	}
+	_, err = s.PurgeExpired()
+	return err
 }
 
-func (s *Sessions) DeleteInstruction(id string) error {
-	uid, err := uuid.Parse(id)
+// Undelete moves the session from the trash back to sessions.
+func (s *Sessions) Undelete(id string) (*Session, error) {
+	deleted, err := s.getDeleted(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.isDuplicate(deleted.Session) {
+		return nil, fmt.Errorf("cannot recover the session, duplicated ID: %v", deleted.Session.ID)
+	}
+
+	s.mu.Lock()
+	s.Sessions = append(s.Sessions, deleted.Session)
+	s.Trash = removeDeleted(s.Trash, deleted)
+	s.mu.Unlock()
+
+	if err = s.dump(); err != nil {
+		return nil, err
+	}
+	return deleted.Session, s.dumpTrash()
+}
+
+// Purge removes the session from the trash permanently together with its files and revisions.
+func (s *Sessions) Purge(id string) error {
+	deleted, err := s.getDeleted(id)
 	if err != nil {
 		return err
 	}
+	if err = s.purge(deleted); err != nil {
+		return err
+	}
+	return s.dumpTrash()
+}
 
-	// removing instruction's files
-	action := s.GetAction(uid)
-	if action != nil {
-		if action.SayItem != nil && len(action.SayItem.FilePath) > 0 {
-			err = os.Remove(action.SayItem.FilePath)
-			if err != nil {
-				log.Println(fmt.Errorf("failed to remove audio from the action: %v", err))
-			}
+// PurgeExpired purges sessions which have been in the trash longer than TrashRetention and returns
+// their number. Nothing is purged if the retention isn't set.
+func (s *Sessions) PurgeExpired() (int, error) {
+	if s.TrashRetention <= 0 {
+		return 0, nil
+	}
+
+	expired := []*DeletedSession{}
+	s.mu.RLock()
+	for _, deleted := range s.Trash {
+		if time.Since(deleted.DeletedAt) > s.TrashRetention {
+			expired = append(expired, deleted)
 		}
-		if action.ImageItem != nil && action.ImageItem.FilePath != "" {
-			err = os.Remove(action.ImageItem.FilePath)
-			if err != nil {
-				log.Println(fmt.Errorf("failed to remove image %s from the action: %v", action.ImageItem.FilePath, err))
-			}
+	}
+	s.mu.RUnlock()
+
+	for _, deleted := range expired {
+		if err := s.purge(deleted); err != nil {
+			return 0, err
 		}
 	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	return len(expired), s.dumpTrash()
+}
 
-	// removing the instruction
-	for _, session := range s.Sessions {
-		for _, item := range session.Items {
-			for _, action := range item.Actions {
-				if action.ID == uid {
-					newActions := []*instruction.Action{}
-					for _, action := range item.Actions {
-						if action.ID == uid {
-							continue
-						}
-						newActions = append(newActions, action)
-					}
-					s.mu.Lock()
-					item.Actions = newActions
-					s.mu.Unlock()
-					break
-				}
+// purge removes files of the session and all its revisions unless other sessions, deleted sessions or their
+// revisions still refer to them.
+func (s *Sessions) purge(deleted *DeletedSession) error {
+	owned := map[string]bool{}
+	for _, fpath := range ownedFiles(deleted.Session) {
+		owned[fpath] = true
+	}
+	if s.revisions != nil {
+		revisions, err := s.revisions.List(deleted.Session.ID)
+		if err != nil {
+			return err
+		}
+		for _, rev := range revisions {
+			for _, fpath := range ownedFiles(rev.Session) {
+				owned[fpath] = true
 			}
 		}
 	}
 
-	return s.dump()
+	referenced, err := s.referencedFiles(deleted.Session.ID)
+	if err != nil {
+		return err
+	}
+	unused := []string{}
+	for fpath := range owned {
+		if !referenced[fpath] {
+			unused = append(unused, fpath)
+		}
+	}
+	sort.Strings(unused)
+	for _, fpath := range unused {
+		if err = removeFile(fpath); err != nil {
+			return err
+		}
+	}
+
+	if s.revisions != nil {
+		if err = s.revisions.Remove(deleted.Session.ID); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.Trash = removeDeleted(s.Trash, deleted)
+	s.mu.Unlock()
+	return nil
 }
 
-func (s *Sessions) Import(fpath string, overwrite bool, fileStore *Files) error {
-	r, err := zip.OpenReader(fpath)
-	if err != nil {
-		return fmt.Errorf("failed to open a reader for %s: %v", fpath, err)
+// referencedFiles returns files owned by sessions, deleted sessions and their revisions except the session
+// with the ID.
+func (s *Sessions) referencedFiles(except uuid.UUID) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	add := func(session *Session) {
+		if session == nil || session.ID == except {
+			return
+		}
+		for _, fpath := range ownedFiles(session) {
+			referenced[fpath] = true
+		}
 	}
-	defer r.Close()
 
-	for _, f := range r.File {
-		// creating a new or updating an existing session
-		if f.Name == "session.json" {
-			ff, err := f.Open()
-			if err != nil {
-				return fmt.Errorf("failed to open %s at %s: %v", f.Name, fpath, err)
-			}
+	s.mu.RLock()
+	for _, session := range s.Sessions {
+		add(session)
+	}
+	for _, d := range s.Trash {
+		add(d.Session)
+	}
+	s.mu.RUnlock()
 
-			var session Session
-			if err = json.NewDecoder(ff).Decode(&session); err != nil {
-				return fmt.Errorf("failed to decode %s at %s: %v", f.Name, fpath, err)
-			}
-			err = ff.Close()
-			if err != nil {
-				return fmt.Errorf("failed to close %s at %s: %v", f.Name, fpath, err)
-			}
+	if s.revisions == nil {
+		return referenced, nil
+	}
+	ids, err := s.revisions.SessionIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id == except {
+			continue
+		}
+		revisions, err := s.revisions.List(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range revisions {
+			add(rev.Session)
+		}
+	}
+	return referenced, nil
+}
 
-			if overwrite && s.isDuplicate(&session) {
-				err = s.Update(&session)
-			} else {
-				err = s.Create(&session)
-			}
-			if err != nil {
-				return err
-			}
+// ownedFiles returns files which belong to actions of the session.
+func ownedFiles(session *Session) []string {
+	paths := []string{}
+	if session == nil {
+		return paths
+	}
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		for _, action := range item.Actions {
+			paths = append(paths, action.OwnedFiles()...)
 		}
+	}
+	return paths
+}
 
-		// checking and uploading attached files
-		if strings.HasPrefix(f.Name, "uploads/") {
-			name := path.Base(f.Name)
-			ff, err := f.Open()
-			if err != nil {
-				return fmt.Errorf("failed to open %s at %s: %v", f.Name, fpath, err)
-			}
+func (s *Sessions) getDeleted(id string) (*DeletedSession, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
 
-			if _, err = fileStore.Save(name, ff); err != nil {
-				return fmt.Errorf("failed to save a file at %s: %v", name, err)
-			}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-			err = ff.Close()
-			if err != nil {
-				return fmt.Errorf("failed to close %s at %s: %v", f.Name, fpath, err)
-			}
+	for _, deleted := range s.Trash {
+		if deleted.Session.ID == uid {
+			return deleted, nil
 		}
 	}
+	return nil, fmt.Errorf("not found in the trash: %v", id)
+}
 
-	return nil
+func removeDeleted(trash []*DeletedSession, deleted *DeletedSession) []*DeletedSession {
+	newTrash := []*DeletedSession{}
+	for _, d := range trash {
+		if d != deleted {
+			newTrash = append(newTrash, d)
+		}
+	}
+	return newTrash
+}
+
+// record saves the session as a new revision if revisions are kept.
+func (s *Sessions) record(session *Session, author, comment string) error {
+	if s.revisions == nil {
+		return nil
+	}
+	_, err := s.revisions.Record(session, author, comment)
+	return err
+}
+
+func (s *Sessions) DeleteInstruction(id string) error {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+
+	// the instruction's files are kept until the session is purged, because revisions may reference them
+	action := s.GetAction(uid)
+	if action == nil {
+		return fmt.Errorf("not found: %v", id)
+	}
+	_, err = s.DeleteAction(0, "", action.ID)
+	return err
 }
 
 func (s *Sessions) dump() error {
@@ -489,6 +794,18 @@ func (s *Sessions) dump() error {
 	return json.NewEncoder(f).Encode(s.Sessions)
 }
 
+func (s *Sessions) dumpTrash() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Create(s.trashFilepath)
+	if err != nil {
+		return fmt.Errorf("failed to open a file: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(s.Trash)
+}
+
 func (s *Sessions) isDuplicate(ss *Session) bool {
 	for _, v := range s.Sessions {
 		if v.ID == ss.ID {
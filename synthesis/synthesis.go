@@ -0,0 +1,386 @@
+/*
+Package synthesis synthesizes audio for phrases of a session in the background. A job finds every Say instruction
+of the session which has a phrase but no audio file, synthesizes the phrase, saves the audio to the file store and
+attaches it to the instruction. Progress and failures of the job are reported per phrase. Jobs are kept in memory
+only, because a job interrupted by a restart can be simply started again.
+*/
+package synthesis
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/eki"
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+// Language of phrases which can be synthesized, phrases without a language are considered to be in it too.
+const Language = "et"
+
+// SynthesizeFunc returns MP3 audio of the text spoken by the voice with the emotion.
+type SynthesizeFunc func(text string, voice, emotion uint8) ([]byte, error)
+
+// Status of a job or a task.
+type Status string
+
+const (
+	Pending  Status = "pending"
+	Running  Status = "running"
+	Done     Status = "done"
+	Failed   Status = "failed"
+	Skipped  Status = "skipped" // the phrase can't be synthesized, e.g., it's in another language
+	Finished Status = "finished"
+)
+
+// downloadTimeout limits the download of a synthesized audio file, so a stalled download doesn't hang the job.
+const downloadTimeout = time.Minute
+
+var downloadClient = &http.Client{Timeout: downloadTimeout}
+
+// Task is a phrase to synthesize. Translation is empty for the main phrase of the Say instruction.
+type Task struct {
+	ItemID      uuid.UUID `json:"item_id"`
+	ActionID    uuid.UUID `json:"action_id"`
+	SayID       uuid.UUID `json:"say_id"`
+	Translation string    `json:"translation"`
+	Phrase      string    `json:"phrase"`
+	Status      Status    `json:"status"`
+	FilePath    string    `json:"file_path"`
+	Error       string    `json:"error"`
+}
+
+// Job synthesizes all phrases of a session without audio.
+type Job struct {
+	ID         uuid.UUID `json:"id"`
+	SessionID  uuid.UUID `json:"session_id"`
+	Voice      uint8     `json:"voice"`
+	Emotion    uint8     `json:"emotion"`
+	Author     string    `json:"author"`
+	Status     Status    `json:"status"`
+	Total      int       `json:"total"`     // phrases to synthesize, skipped ones aren't counted
+	Processed  int       `json:"processed"` // phrases which have been synthesized or failed so far
+	Completed  int       `json:"completed"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped"`
+	Tasks      []*Task   `json:"tasks"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Jobs starts synthesis jobs and keeps their progress.
+type Jobs struct {
+	sessions   *store.Sessions
+	files      *store.Files
+	synthesize SynthesizeFunc
+	jobs       map[uuid.UUID]*Job
+	mu         sync.Mutex
+}
+
+func New(sessions *store.Sessions, files *store.Files, synthesize SynthesizeFunc) *Jobs {
+	return &Jobs{
+		sessions:   sessions,
+		files:      files,
+		synthesize: synthesize,
+		jobs:       map[uuid.UUID]*Job{},
+	}
+}
+
+// Start creates a job for the session and runs it in the background. Only one job per session can run at a time.
+func (s *Jobs) Start(sessionID string, voice, emotion uint8, author string) (*Job, error) {
+	session, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.SessionID == session.ID && job.Status == Running {
+			return nil, fmt.Errorf("speech synthesis for the session is already running: job %v", job.ID)
+		}
+	}
+
+	tasks := collectTasks(session)
+	skipped := 0
+	for _, task := range tasks {
+		if task.Status == Skipped {
+			skipped++
+		}
+	}
+	job := &Job{
+		ID:        uuid.Must(uuid.NewRandom()),
+		SessionID: session.ID,
+		Voice:     voice,
+		Emotion:   emotion,
+		Author:    author,
+		Status:    Running,
+		Total:     len(tasks) - skipped,
+		Skipped:   skipped,
+		Tasks:     tasks,
+		StartedAt: time.Now(),
+	}
+	s.jobs[job.ID] = job
+
+	go s.run(job)
+
+	return job.copy(), nil
+}
+
+// Get returns a snapshot of the job.
+func (s *Jobs) Get(id uuid.UUID) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("synthesis job not found: %v", id)
+	}
+	return job.copy(), nil
+}
+
+// List returns snapshots of all jobs from the oldest to the newest.
+func (s *Jobs) List() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.copy())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+	})
+	return jobs
+}
+
+// run synthesizes phrases one by one and then attaches all synthesized audio to the session at once,
+// so the job produces a single revision of the session.
+func (s *Jobs) run(job *Job) {
+	for _, task := range job.Tasks {
+		if task.Status == Skipped {
+			continue
+		}
+		s.mu.Lock()
+		task.Status = Running
+		s.mu.Unlock()
+
+		fpath, err := s.synthesizeTask(task, job.Voice, job.Emotion)
+
+		s.mu.Lock()
+		if err != nil {
+			job.fail(task, err)
+		} else {
+			task.FilePath = fpath
+		}
+		job.Processed++
+		s.mu.Unlock()
+	}
+
+	err := s.attach(job)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range job.Tasks {
+		if task.Status != Running {
+			continue
+		}
+		if err != nil {
+			job.fail(task, err)
+			_ = s.files.Delete(task.FilePath)
+			task.FilePath = ""
+			continue
+		}
+		task.Status = Done
+		job.Completed++
+	}
+	job.Status = Finished
+	job.FinishedAt = time.Now()
+}
+
+func (s *Jobs) synthesizeTask(task *Task, voice, emotion uint8) (string, error) {
+	audio, err := s.synthesize(task.Phrase, voice, emotion)
+	if err != nil {
+		return "", err
+	}
+	name := uuid.Must(uuid.NewRandom()).String() + ".mp3"
+	return s.files.Save(name, bytes.NewReader(audio))
+}
+
+// attach sets file paths of synthesized phrases. A phrase which has been changed or got audio while the job
+// was running is left as it is and its task fails.
+func (s *Jobs) attach(job *Job) error {
+	s.mu.Lock()
+	pending := []*Task{}
+	for _, task := range job.Tasks {
+		if task.Status == Running {
+			pending = append(pending, task)
+		}
+	}
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	stale := []*Task{}
+	comment := fmt.Sprintf("speech synthesized for %d phrases", len(pending))
+	_, err := s.sessions.Edit(job.SessionID.String(), 0, job.Author, comment, func(session *store.Session) error {
+		says := map[uuid.UUID]*instruction.Say{}
+		for _, item := range session.Items {
+			if item == nil {
+				continue
+			}
+			for _, action := range item.Actions {
+				for _, say := range sayItems(action) {
+					says[say.ID] = say
+				}
+			}
+		}
+		stale = stale[:0]
+		for _, task := range pending {
+			phrase, fpath := target(says[task.SayID], task.Translation)
+			if phrase == nil || *phrase != task.Phrase || *fpath != "" {
+				stale = append(stale, task)
+				continue
+			}
+			*fpath = task.FilePath
+		}
+		if len(stale) == len(pending) {
+			return fmt.Errorf("all phrases have been changed while the job was running")
+		}
+		return nil
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, task := range stale {
+		job.fail(task, fmt.Errorf("the phrase has been changed while the job was running"))
+		_ = s.files.Delete(task.FilePath)
+		task.FilePath = ""
+	}
+	return nil
+}
+
+// fail marks the task as failed, the caller must hold the lock.
+func (job *Job) fail(task *Task, err error) {
+	task.Status = Failed
+	task.Error = err.Error()
+	job.Failed++
+}
+
+func (job *Job) copy() *Job {
+	c := *job
+	c.Tasks = make([]*Task, len(job.Tasks))
+	for i, task := range job.Tasks {
+		t := *task
+		c.Tasks[i] = &t
+	}
+	return &c
+}
+
+// collectTasks finds phrases without audio including phrases of variants. Phrases in other languages than
+// the synthesizable one are skipped with a reason, so the job shows what it has left out.
+func collectTasks(session *store.Session) []*Task {
+	tasks := []*Task{}
+	for _, item := range session.Items {
+		if item == nil {
+			continue
+		}
+		for _, action := range item.Actions {
+			if action == nil {
+				continue
+			}
+			for _, say := range sayItems(action) {
+				if say.Phrase != "" && say.FilePath == "" {
+					tasks = append(tasks, newTask(item.ID, action.ID, say.ID, "", say.Phrase, say.Language))
+				}
+				for lang, t := range say.Translations {
+					if t == nil || t.Phrase == "" || t.FilePath != "" || lang == "" {
+						continue
+					}
+					tasks = append(tasks, newTask(item.ID, action.ID, say.ID, lang, t.Phrase, lang))
+				}
+			}
+		}
+	}
+	return tasks
+}
+
+func newTask(itemID, actionID, sayID uuid.UUID, translation, phrase, language string) *Task {
+	task := &Task{
+		ItemID:      itemID,
+		ActionID:    actionID,
+		SayID:       sayID,
+		Translation: translation,
+		Phrase:      phrase,
+		Status:      Pending,
+	}
+	if language != "" && instruction.NormalizeLanguage(language) != Language {
+		task.Status = Skipped
+		task.Error = fmt.Sprintf("the phrase is in %q, only %q can be synthesized", language, Language)
+	}
+	return task
+}
+
+// sayItems returns Say instructions of the action and its variants.
+func sayItems(action *instruction.Action) []*instruction.Say {
+	says := []*instruction.Say{}
+	if action == nil {
+		return says
+	}
+	if action.SayItem != nil {
+		says = append(says, action.SayItem)
+	}
+	if action.VariantsItem != nil {
+		for _, e := range action.VariantsItem.Entries {
+			if e != nil {
+				says = append(says, sayItems(e.Action)...)
+			}
+		}
+	}
+	return says
+}
+
+// target returns pointers to the phrase and the file path of the Say instruction or its translation.
+func target(say *instruction.Say, translation string) (*string, *string) {
+	if say == nil {
+		return nil, nil
+	}
+	if translation == "" {
+		return &say.Phrase, &say.FilePath
+	}
+	t := say.Translations[translation]
+	if t == nil {
+		return nil, nil
+	}
+	return &t.Phrase, &t.FilePath
+}
+
+// EKI synthesizes Estonian speech with the EKI speech synthesizer.
+func EKI(text string, voice, emotion uint8) ([]byte, error) {
+	response, err := eki.Send(&eki.Payload{Text: text, Voice: voice, Emotion: emotion})
+	if err != nil {
+		return nil, fmt.Errorf("speech synthesis has failed: %v", err)
+	}
+
+	resp, err := downloadClient.Get(response.MP3)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the synthesized audio: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the synthesized audio: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,65 @@
+package synthesis
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/iharsuvorau/garlic/instruction"
+	"github.com/iharsuvorau/garlic/store"
+)
+
+func TestJobs_SkipsOtherLanguages(t *testing.T) {
+	dir := t.TempDir()
+	revisions, err := store.NewRevisionsStore(filepath.Join(dir, "revisions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := store.NewSessionStore(filepath.Join(dir, "sessions.json"), revisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := store.NewFileStore(dir)
+
+	say := func(phrase, language string) *instruction.Action {
+		return &instruction.Action{ID: uuid.New(), SayItem: &instruction.Say{ID: uuid.New(), Phrase: phrase, Language: language}}
+	}
+	translated := say("tere", "et")
+	translated.SayItem.Translations = map[string]*instruction.Translation{"en": {Phrase: "hello"}}
+	session := &store.Session{ID: uuid.New(), Name: "synthesis", Items: []*store.SessionItem{{ID: uuid.New(), Actions: []*instruction.Action{
+		say("aitäh", ""), say("thanks", "en"), translated,
+	}}}}
+	if err = sessions.Create(session, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	synthesized := []string{}
+	jobs := New(sessions, files, func(text string, voice, emotion uint8) ([]byte, error) {
+		synthesized = append(synthesized, text)
+		return []byte("mp3"), nil
+	})
+	job, err := jobs.Start(session.ID.String(), 14, 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for job.Status != Finished {
+		time.Sleep(10 * time.Millisecond)
+		if job, err = jobs.Get(job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if job.Total != 2 || job.Completed != 2 || job.Skipped != 2 || job.Failed != 0 {
+		t.Fatalf("total %d, completed %d, skipped %d, failed %d", job.Total, job.Completed, job.Skipped, job.Failed)
+	}
+	if len(synthesized) != 2 {
+		t.Fatalf("synthesized %v, want only Estonian phrases", synthesized)
+	}
+	for _, task := range job.Tasks {
+		if task.Status == Skipped && task.Error == "" {
+			t.Errorf("the skipped phrase %q has no reason", task.Phrase)
+		}
+	}
+}